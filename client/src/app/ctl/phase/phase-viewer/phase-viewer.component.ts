@@ -14,9 +14,11 @@
 
 import { Component, OnInit } from '@angular/core';
 import { MatDialogRef } from '@angular/material/dialog';
-import { KustomNode } from '../phase.models';
-import { WsMessage, WsConstants } from 'src/services/ws/ws.models';
+import { KustomNode, PluginResult, DocumentDiff } from '../phase.models';
+import { WsMessage, WsConstants, WsReceiver } from 'src/services/ws/ws.models';
 import { WsService } from 'src/services/ws/ws.service';
+import { Log } from 'src/services/log/log.service';
+import { LogMessage } from 'src/services/log/log-message';
 import { FormControl, FormGroup } from '@angular/forms';
 
 @Component({
@@ -26,8 +28,15 @@ import { FormControl, FormGroup } from '@angular/forms';
 
 })
 
-export class PhaseViewerComponent implements OnInit {
+export class PhaseViewerComponent implements OnInit, WsReceiver {
+    className = this.constructor.name;
+    // the plugin responses come back on the document component, the viewer takes them while it's open
+    type = WsConstants.CTL;
+    component = WsConstants.DOCUMENT;
+
     editorOptions = {language: 'yaml', automaticLayout: true, readOnly: true, theme: 'airshipTheme'};
+    pluginEditorOptions = {language: 'yaml', automaticLayout: true, readOnly: false, theme: 'airshipTheme'};
+    diffEditorOptions = {language: 'plaintext', automaticLayout: true, readOnly: true, theme: 'airshipTheme'};
     bundleYaml: string;
     executorYaml: string;
     phaseDetails: string;
@@ -39,6 +48,16 @@ export class PhaseViewerComponent implements OnInit {
     name: string;
     yaml: string;
 
+    // the document plugin run against the documents in the results
+    showPlugin = false;
+    pluginConfig = '';
+    pluginOutput = '';
+    pluginOverwrite = false;
+    pluginRunning = false;
+    pluginResult: PluginResult;
+    pluginMsg = '';
+    diff: string = null;
+
     filterOptions = new FormGroup({
         name: new FormControl(''),
         namespace: new FormControl(''),
@@ -53,6 +72,7 @@ export class PhaseViewerComponent implements OnInit {
         private websocketService: WsService) {}
 
     ngOnInit(): void {
+        this.websocketService.registerFunctions(this);
         this.bundleYaml = this.yaml;
         if (this.bundleYaml !== '') {
             this.getDocumentsBySelector('{}');
@@ -65,7 +85,32 @@ export class PhaseViewerComponent implements OnInit {
         this.results = null;
     }
 
+    public async receiver(message: WsMessage): Promise<void> {
+        if (message.subComponent !== WsConstants.PLUGIN) {
+            Log.Error(new LogMessage('Document message sub component not handled', this.className, message));
+            return;
+        }
+
+        this.pluginRunning = false;
+        if (message.hasOwnProperty(WsConstants.ERROR)) {
+            this.websocketService.printIfToast(message);
+            this.pluginMsg = 'Plugin run failed';
+            return;
+        }
+
+        this.pluginResult = Object.assign(new PluginResult(), message.data);
+        this.yaml = atob(message.yaml);
+        this.diff = null;
+        const changed = this.pluginResult.documents.filter(doc => doc.status !== 'unchanged').length;
+        this.pluginMsg = 'Plugin ' + message.message + ' ' + changed + ' document(s)';
+        if (this.pluginResult.written !== undefined && this.pluginResult.written !== '') {
+            this.pluginMsg += ', output written to ' + this.pluginResult.written;
+        }
+    }
+
     setModel(val: string): void {
+        this.showPlugin = false;
+        this.diff = null;
         switch (val) {
             case WsConstants.BUNDLE:
                 this.yaml = this.bundleYaml;
@@ -87,6 +132,8 @@ export class PhaseViewerComponent implements OnInit {
     }
 
     getYaml(id: string): void {
+        this.showPlugin = false;
+        this.diff = null;
         this.yaml = null;
         const msg = new WsMessage(WsConstants.CTL, WsConstants.PHASE, WsConstants.GET_YAML);
         msg.id = id;
@@ -94,6 +141,33 @@ export class PhaseViewerComponent implements OnInit {
         this.websocketService.sendMessage(msg);
       }
 
+    openPlugin(): void {
+        this.showPlugin = true;
+        this.diff = null;
+    }
+
+    // runPlugin sends the plugin config to run against the documents in the results, or the whole bundle
+    // when there aren't any
+    runPlugin(): void {
+        this.pluginRunning = true;
+        this.pluginResult = null;
+        this.pluginMsg = '';
+        const msg = new WsMessage(WsConstants.CTL, WsConstants.DOCUMENT, WsConstants.PLUGIN);
+        msg.id = this.id;
+        msg.yaml = btoa(this.pluginConfig);
+        const run = {
+            documents: this.results.map(node => node.id),
+            output: this.pluginOutput,
+            overwrite: this.pluginOverwrite
+        };
+        msg.data = JSON.parse(JSON.stringify(run));
+        this.websocketService.sendMessage(msg);
+    }
+
+    showDiff(doc: DocumentDiff): void {
+        this.diff = doc.diff !== undefined ? doc.diff : doc.name + ' is ' + doc.status;
+    }
+
     onSubmit(data: any): void {
         this.loading = true;
         this.results = [];
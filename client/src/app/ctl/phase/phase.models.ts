@@ -27,3 +27,14 @@ export class RunOptions {
     Debug: boolean;
     DryRun: boolean;
 }
+
+export class DocumentDiff {
+    name: string;
+    status: string;
+    diff: string;
+}
+
+export class PluginResult {
+    written: string;
+    documents: DocumentDiff[];
+}
@@ -42,6 +42,7 @@ export class AuthGuard implements WsReceiver, CanActivate {
 
     // blank out the local storage so we can't get re authenticate
     localStorage.removeItem('airshipUI-token');
+    document.cookie = 'airshipUI-token=; path=/; max-age=0; SameSite=Strict';
 
     // turn off the log panel, no logs for you!
     AuthGuard.toggleLogPanel(false);
@@ -160,6 +161,7 @@ export class AuthGuard implements WsReceiver, CanActivate {
     if (token !== null) {
       if (token.hasOwnProperty('token')) {
         WsService.token = token.token;
+        document.cookie = 'airshipUI-token=' + token.token + '; path=/; SameSite=Strict';
       }
     }
   }
@@ -195,6 +197,9 @@ export class AuthGuard implements WsReceiver, CanActivate {
       // set the token locally to have a login till browser exits
       const json: any = { token: WsService.token };
       localStorage.setItem('airshipUI-token', JSON.stringify(json));
+
+      // downloads can't set an Authorization header so the backend takes the token from a cookie too
+      document.cookie = 'airshipUI-token=' + token + '; path=/; SameSite=Strict';
     }
   }
 
@@ -0,0 +1,109 @@
+/*
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+// decodeCbor turns the CBOR the backend sends into the same object JSON.parse would give for the JSON version
+// of the message.  Byte strings become base64 strings since that's what they are in JSON
+export function decodeCbor(buffer: ArrayBuffer): any {
+  const view = new DataView(buffer);
+  const bytes = new Uint8Array(buffer);
+  const decoder = new TextDecoder();
+  let offset = 0;
+
+  const length = (info: number): number => {
+    let n: number;
+    switch (info) {
+      case 24: n = view.getUint8(offset); offset += 1; return n;
+      case 25: n = view.getUint16(offset); offset += 2; return n;
+      case 26: n = view.getUint32(offset); offset += 4; return n;
+      case 27: n = view.getUint32(offset) * 0x100000000 + view.getUint32(offset + 4); offset += 8; return n;
+      default:
+        if (info < 24) {
+          return info;
+        }
+        throw new Error('unsupported cbor length ' + info);
+    }
+  };
+
+  const next = (n: number): Uint8Array => {
+    if (offset + n > bytes.length) {
+      throw new Error('unexpected end of cbor');
+    }
+    const b = bytes.subarray(offset, offset + n);
+    offset += n;
+    return b;
+  };
+
+  const base64 = (b: Uint8Array): string => {
+    let s = '';
+    for (let i = 0; i < b.length; i += 0x8000) {
+      s += String.fromCharCode.apply(null, b.subarray(i, i + 0x8000));
+    }
+    return btoa(s);
+  };
+
+  const decode = (): any => {
+    const initial = view.getUint8(offset++);
+    const major = initial >> 5;
+    const info = initial & 0x1f;
+
+    if (major === 7) {
+      switch (info) {
+        case 20: return false;
+        case 21: return true;
+        case 22: case 23: return null;
+        case 25: {
+          // half precision floats are widened by hand, there's no getFloat16
+          const h = view.getUint16(offset);
+          offset += 2;
+          const exp = (h >> 10) & 0x1f;
+          const mant = h & 0x3ff;
+          const sign = h & 0x8000 ? -1 : 1;
+          if (exp === 0) { return sign * mant * Math.pow(2, -24); }
+          if (exp === 0x1f) { return mant ? NaN : sign * Infinity; }
+          return sign * (mant + 1024) * Math.pow(2, exp - 25);
+        }
+        case 26: { const f = view.getFloat32(offset); offset += 4; return f; }
+        case 27: { const f = view.getFloat64(offset); offset += 8; return f; }
+        default: throw new Error('unsupported cbor simple value ' + info);
+      }
+    }
+
+    const n = length(info);
+    switch (major) {
+      case 0: return n;
+      case 1: return -1 - n;
+      case 2: return base64(next(n));
+      case 3: return decoder.decode(next(n));
+      case 4: {
+        const items = [];
+        for (let i = 0; i < n; i++) {
+          items.push(decode());
+        }
+        return items;
+      }
+      case 5: {
+        const obj = {};
+        for (let i = 0; i < n; i++) {
+          const key = decode();
+          obj[key] = decode();
+        }
+        return obj;
+      }
+      // the only tag sent is the one that says a byte string is base64 in JSON
+      default: return decode();
+    }
+  };
+
+  return decode();
+}
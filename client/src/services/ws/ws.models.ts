@@ -19,6 +19,17 @@ export interface WsReceiver {
 
     // This is the method which will need to be implemented in the component to handle the messages
     receiver(message: WsMessage): Promise<void>;
+
+    // progress is told how much of a message sent in chunks has arrived, the receiver gets it once it's all here
+    progress?(message: WsMessage, received: number, total: number): void;
+}
+
+// Chunk says which piece of a message's yaml a message has, the last piece has everything else
+export class Chunk {
+  id: string;
+  index: number;
+  count: number;
+  size: number;
 }
 
 // WebsocketMessage is the structure for the json that is used to talk to the backend
@@ -38,6 +49,13 @@ export class WsMessage {
   message: string;
   token: string;
   refreshToken: string;
+  requestID: string;
+  sequence: number;
+  topic: string;
+  resumeToken: string;
+  protocolVersion: number;
+  encoding: string;
+  chunk: Chunk;
   data: JSON;
   yaml: string;
   actionType: string;
@@ -72,6 +90,7 @@ export class WsConstants {
   public static readonly IMAGE = 'image';
   public static readonly INIT = 'init';
   public static readonly PHASE = 'phase';
+  public static readonly PLUGIN = 'plugin';
   public static readonly PULL = 'pull';
   public static readonly RUN = 'run';
   public static readonly SECRET = 'secret';
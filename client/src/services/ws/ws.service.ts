@@ -14,6 +14,7 @@
 
 import { Injectable, OnDestroy } from '@angular/core';
 import { WsMessage, WsReceiver } from './ws.models';
+import { decodeCbor } from './cbor';
 import { ToastrService } from 'ngx-toastr';
 import 'reflect-metadata';
 
@@ -26,19 +27,33 @@ export class WsService implements OnDestroy {
   public static token: string;
   public static refreshToken: string;
 
+  // the version of the websocket protocol this client speaks, the backend answers with the one it'll use
+  public static readonly protocolVersion = 2;
+
+  // the encoding the backend sends messages in, json or cbor which is smaller for the yaml heavy messages
+  public static encoding = 'json';
+
   private ws: WebSocket;
   private restart = true;
   private restartTimeout: any;
   private keepAliveTimeout: any;
   private sessionID: string;
 
+  // what's needed to pick the session back up after a reconnect, with the messages sent while the connection was down
+  private resumeToken: string;
+  private resumeSessionID: string;
+  private lastSequence = 0;
+
+  // the yaml of the messages being sent in chunks, by chunk id
+  private chunks = new Map<string, string[]>();
+
   // functionMap is how we know where to send the direct messages
   // the structure of this map is: type -> component -> receiver
   private functionMap = new Map<string, Map<string, WsReceiver>>();
 
   // messageToObject unmarshalls the incoming message into a WebsocketMessage object
-  private static messageToObject(incomingMessage: string): WsMessage {
-    const json = JSON.parse(incomingMessage);
+  private static messageToObject(incomingMessage: string | ArrayBuffer): WsMessage {
+    const json = incomingMessage instanceof ArrayBuffer ? decodeCbor(incomingMessage) : JSON.parse(incomingMessage);
     const obj = new WsMessage();
     Object.assign(obj, json);
     return obj;
@@ -82,7 +97,17 @@ export class WsService implements OnDestroy {
       this.ws.close();
     }
 
-    this.ws = new WebSocket('wss://localhost:10443/ws');
+    let url = 'wss://localhost:10443/ws?encoding=' + WsService.encoding;
+    if (this.resumeToken !== undefined && this.resumeToken !== null) {
+      url += '&resume=' + encodeURIComponent(this.resumeToken) + '&sequence=' + this.lastSequence;
+    }
+    // every protocol version the UI speaks is offered, the backend picks the newest one it speaks too
+    const protocols = [];
+    for (let version = WsService.protocolVersion; version >= 1; version--) {
+      protocols.push('airshipui.v' + version);
+    }
+    this.ws = new WebSocket(url, protocols);
+    this.ws.binaryType = 'arraybuffer';
 
     this.ws.onmessage = (event) => {
       this.messageHandler(WsService.messageToObject(event.data));
@@ -170,6 +195,33 @@ export class WsService implements OnDestroy {
       this.sessionID = message.sessionID;
     }
 
+    // a new session starts counting from scratch, a resumed one replays what was missed next
+    if (message.type === 'ui' && message.component === 'initialize') {
+      // the backend won't talk to a client this old, reconnecting won't change that
+      if (message.error !== undefined && message.error !== null) {
+        this.restart = false;
+        this.toastrService.error(message.error);
+        return;
+      }
+      if (message.sessionID !== this.resumeSessionID) {
+        this.lastSequence = 0;
+        this.chunks.clear();
+      }
+      this.resumeSessionID = message.sessionID;
+      this.resumeToken = message.resumeToken;
+    }
+    if (message.sequence > this.lastSequence) {
+      this.lastSequence = message.sequence;
+    }
+
+    // large yaml comes in pieces, the message is handled once they're all here
+    if (message.chunk !== undefined && message.chunk !== null) {
+      message = this.assemble(message);
+      if (message === null) {
+        return;
+      }
+    }
+
     switch (message.type) {
       case 'alert': this.toastrService.warning(message.message); break; // TODO (aschiefe): improve alert handling
       default:  if (this.functionMap.hasOwnProperty(message.type)) {
@@ -190,6 +242,37 @@ export class WsService implements OnDestroy {
     }
   }
 
+  // assemble keeps the pieces of a chunked message until the last one shows up, which gets the whole yaml
+  private assemble(message: WsMessage): WsMessage {
+    const chunk = message.chunk;
+    const pieces = this.chunks.get(chunk.id) || [];
+    pieces.push(message.yaml);
+    this.chunks.set(chunk.id, pieces);
+
+    if (chunk.index < chunk.count - 1) {
+      const receiver = this.receiverFor(message);
+      if (receiver !== undefined && receiver.progress !== undefined) {
+        const received = pieces.reduce((sum, piece) => sum + piece.length, 0);
+        receiver.progress(message, received, chunk.size);
+      }
+      return null;
+    }
+
+    this.chunks.delete(chunk.id);
+    message.yaml = pieces.join('');
+    message.chunk = undefined;
+    return message;
+  }
+
+  // receiverFor finds the receiver the message would be handed to
+  private receiverFor(message: WsMessage): WsReceiver {
+    if (!this.functionMap.hasOwnProperty(message.type)) {
+      return undefined;
+    }
+    const components = this.functionMap[message.type];
+    return components.hasOwnProperty(message.component) ? components[message.component] : components.any;
+  }
+
   // websockets time out after 5 minutes of inactivity, this keeps the backend engaged so it doesn't time
   private keepAlive(): void {
     // clear the previously set timeout
@@ -0,0 +1,391 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package cbor encodes and decodes the JSON data model as CBOR (RFC 8949), the maps, arrays, strings, numbers,
+// booleans and nulls encoding/json decodes into, plus byte strings so binary data doesn't have to be base64
+package cbor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// the major types, in the top 3 bits of the first byte of every item
+const (
+	majorUint   = 0
+	majorNegInt = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+)
+
+// the simple values and floats of major type 7
+const (
+	simpleFalse   = 20
+	simpleTrue    = 21
+	simpleNull    = 22
+	simpleFloat16 = 25
+	simpleFloat32 = 26
+	simpleFloat64 = 27
+)
+
+// tagBase64 marks a byte string that's expected to be base64 encoded when it's converted to JSON
+const tagBase64 = 22
+
+// maxDepth stops a deeply nested message from using up the stack
+const maxDepth = 256
+
+var errTruncated = errors.New("cbor: unexpected end of data")
+
+// Base64 is binary data that's a base64 string in JSON, it's sent as a tagged byte string and decoded back into
+// the base64 string
+type Base64 []byte
+
+// Marshal encodes the value as CBOR.  The value can be made of nil, bool, the ints, uints and floats,
+// json.Number, string, []byte, Base64, []interface{} and map[string]interface{}.  Map keys are sorted so the
+// same value always encodes the same way
+func Marshal(v interface{}) ([]byte, error) {
+	e := &encoder{}
+	if err := e.encode(v, 0); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) head(major byte, n uint64) {
+	switch {
+	case n < 24:
+		e.buf.WriteByte(major<<5 | byte(n))
+	case n <= math.MaxUint8:
+		e.buf.WriteByte(major<<5 | 24)
+		e.buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(major<<5 | 25)
+		var b [2]byte
+		binary.BigEndian.PutUint16(b[:], uint16(n))
+		e.buf.Write(b[:])
+	case n <= math.MaxUint32:
+		e.buf.WriteByte(major<<5 | 26)
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(n))
+		e.buf.Write(b[:])
+	default:
+		e.buf.WriteByte(major<<5 | 27)
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], n)
+		e.buf.Write(b[:])
+	}
+}
+
+func (e *encoder) int(i int64) {
+	if i < 0 {
+		e.head(majorNegInt, uint64(-1-i))
+		return
+	}
+	e.head(majorUint, uint64(i))
+}
+
+func (e *encoder) float(f float64) {
+	e.buf.WriteByte(majorSimple<<5 | simpleFloat64)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], math.Float64bits(f))
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) encode(v interface{}, depth int) error {
+	if depth > maxDepth {
+		return errors.New("cbor: value nested too deeply")
+	}
+
+	switch v := v.(type) {
+	case nil:
+		e.buf.WriteByte(majorSimple<<5 | simpleNull)
+	case bool:
+		if v {
+			e.buf.WriteByte(majorSimple<<5 | simpleTrue)
+		} else {
+			e.buf.WriteByte(majorSimple<<5 | simpleFalse)
+		}
+	case int:
+		e.int(int64(v))
+	case int32:
+		e.int(int64(v))
+	case int64:
+		e.int(v)
+	case uint:
+		e.head(majorUint, uint64(v))
+	case uint32:
+		e.head(majorUint, uint64(v))
+	case uint64:
+		e.head(majorUint, v)
+	case float32:
+		e.float(float64(v))
+	case float64:
+		e.float(v)
+	case json.Number:
+		// numbers that fit an integer are sent as one
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			e.int(i)
+		} else if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			e.head(majorUint, u)
+		} else if f, err := v.Float64(); err == nil {
+			e.float(f)
+		} else {
+			return fmt.Errorf("cbor: invalid number %s", v)
+		}
+	case string:
+		e.head(majorText, uint64(len(v)))
+		e.buf.WriteString(v)
+	case []byte:
+		e.head(majorBytes, uint64(len(v)))
+		e.buf.Write(v)
+	case Base64:
+		e.head(majorTag, tagBase64)
+		e.head(majorBytes, uint64(len(v)))
+		e.buf.Write(v)
+	case []interface{}:
+		e.head(majorArray, uint64(len(v)))
+		for _, item := range v {
+			if err := e.encode(item, depth+1); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		e.head(majorMap, uint64(len(v)))
+		for _, key := range keys {
+			e.head(majorText, uint64(len(key)))
+			e.buf.WriteString(key)
+			if err := e.encode(v[key], depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cbor: unsupported type %T", v)
+	}
+
+	return nil
+}
+
+// Unmarshal decodes the CBOR into the values encoding/json would decode the same data into, integers are
+// json.Numbers so they keep their precision.  Byte strings come back as base64 strings since that's what
+// they are in JSON.  Indefinite lengths and map keys that aren't strings aren't supported
+func Unmarshal(data []byte) (interface{}, error) {
+	d := &decoder{data: data}
+	v, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(d.data) {
+		return nil, fmt.Errorf("cbor: %d bytes left over after the value", len(d.data)-d.off)
+	}
+	return v, nil
+}
+
+type decoder struct {
+	data []byte
+	off  int
+}
+
+func (d *decoder) next(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.off) {
+		return nil, errTruncated
+	}
+	b := d.data[d.off : d.off+int(n)]
+	d.off += int(n)
+	return b, nil
+}
+
+// head reads the major type and the argument that follows it, info is what was in the low 5 bits
+func (d *decoder) head() (major, info byte, n uint64, err error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = b[0]>>5, b[0]&0x1f
+
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == 24:
+		b, err = d.next(1)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		return major, info, uint64(b[0]), nil
+	case info == 25:
+		b, err = d.next(2)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		return major, info, uint64(binary.BigEndian.Uint16(b)), nil
+	case info == 26:
+		b, err = d.next(4)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		return major, info, uint64(binary.BigEndian.Uint32(b)), nil
+	case info == 27:
+		b, err = d.next(8)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		return major, info, binary.BigEndian.Uint64(b), nil
+	case info == 31:
+		return 0, 0, 0, errors.New("cbor: indefinite lengths are not supported")
+	}
+
+	return 0, 0, 0, fmt.Errorf("cbor: invalid additional information %d", info)
+}
+
+// length checks a length against what's left, so a bad one can't make a huge allocation
+func (d *decoder) length(n uint64) (int, error) {
+	if n > uint64(len(d.data)-d.off) {
+		return 0, errTruncated
+	}
+	return int(n), nil
+}
+
+func (d *decoder) decode(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errors.New("cbor: value nested too deeply")
+	}
+
+	major, info, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case majorUint:
+		return json.Number(strconv.FormatUint(n, 10)), nil
+	case majorNegInt:
+		if n > math.MaxInt64 {
+			return nil, errors.New("cbor: negative integer out of range")
+		}
+		return json.Number(strconv.FormatInt(-1-int64(n), 10)), nil
+	case majorBytes:
+		b, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(b), nil
+	case majorText:
+		b, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case majorArray:
+		// every item takes at least a byte
+		length, err := d.length(n)
+		if err != nil {
+			return nil, err
+		}
+		items := make([]interface{}, 0, length)
+		for i := 0; i < length; i++ {
+			item, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case majorMap:
+		length, err := d.length(n)
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, length)
+		for i := 0; i < length; i++ {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("cbor: map key %v is not a string", key)
+			}
+			if m[k], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case majorTag:
+		// the base64 tag is what the byte strings turn into anyway, other tags are skipped over
+		return d.decode(depth + 1)
+	}
+
+	switch info {
+	case simpleFalse:
+		return false, nil
+	case simpleTrue:
+		return true, nil
+	case simpleNull, simpleNull + 1:
+		// undefined is as close to null as JSON gets
+		return nil, nil
+	case simpleFloat16:
+		return float16(uint16(n)), nil
+	case simpleFloat32:
+		return float64(math.Float32frombits(uint32(n))), nil
+	case simpleFloat64:
+		return math.Float64frombits(n), nil
+	}
+
+	return nil, fmt.Errorf("cbor: unsupported simple value %d", n)
+}
+
+// float16 widens a half precision float
+func float16(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
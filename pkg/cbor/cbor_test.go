@@ -0,0 +1,152 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cbor_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"opendev.org/airship/airshipui/pkg/cbor"
+)
+
+func TestMarshal(t *testing.T) {
+	// the expected encodings are from the examples in appendix A of RFC 8949
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{value: 0, expected: "00"},
+		{value: 23, expected: "17"},
+		{value: 24, expected: "1818"},
+		{value: 1000, expected: "1903e8"},
+		{value: 1000000, expected: "1a000f4240"},
+		{value: uint64(18446744073709551615), expected: "1bffffffffffffffff"},
+		{value: -1, expected: "20"},
+		{value: -1000, expected: "3903e7"},
+		{value: json.Number("100"), expected: "1864"},
+		{value: json.Number("18446744073709551615"), expected: "1bffffffffffffffff"},
+		{value: 1.1, expected: "fb3ff199999999999a"},
+		{value: json.Number("1.1"), expected: "fb3ff199999999999a"},
+		{value: false, expected: "f4"},
+		{value: true, expected: "f5"},
+		{value: nil, expected: "f6"},
+		{value: "", expected: "60"},
+		{value: "IETF", expected: "6449455446"},
+		{value: "ü", expected: "62c3bc"},
+		{value: []byte{1, 2, 3, 4}, expected: "4401020304"},
+		{value: cbor.Base64{1, 2, 3, 4}, expected: "d64401020304"},
+		{value: []interface{}{}, expected: "80"},
+		{value: []interface{}{1, []interface{}{2, 3}}, expected: "8201820203"},
+		{value: map[string]interface{}{}, expected: "a0"},
+		{value: map[string]interface{}{"b": []interface{}{2, 3}, "a": 1}, expected: "a26161016162820203"},
+	}
+
+	for _, tt := range tests {
+		b, err := cbor.Marshal(tt.value)
+		require.NoError(t, err, tt.value)
+		assert.Equal(t, tt.expected, hex.EncodeToString(b), tt.value)
+	}
+
+	_, err := cbor.Marshal(struct{}{})
+	assert.Error(t, err)
+}
+
+func TestUnmarshal(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected interface{}
+	}{
+		{data: "00", expected: json.Number("0")},
+		{data: "1bffffffffffffffff", expected: json.Number("18446744073709551615")},
+		{data: "3903e7", expected: json.Number("-1000")},
+		{data: "f93c00", expected: 1.0},
+		{data: "f97bff", expected: 65504.0},
+		{data: "f90001", expected: 5.960464477539063e-08},
+		{data: "f9c400", expected: -4.0},
+		{data: "fa47c35000", expected: 100000.0},
+		{data: "fb3ff199999999999a", expected: 1.1},
+		{data: "f4", expected: false},
+		{data: "f5", expected: true},
+		{data: "f6", expected: nil},
+		{data: "f7", expected: nil},
+		{data: "6449455446", expected: "IETF"},
+		{data: "4401020304", expected: "AQIDBA=="},
+		{data: "d64401020304", expected: "AQIDBA=="},
+		{data: "8201820203", expected: []interface{}{json.Number("1"), []interface{}{json.Number("2"), json.Number("3")}}},
+		{data: "a26161016162820203", expected: map[string]interface{}{
+			"a": json.Number("1"),
+			"b": []interface{}{json.Number("2"), json.Number("3")},
+		}},
+	}
+
+	for _, tt := range tests {
+		b, err := hex.DecodeString(tt.data)
+		require.NoError(t, err)
+		v, err := cbor.Unmarshal(b)
+		require.NoError(t, err, tt.data)
+		assert.Equal(t, tt.expected, v, tt.data)
+	}
+
+	v, err := cbor.Unmarshal([]byte{0xf9, 0x7c, 0x00})
+	require.NoError(t, err)
+	assert.True(t, math.IsInf(v.(float64), 1))
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	tests := []string{
+		"",                   // nothing
+		"19",                 // missing the argument
+		"6449",               // short text
+		"9bffffffffffffffff", // a length longer than the data
+		"a10102",             // a key that isn't a string
+		"5f",                 // indefinite length
+		"0000",               // more than one value
+		"1c",                 // reserved additional information
+	}
+
+	for _, tt := range tests {
+		b, err := hex.DecodeString(tt)
+		require.NoError(t, err)
+		_, err = cbor.Unmarshal(b)
+		assert.Error(t, err, tt)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	message := `{"type":"ctl","component":"phase","sequence":42,"data":{"ratio":0.5,"nested":[true,null,"x"],` +
+		`"big":9007199254740993}}`
+
+	var value interface{}
+	d := json.NewDecoder(strings.NewReader(message))
+	d.UseNumber()
+	require.NoError(t, d.Decode(&value))
+
+	b, err := cbor.Marshal(value)
+	require.NoError(t, err)
+	assert.Less(t, len(b), len(message))
+
+	decoded, err := cbor.Unmarshal(b)
+	require.NoError(t, err)
+
+	j, err := json.Marshal(decoded)
+	require.NoError(t, err)
+	assert.JSONEq(t, message, string(j))
+}
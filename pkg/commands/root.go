@@ -15,19 +15,30 @@
 package commands
 
 import (
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"opendev.org/airship/airshipui/pkg/configs"
 	"opendev.org/airship/airshipui/pkg/ctl"
 	"opendev.org/airship/airshipui/pkg/log"
+	"opendev.org/airship/airshipui/pkg/plugin"
 	"opendev.org/airship/airshipui/pkg/statistics"
+	"opendev.org/airship/airshipui/pkg/tracing"
 	"opendev.org/airship/airshipui/pkg/webservice"
 )
 
+var (
+	// gracePeriod is how long running requests get to finish when the webservice is shutting down
+	gracePeriod time.Duration
+	// logFormat is the format the logs are written in, text or json
+	logFormat string
+)
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:     "airshipui",
@@ -40,8 +51,14 @@ func init() {
 	// Add a 'version' command, in addition to the '--version' option that is auto created
 	rootCmd.AddCommand(newVersionCmd())
 
-	// Add the config file Flag
-	rootCmd.Flags().StringVarP(
+	// Add a 'stats' command to work with the statistics database outside of the UI
+	rootCmd.AddCommand(newStatsCmd())
+
+	// Add a 'schema' command to print the websocket message schemas
+	rootCmd.AddCommand(newSchemaCmd())
+
+	// Add the config file Flag, the subcommands need it too
+	rootCmd.PersistentFlags().StringVarP(
 		&configs.UIConfigFile,
 		"conf",
 		"c",
@@ -49,11 +66,19 @@ func init() {
 		"This will set the location of the conf file needed to start the UI",
 	)
 
+	// Add the shutdown grace period flag
+	rootCmd.Flags().DurationVar(
+		&gracePeriod,
+		"grace-period",
+		30*time.Second,
+		"This will set how long running requests and tasks are given to finish when the UI is shut down",
+	)
+
 	// Add the logging level flag
 	rootCmd.Flags().IntVar(
 		&log.LogLevel,
 		"loglevel",
-		6,
+		4,
 		"This will set the log level, anything at or below that level will be viewed, all others suppressed\n"+
 			"  6 -- Trace\n"+
 			"  5 -- Debug\n"+
@@ -62,6 +87,14 @@ func init() {
 			"  2 -- Error\n"+
 			"  1 -- Fatal\n",
 	)
+
+	// Add the logging format flag
+	rootCmd.Flags().StringVar(
+		&logFormat,
+		"log-format",
+		log.TextFormat,
+		"This will set the format of the logs, text or json",
+	)
 }
 
 func launch(cmd *cobra.Command, args []string) {
@@ -70,22 +103,91 @@ func launch(cmd *cobra.Command, args []string) {
 		log.Fatalf("config %s", err)
 	}
 
+	// the flags win over the config when they're set
+	if err := configureLogging(cmd); err != nil {
+		log.Fatalf("logging %s", err)
+	}
+
 	// Start the statistics database
 	statistics.Init()
 
+	// Start exporting traces if there's an exporter in the config
+	if err := tracing.Init(); err != nil {
+		log.Fatalf("tracing %s", err)
+	}
+
 	// allows for the circular reference to the webservice package to be broken and allow for the sending
 	// of arbitrary messages from any package to the websocket
 	ctl.Init()
 
+	// start the plugins in the plugin directory and add the components they serve
+	if err := plugin.Init(); err != nil {
+		log.Fatalf("plugins %s", err)
+	}
+
 	// start webservice and listen for the the ctl + c to exit
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-c
-		log.Info("Exiting the webservice")
-		os.Exit(0)
-	}()
-	webservice.WebServer()
+	go webservice.WebServer()
+
+	<-c
+	log.Info("Exiting the webservice")
+	webservice.Shutdown(gracePeriod)
+	plugin.Shutdown()
+
+	if err := log.CloseFile(); err != nil {
+		log.Error(err)
+	}
+}
+
+// configureLogging applies the logging config, the flags take precedence when they're given
+func configureLogging(cmd *cobra.Command) error {
+	level, _ := log.Levels()
+	format := logFormat
+	var levels map[string]int
+
+	if conf := configs.UIConfig.Logging; conf != nil {
+		if conf.Level != 0 && !cmd.Flags().Changed("loglevel") {
+			level = conf.Level
+		}
+		if conf.Format != "" && !cmd.Flags().Changed("log-format") {
+			format = conf.Format
+		}
+		levels = conf.Levels
+
+		if conf.File != nil {
+			if err := setLogFile(conf.File); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := log.SetFormat(format); err != nil {
+		return err
+	}
+
+	return log.SetLevels(level, levels)
+}
+
+// setLogFile sends the logs to the file in the config
+func setLogFile(conf *configs.LogFile) error {
+	opts := log.FileOptions{
+		Path:       conf.Path,
+		MaxSize:    conf.MaxSize,
+		MaxBackups: conf.MaxBackups,
+		MaxAge:     conf.MaxAge,
+		Compress:   conf.Compress,
+	}
+
+	if conf.RotateEvery != "" {
+		interval, err := time.ParseDuration(conf.RotateEvery)
+		if err != nil {
+			return fmt.Errorf("log file rotateEvery: %s", err)
+		}
+		opts.RotateEvery = interval
+	}
+
+	return log.SetFile(opts)
 }
 
 // Execute is called from the main program and kicks this whole shindig off
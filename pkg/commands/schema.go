@@ -0,0 +1,91 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/ctl"
+	"opendev.org/airship/airshipui/pkg/schema"
+)
+
+func newSchemaCmd() *cobra.Command {
+	var output string
+	schemaCmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON schemas of the websocket messages",
+		Long: "Print the JSON schemas of the websocket messages the UI takes, " +
+			"the same documents the UI serves on /schema.\n" +
+			"With --output each message gets its own file in the directory, " +
+			"named after its type, component and subcomponent",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// the ctl messages are registered when it's initialized
+			ctl.Init()
+			return writeSchemas(cmd.OutOrStdout(), output)
+		},
+	}
+
+	schemaCmd.Flags().StringVarP(&output, "output", "o", "", "The directory to write the schemas to, defaults to stdout")
+	return schemaCmd
+}
+
+func writeSchemas(out io.Writer, dir string) error {
+	documents := schema.Documents()
+
+	if dir == "" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			ProtocolVersion int                       `json:"protocolVersion"`
+			Messages        map[string]*schema.Schema `json:"messages"`
+		}{configs.ProtocolVersion, documents})
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(documents))
+	for key := range documents {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		b, err := json.MarshalIndent(documents[key], "", "  ")
+		if err != nil {
+			return err
+		}
+
+		name := filepath.Join(dir, strings.ReplaceAll(key, "/", ".")+".json")
+		if err = ioutil.WriteFile(name, append(b, '\n'), 0644); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, name)
+	}
+
+	return nil
+}
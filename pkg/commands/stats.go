@@ -0,0 +1,154 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/statistics"
+)
+
+// exportOptions are the flags of the stats export command
+type exportOptions struct {
+	format       string
+	output       string
+	notBefore    string
+	notAfter     string
+	user         string
+	component    string
+	subComponent string
+	target       string
+	success      string
+}
+
+func newStatsCmd() *cobra.Command {
+	statsCmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Work with the statistics and audit history",
+	}
+
+	statsCmd.AddCommand(newStatsExportCmd())
+	return statsCmd
+}
+
+func newStatsExportCmd() *cobra.Command {
+	opts := &exportOptions{}
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the statistics and audit history",
+		Long: "Export the statistics and audit history as csv or ndjson, the UI does not need to be running.\n" +
+			"The history can be filtered the same way it can be in the UI",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exportStats(cmd.OutOrStdout(), opts)
+		},
+	}
+
+	flags := exportCmd.Flags()
+	flags.StringVar(&opts.format, "format", statistics.CSV, "The format of the export, csv or ndjson")
+	flags.StringVarP(&opts.output, "output", "o", "", "The file to write the export to, defaults to stdout")
+	flags.StringVar(&opts.notBefore, "not-before", "", "Only export records started at or after this RFC 3339 time")
+	flags.StringVar(&opts.notAfter, "not-after", "", "Only export records started at or before this RFC 3339 time")
+	flags.StringVar(&opts.user, "user", "", "Only export records for this user")
+	flags.StringVar(&opts.component, "component", "", "Only export records for this component")
+	flags.StringVar(&opts.subComponent, "subcomponent", "", "Only export records for this subcomponent")
+	flags.StringVar(&opts.target, "target", "", "Only export records for this target")
+	flags.StringVar(&opts.success, "success", "", "Only export records that succeeded (true) or failed (false)")
+
+	return exportCmd
+}
+
+func exportStats(out io.Writer, opts *exportOptions) error {
+	query, err := opts.query()
+	if err != nil {
+		return err
+	}
+
+	if err = configs.SetUIConfig(); err != nil {
+		return fmt.Errorf("config %s", err)
+	}
+
+	store, err := statistics.OpenReadOnly()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if opts.output != "" {
+		f, err := os.Create(opts.output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	_, err = statistics.Export(out, store, query, opts.format)
+	return err
+}
+
+// query turns the flags into the history query
+func (opts *exportOptions) query() (statistics.Query, error) {
+	query := statistics.Query{}
+
+	millis := func(name, value string) (*int64, error) {
+		if value == "" {
+			return nil, nil
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %s, expected an RFC 3339 time", name, value)
+		}
+		ms := t.UnixNano() / 1000000
+		return &ms, nil
+	}
+
+	optional := func(value string) *string {
+		if value == "" {
+			return nil
+		}
+		return &value
+	}
+
+	var err error
+	if query.NotBefore, err = millis("not-before", opts.notBefore); err != nil {
+		return query, err
+	}
+	if query.NotAfter, err = millis("not-after", opts.notAfter); err != nil {
+		return query, err
+	}
+
+	query.User = optional(opts.user)
+	query.Component = optional(opts.component)
+	query.SubComponent = optional(opts.subComponent)
+	query.Target = optional(opts.target)
+
+	if opts.success != "" {
+		success, err := strconv.ParseBool(opts.success)
+		if err != nil {
+			return query, fmt.Errorf("invalid success %s", opts.success)
+		}
+		query.Success = &success
+	}
+
+	return query, nil
+}
@@ -21,6 +21,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"fmt"
 	"io/ioutil"
 	"math/big"
 	"time"
@@ -97,21 +98,49 @@ func generateCSR() x509.Certificate {
 
 // TestCertValidity will check if the cert defined in the conf is not past its not after date
 func TestCertValidity(pemFile string) error {
-	r, err := ioutil.ReadFile(pemFile)
+	notAfter, err := CertExpiry(pemFile)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	block, _ := pem.Decode(r)
-	_, err = x509.ParseCertificate(block.Bytes)
-	if err != nil {
+	// calculate the validity of the cert
+	if time.Now().After(notAfter) {
+		err = fmt.Errorf("certificate %s expired on %s", pemFile, notAfter.Format(time.RFC3339))
 		log.Error(err)
 		return err
 	}
 
-	// calculate the validity of the cert
-	// TODO: Add a cert check for time based validity here
-	// fmt.Println(cert.NotAfter)
 	return nil
 }
+
+// CertExpiry returns the not after date of the cert, if the file is a chain the earliest date is returned
+func CertExpiry(pemFile string) (time.Time, error) {
+	var notAfter time.Time
+
+	r, err := ioutil.ReadFile(pemFile)
+	if err != nil {
+		return notAfter, err
+	}
+
+	for block, rest := pem.Decode(r); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != publicKeyType {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return notAfter, err
+		}
+
+		if notAfter.IsZero() || cert.NotAfter.Before(notAfter) {
+			notAfter = cert.NotAfter
+		}
+	}
+
+	if notAfter.IsZero() {
+		return notAfter, fmt.Errorf("no certificate found in %s", pemFile)
+	}
+
+	return notAfter, nil
+}
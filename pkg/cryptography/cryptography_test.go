@@ -15,8 +15,13 @@
 package cryptography
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -43,4 +48,19 @@ func TestTestCertValidity(t *testing.T) {
 	cert, err := GeneratePublicKey(privateKey)
 	require.NoError(t, err)
 	require.NotNil(t, cert)
+
+	dir, err := ioutil.TempDir("", "airshipui-cert")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pemFile := filepath.Join(dir, "cert.pem")
+	require.NoError(t, ioutil.WriteFile(pemFile, cert, 0600))
+	require.NoError(t, TestCertValidity(pemFile))
+
+	notAfter, err := CertExpiry(pemFile)
+	require.NoError(t, err)
+	assert.True(t, notAfter.After(time.Now().AddDate(0, 11, 0)))
+
+	_, err = CertExpiry(filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
 }
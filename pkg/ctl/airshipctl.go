@@ -15,6 +15,7 @@
 package ctl
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -22,7 +23,9 @@ import (
 	"opendev.org/airship/airshipctl/pkg/log"
 	"opendev.org/airship/airshipui/pkg/configs"
 	uiLog "opendev.org/airship/airshipui/pkg/log"
+	"opendev.org/airship/airshipui/pkg/schema"
 	"opendev.org/airship/airshipui/pkg/statistics"
+	"opendev.org/airship/airshipui/pkg/tracing"
 	"opendev.org/airship/airshipui/pkg/webservice"
 )
 
@@ -41,6 +44,7 @@ var CTLFunctionMap = map[configs.WsComponentType]func(*string, configs.WsMessage
 	configs.Image:     HandleImageRequest,
 	configs.Phase:     HandlePhaseRequest,
 	configs.Secret:    HandleSecretRequest,
+	configs.Stream:    HandleStreamRequest,
 }
 
 // maintain the state of a potentially long running process
@@ -51,6 +55,8 @@ var runningRequests map[configs.WsSubComponentType]bool = make(map[configs.WsSub
 type Client struct {
 	Config *config.Config
 	Debug  bool // this is a placeholder until I figure out how / where to set this in airshipctl
+	// the trace of the request the client was created for
+	trace context.Context
 }
 
 // LogInterceptor is just a struct to hold a pointer to the remote channel
@@ -62,6 +68,10 @@ type LogInterceptor struct {
 // of arbitrary messages from any package to the websocket
 func Init() {
 	webservice.AppendToFunctionMap(configs.CTL, CTLFunctionMap)
+	webservice.AppendToHandlerMap(artifactRoute, downloadArtifact)
+	webservice.AppendToHandlerMap(historyExportRoute, downloadHistory)
+	webservice.AppendToReadyChecks("airshipConfig", checkAirshipConfig)
+	schema.Register(append(ctlMessages(), ctlRequests()...)...)
 }
 
 func configFileExists(airshipConfigPath *string) bool {
@@ -77,6 +87,12 @@ func configFileExists(airshipConfigPath *string) bool {
 	return !info.IsDir()
 }
 
+// checkAirshipConfig makes sure the airship config can be loaded for the health checks
+func checkAirshipConfig() error {
+	_, err := NewDefaultClient(configs.UIConfig.AirshipConfigPath)
+	return err
+}
+
 // NewDefaultClient initializes the airshipctl client for external usage with default logging.
 func NewDefaultClient(airshipConfigPath *string) (*Client, error) {
 	if !configFileExists(airshipConfigPath) {
@@ -105,10 +121,15 @@ func NewDefaultClient(airshipConfigPath *string) (*Client, error) {
 
 // NewClient initializes the airshipctl client for external usage with the logging overridden.
 func NewClient(airshipConfigPath *string, request configs.WsMessage) (*Client, error) {
+	_, span := tracing.StartSpan(tracing.FromMessage(request), "NewClient")
+	defer span.End()
+
 	client, err := NewDefaultClient(airshipConfigPath)
 	if err != nil {
+		tracing.RecordError(span, err)
 		return nil, err
 	}
+	client.trace = tracing.FromMessage(request)
 
 	// init the interceptor to send messages to the UI
 	// TODO: Unsure how this will be handled with overlapping runs
@@ -125,6 +146,7 @@ func NewLogInterceptor(request configs.WsMessage) *LogInterceptor {
 		Type:      configs.UI,
 		Component: configs.Log,
 		SessionID: request.SessionID,
+		RequestID: request.RequestID,
 	}
 
 	return &LogInterceptor{
@@ -146,13 +168,13 @@ func (cw *LogInterceptor) Write(data []byte) (n int, err error) {
 	return len(data), nil
 }
 
-// errorHelper formats & sends errors for the ctl components
-func errorHelper(err error, transaction *statistics.Transaction, response configs.WsMessage) {
+// errorHelper formats & sends errors for the ctl components, they're published on the topics if there are any
+func errorHelper(err error, transaction *statistics.Transaction, response configs.WsMessage, topics ...string) {
 	uiLog.Error(err)
 	e := err.Error()
 	response.Error = &e
 	transaction.Complete(false)
-	err = webservice.WebSocketSend(response)
+	err = webservice.Publish(response, topics...)
 	if err != nil {
 		uiLog.Error(err)
 	}
@@ -22,9 +22,12 @@ import (
 
 	"opendev.org/airship/airshipui/pkg/configs"
 	"opendev.org/airship/airshipui/pkg/log"
+	"opendev.org/airship/airshipui/pkg/metrics"
 	"opendev.org/airship/airshipui/pkg/statistics"
+	"opendev.org/airship/airshipui/pkg/tracing"
 	"opendev.org/airship/airshipui/pkg/webservice"
 
+	"go.opentelemetry.io/otel/attribute"
 	"opendev.org/airship/airshipctl/pkg/remote"
 )
 
@@ -175,10 +178,11 @@ func doAction(user *string, request configs.WsMessage) error {
 	defaultPhase := "bootstrap"
 	if request.Targets != nil {
 		for _, target := range *request.Targets {
+			// the actions run past the request, so hold up the shutdown until they're done
 			if *actionType == configs.DirectAction {
-				go actionHelper(user, target, defaultPhase, request)
+				go actionHelper(user, target, defaultPhase, request, webservice.TrackWork())
 			} else {
-				go actionHelper(user, "", target, request)
+				go actionHelper(user, "", target, request, webservice.TrackWork())
 			}
 		}
 	}
@@ -186,7 +190,9 @@ func doAction(user *string, request configs.WsMessage) error {
 	return nil
 }
 
-func actionHelper(user *string, target string, phase string, request configs.WsMessage) {
+func actionHelper(user *string, target string, phase string, request configs.WsMessage, done func()) {
+	defer done()
+
 	response := configs.WsMessage{
 		Type:         configs.CTL,
 		Component:    configs.Baremetal,
@@ -194,14 +200,29 @@ func actionHelper(user *string, target string, phase string, request configs.WsM
 		SessionID:    request.SessionID,
 		ActionType:   request.ActionType,
 		Target:       &target,
+		RequestID:    request.RequestID,
+		Traceparent:  request.Traceparent,
+		Tracestate:   request.Tracestate,
+	}
+
+	// the result is also published for anyone else watching the node
+	var topics []string
+	if target != "" {
+		topics = append(topics, webservice.NodeTopic(target))
 	}
 
 	// create a transaction for this singular request
 	transaction := statistics.NewTransaction(user, response)
 
+	// record the outcome of the action however it ends
+	succeeded := false
+	defer func() {
+		metrics.ObserveBaremetalAction(string(request.SubComponent), succeeded)
+	}()
+
 	client, err := NewClient(configs.UIConfig.AirshipConfigPath, response)
 	if err != nil {
-		errorHelper(err, transaction, response)
+		errorHelper(err, transaction, response, topics...)
 		return
 	}
 
@@ -213,7 +234,7 @@ func actionHelper(user *string, target string, phase string, request configs.WsM
 	}
 	m, err := remote.NewManager(client.Config, phase, selectors...)
 	if err != nil {
-		errorHelper(err, transaction, response)
+		errorHelper(err, transaction, response, topics...)
 		return
 	}
 
@@ -223,7 +244,7 @@ func actionHelper(user *string, target string, phase string, request configs.WsM
 		log.Error(&e)
 		response.Error = &e
 		transaction.Complete(false)
-		err = webservice.WebSocketSend(response)
+		err = webservice.Publish(response, topics...)
 		if err != nil {
 			log.Error(err)
 		}
@@ -234,6 +255,9 @@ func actionHelper(user *string, target string, phase string, request configs.WsM
 
 	ctx := context.Background()
 
+	_, span := tracing.StartSpan(tracing.FromMessage(request), fmt.Sprintf("remote %s", action),
+		attribute.String("target", target), attribute.String("phase", phase))
+
 	switch action {
 	case configs.EjectMedia:
 		err = host.EjectVirtualMedia(ctx)
@@ -244,16 +268,19 @@ func actionHelper(user *string, target string, phase string, request configs.WsM
 	case configs.Reboot:
 		err = host.RebootSystem(ctx)
 	}
+	tracing.RecordError(span, err)
+	span.End()
 
 	if err != nil {
-		errorHelper(err, transaction, response)
+		errorHelper(err, transaction, response, topics...)
 		return
 	}
 
 	s := fmt.Sprintf("%s on %s completed successfully", action, target)
 	response.Message = &s
+	succeeded = true
 	transaction.Complete(true)
-	err = webservice.WebSocketSend(response)
+	err = webservice.Publish(response, topics...)
 	if err != nil {
 		log.Error(err)
 	}
@@ -16,10 +16,58 @@ package ctl
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	"opendev.org/airship/airshipui/pkg/configs"
 )
 
+const (
+	// label prefix used by kubeadm to denote the role(s) of a node
+	nodeRolePrefix = "node-role.kubernetes.io/"
+)
+
+var (
+	// Cluster API resources reported in the cluster status
+	capiClusters = schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1alpha3", Resource: "clusters"}
+	capiMachines = schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1alpha3", Resource: "machines"}
+)
+
+// clusterStatus is the health overview of the cluster defined by the current airship context
+type clusterStatus struct {
+	Context  string          `json:"context,omitempty"`
+	Version  string          `json:"version,omitempty"`
+	Nodes    []nodeStatus    `json:"nodes"`
+	Clusters []clusterObject `json:"clusters"`
+	Machines []clusterObject `json:"machines"`
+}
+
+// nodeStatus is the readiness of a single kubernetes node
+type nodeStatus struct {
+	Name           string   `json:"name"`
+	Ready          bool     `json:"ready"`
+	Roles          []string `json:"roles,omitempty"`
+	KubeletVersion string   `json:"kubeletVersion,omitempty"`
+	Message        string   `json:"message,omitempty"`
+}
+
+// clusterObject is the status of a Cluster API Cluster or Machine object
+type clusterObject struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Phase     string `json:"phase,omitempty"`
+	Ready     bool   `json:"ready"`
+	Version   string `json:"version,omitempty"`
+	NodeName  string `json:"nodeName,omitempty"`
+}
+
 // HandleClusterRequest will flop between requests so we don't have to have them all mapped as function calls
 // This will wait for the sub component to complete before responding.  The assumption is this is an async request
 func HandleClusterRequest(user *string, request configs.WsMessage) configs.WsMessage {
@@ -41,7 +89,7 @@ func HandleClusterRequest(user *string, request configs.WsMessage) configs.WsMes
 	case configs.Move:
 		err = fmt.Errorf("Subcomponent %s deprecated", request.SubComponent)
 	case configs.Status:
-		err = fmt.Errorf("Subcomponent %s not implemented", request.SubComponent)
+		response.Data, err = getClusterStatus(request)
 	default:
 		err = fmt.Errorf("Subcomponent %s not found", request.SubComponent)
 	}
@@ -55,3 +103,129 @@ func HandleClusterRequest(user *string, request configs.WsMessage) configs.WsMes
 
 	return response
 }
+
+// getClusterStatus reports the status of the cluster defined by the kubeconfig of the current airship context
+func getClusterStatus(request configs.WsMessage) (*clusterStatus, error) {
+	client, err := NewClient(configs.UIConfig.AirshipConfigPath, request)
+	if err != nil {
+		return nil, err
+	}
+
+	clientSet, dynamicClient, err := client.kubeClients()
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := newClusterStatus(clientSet, dynamicClient)
+	if err != nil {
+		return nil, err
+	}
+
+	status.Context = client.Config.CurrentContext
+	return status, nil
+}
+
+// newClusterStatus gathers the nodes, control plane version and Cluster API objects from the cluster
+func newClusterStatus(clientSet kubernetes.Interface, dynamicClient dynamic.Interface) (*clusterStatus, error) {
+	version, err := clientSet.Discovery().ServerVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := getNodeStatus(clientSet)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters, err := getClusterObjects(dynamicClient, capiClusters)
+	if err != nil {
+		return nil, err
+	}
+
+	machines, err := getClusterObjects(dynamicClient, capiMachines)
+	if err != nil {
+		return nil, err
+	}
+
+	return &clusterStatus{
+		Version:  version.GitVersion,
+		Nodes:    nodes,
+		Clusters: clusters,
+		Machines: machines,
+	}, nil
+}
+
+// getNodeStatus returns the readiness of all nodes in the cluster
+func getNodeStatus(clientSet kubernetes.Interface) ([]nodeStatus, error) {
+	nodes, err := clientSet.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	data := []nodeStatus{}
+	for _, node := range nodes.Items {
+		status := nodeStatus{
+			Name:           node.Name,
+			KubeletVersion: node.Status.NodeInfo.KubeletVersion,
+		}
+
+		for label := range node.Labels {
+			if strings.HasPrefix(label, nodeRolePrefix) {
+				status.Roles = append(status.Roles, strings.TrimPrefix(label, nodeRolePrefix))
+			}
+		}
+		sort.Strings(status.Roles)
+
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == corev1.NodeReady {
+				status.Ready = condition.Status == corev1.ConditionTrue
+				status.Message = condition.Message
+			}
+		}
+
+		data = append(data, status)
+	}
+
+	return data, nil
+}
+
+// getClusterObjects returns the status of the Cluster API objects of the requested resource in all namespaces
+// A cluster without Cluster API installed simply has none of them
+func getClusterObjects(dynamicClient dynamic.Interface, gvr schema.GroupVersionResource) ([]clusterObject, error) {
+	data := []clusterObject{}
+
+	list, err := dynamicClient.Resource(gvr).List(metav1.ListOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return data, nil
+		}
+		return nil, err
+	}
+
+	for _, item := range list.Items {
+		object := clusterObject{
+			Name:      item.GetName(),
+			Namespace: item.GetNamespace(),
+		}
+
+		object.Phase, _, _ = unstructured.NestedString(item.Object, "status", "phase")
+		object.Version, _, _ = unstructured.NestedString(item.Object, "spec", "version")
+		object.NodeName, _, _ = unstructured.NestedString(item.Object, "status", "nodeRef", "name")
+
+		switch gvr {
+		case capiClusters:
+			// a cluster is only usable when both its infrastructure and control plane are up
+			infraReady, _, _ := unstructured.NestedBool(item.Object, "status", "infrastructureReady")
+			controlPlaneReady, _, _ := unstructured.NestedBool(item.Object, "status", "controlPlaneReady")
+			object.Ready = infraReady && controlPlaneReady
+		default:
+			// a machine is only usable once its infrastructure is up and it has joined the cluster as a node
+			infraReady, _, _ := unstructured.NestedBool(item.Object, "status", "infrastructureReady")
+			object.Ready = infraReady && object.NodeName != ""
+		}
+
+		data = append(data, object)
+	}
+
+	return data, nil
+}
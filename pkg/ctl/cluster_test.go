@@ -0,0 +1,116 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package ctl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"opendev.org/airship/airshipui/pkg/configs"
+)
+
+func TestHandleUnknownClusterSubComponent(t *testing.T) {
+	request := configs.WsMessage{
+		Type:         configs.CTL,
+		Component:    configs.Cluster,
+		SubComponent: "fake_subcomponent",
+	}
+
+	user := "test"
+	response := HandleClusterRequest(&user, request)
+
+	e := "Subcomponent fake_subcomponent not found"
+	expected := configs.WsMessage{
+		Type:         configs.CTL,
+		Component:    configs.Cluster,
+		SubComponent: "fake_subcomponent",
+		Error:        &e,
+	}
+
+	assert.Equal(t, expected, response)
+}
+
+func TestNewClusterStatus(t *testing.T) {
+	clientSet := fake.NewSimpleClientset(
+		testNode("master-0", corev1.ConditionTrue, map[string]string{nodeRolePrefix + "master": ""}),
+		testNode("worker-0", corev1.ConditionFalse, nil),
+	)
+	clientSet.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.18.6"}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		testClusterObject("Cluster", "target-cluster", map[string]interface{}{
+			"phase":               "Provisioned",
+			"infrastructureReady": true,
+			"controlPlaneReady":   true,
+		}),
+		testClusterObject("Machine", "target-cluster-md-0", map[string]interface{}{
+			"phase":               "Provisioning",
+			"infrastructureReady": false,
+		}),
+	)
+
+	status, err := newClusterStatus(clientSet, dynamicClient)
+	require.NoError(t, err)
+
+	assert.Equal(t, "v1.18.6", status.Version)
+	assert.ElementsMatch(t, []nodeStatus{
+		{Name: "master-0", Ready: true, Roles: []string{"master"}, KubeletVersion: "v1.18.6"},
+		{Name: "worker-0", Ready: false, KubeletVersion: "v1.18.6"},
+	}, status.Nodes)
+	assert.Equal(t, []clusterObject{
+		{Name: "target-cluster", Namespace: "default", Phase: "Provisioned", Ready: true},
+	}, status.Clusters)
+	assert.Equal(t, []clusterObject{
+		{Name: "target-cluster-md-0", Namespace: "default", Phase: "Provisioning", Ready: false},
+	}, status.Machines)
+}
+
+func testNode(name string, ready corev1.ConditionStatus, labels map[string]string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Status: corev1.NodeStatus{
+			NodeInfo: corev1.NodeSystemInfo{KubeletVersion: "v1.18.6"},
+			Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: ready},
+			},
+		},
+	}
+}
+
+func testClusterObject(kind, name string, status map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "cluster.x-k8s.io/v1alpha3",
+			"kind":       kind,
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": "default",
+			},
+			"status": status,
+		},
+	}
+}
@@ -15,13 +15,66 @@
 package ctl
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 
+	"github.com/pmezard/go-difflib/difflib"
+	"go.opentelemetry.io/otel/attribute"
 	"opendev.org/airship/airshipctl/pkg/config"
+	"opendev.org/airship/airshipctl/pkg/document"
+	docplugin "opendev.org/airship/airshipctl/pkg/document/plugin"
 	"opendev.org/airship/airshipctl/pkg/document/pull"
+	"opendev.org/airship/airshipctl/pkg/phase"
+	"opendev.org/airship/airshipctl/pkg/phase/ifc"
 	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/tracing"
 )
 
+// how a document came out of a plugin run
+const (
+	documentAdded     = "added"
+	documentRemoved   = "removed"
+	documentChanged   = "changed"
+	documentUnchanged = "unchanged"
+)
+
+// PluginRun is the data of a document plugin request, the id of the request is the phase.  The plugin config
+// is the YAML of the request or one of the documents picked with getDocumentsBySelector.  The plugin runs
+// against the picked documents, or the whole bundle of the phase when none are picked, and its output is only
+// written to disk, as a file of the phase's document root, when there's an output file name.  A file that's
+// already there is only replaced when overwrite is set
+type PluginRun struct {
+	ConfigID  string   `json:"configID,omitempty"`
+	Documents []string `json:"documents,omitempty"`
+	Output    string   `json:"output,omitempty"`
+	Overwrite bool     `json:"overwrite,omitempty"`
+}
+
+// PluginResult is what the plugin did to each of the documents it ran against, and the file the output was
+// written to if it was asked for
+type PluginResult struct {
+	Written   string         `json:"written,omitempty"`
+	Documents []DocumentDiff `json:"documents"`
+}
+
+// DocumentDiff is a unified diff of the YAML of a document before and after the plugin ran
+type DocumentDiff struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Diff   string `json:"diff,omitempty"`
+}
+
+// documentSet is the YAML of some documents by the name the UI shows them under, in the order they came in
+type documentSet struct {
+	names []string
+	yaml  map[string]string
+}
+
 // HandleDocumentRequest will flop between requests so we don't have to have them all mapped as function calls
 func HandleDocumentRequest(user *string, request configs.WsMessage) configs.WsMessage {
 	response := configs.WsMessage{
@@ -45,7 +98,10 @@ func HandleDocumentRequest(user *string, request configs.WsMessage) configs.WsMe
 	case configs.Pull:
 		message, err = client.docPull()
 	case configs.Plugin:
-		err = fmt.Errorf("Subcomponent %s not implemented", request.SubComponent)
+		s := "transformed"
+		message = &s
+		response.ID = request.ID
+		response.Name, response.YAML, response.Data, err = client.runDocumentPlugin(request)
 	default:
 		err = fmt.Errorf("Subcomponent %s not found", request.SubComponent)
 	}
@@ -73,3 +129,241 @@ func (c *Client) docPull() (*string, error) {
 
 	return message, err
 }
+
+// runDocumentPlugin runs the plugin in the config against the documents of the phase and returns the name of
+// the phase, the base64 YAML the plugin put out and what it changed
+func (c *Client) runDocumentPlugin(request configs.WsMessage) (string, string, *PluginResult, error) {
+	phaseID := ifc.ID{}
+	if err := json.Unmarshal([]byte(request.ID), &phaseID); err != nil {
+		return "", "", nil, err
+	}
+
+	run := PluginRun{}
+	if request.Data != nil {
+		b, err := json.Marshal(request.Data)
+		if err != nil {
+			return "", "", nil, err
+		}
+		if err = json.Unmarshal(b, &run); err != nil {
+			return "", "", nil, err
+		}
+	}
+
+	cfg, err := pluginConfig(request.YAML, run.ConfigID)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	docs, err := c.pluginInput(phaseID, run.Documents)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	before, err := newDocumentSet(docs)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	var in, out bytes.Buffer
+	for _, name := range before.names {
+		in.WriteString("---\n")
+		in.WriteString(before.yaml[name])
+	}
+
+	_, span := tracing.StartSpan(c.trace, "document plugin", attribute.String("phase", phaseID.Name))
+	err = docplugin.ConfigureAndRun(cfg, &in, &out)
+	tracing.RecordError(span, err)
+	span.End()
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	outDocs := []document.Document{}
+	if len(bytes.TrimSpace(out.Bytes())) > 0 {
+		bundle, err := document.NewBundleFromBytes(out.Bytes())
+		if err != nil {
+			return "", "", nil, err
+		}
+		if outDocs, err = bundle.GetAllDocuments(); err != nil {
+			return "", "", nil, err
+		}
+	}
+
+	after, err := newDocumentSet(outDocs)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	result := &PluginResult{Documents: diffDocuments(before, after)}
+	if run.Output != "" {
+		if result.Written, err = writePluginOutput(phaseID, run.Output, out.Bytes(), run.Overwrite); err != nil {
+			return "", "", nil, err
+		}
+	}
+
+	return phaseID.Name, base64.StdEncoding.EncodeToString(out.Bytes()), result, nil
+}
+
+// pluginConfig is the plugin config from the base64 YAML of the request or the picked document
+func pluginConfig(yaml64, configID string) ([]byte, error) {
+	if yaml64 != "" {
+		return base64.StdEncoding.DecodeString(yaml64)
+	}
+
+	if configID == "" {
+		return nil, errors.New("a plugin config is needed, either as yaml or the configID of a document")
+	}
+	doc, ok := indexedDocument(configID)
+	if !ok {
+		return nil, fmt.Errorf("document with ID '%s' not found", configID)
+	}
+	return doc.AsYAML()
+}
+
+// pluginInput is the picked documents, or all the documents of the phase when none are picked
+func (c *Client) pluginInput(phaseID ifc.ID, ids []string) ([]document.Document, error) {
+	if len(ids) > 0 {
+		docs := make([]document.Document, 0, len(ids))
+		for _, id := range ids {
+			doc, ok := indexedDocument(id)
+			if !ok {
+				return nil, fmt.Errorf("document with ID '%s' not found", id)
+			}
+			docs = append(docs, doc)
+		}
+		return docs, nil
+	}
+
+	bundle, err := c.getPhaseBundle(phaseID)
+	if err != nil {
+		return nil, err
+	}
+	if bundle == nil {
+		return nil, fmt.Errorf("phase %s has no documents", phaseID.Name)
+	}
+	return bundle.GetAllDocuments()
+}
+
+// writePluginOutput writes the output into the document root of the phase, the output is a file name so
+// nothing outside of it can be written.  An existing file is only replaced when asked to
+func writePluginOutput(phaseID ifc.ID, output string, yaml []byte, overwrite bool) (string, error) {
+	if output != filepath.Base(output) || output == "." || output == ".." {
+		return "", fmt.Errorf("output '%s' has to be a file name", output)
+	}
+
+	helper, err := getHelper()
+	if err != nil {
+		return "", err
+	}
+
+	p, err := phase.NewClient(helper).PhaseByID(phaseID)
+	if err != nil {
+		return "", err
+	}
+
+	docRoot, err := p.DocumentRoot()
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(docRoot, output)
+	if err = writeOutputFile(path, yaml, overwrite); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// writeOutputFile writes the file, failing if it exists unless overwrite is set
+func writeOutputFile(path string, yaml []byte, overwrite bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overwrite {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	}
+
+	f, err := os.OpenFile(path, flags, 0600)
+	if os.IsExist(err) {
+		return fmt.Errorf("output '%s' already exists, set overwrite to replace it", filepath.Base(path))
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(yaml); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// documentName is the name a document is shown under in the UI, namespace/kind/name
+func documentName(doc document.Document) string {
+	namespace := doc.GetNamespace()
+	if namespace == "" {
+		namespace = "[none]"
+	}
+	return fmt.Sprintf("%s/%s/%s", namespace, doc.GetKind(), doc.GetName())
+}
+
+func newDocumentSet(docs []document.Document) (documentSet, error) {
+	set := documentSet{yaml: map[string]string{}}
+	for _, doc := range docs {
+		b, err := doc.AsYAML()
+		if err != nil {
+			return set, err
+		}
+
+		name := documentName(doc)
+		if _, ok := set.yaml[name]; !ok {
+			set.names = append(set.names, name)
+		}
+		set.yaml[name] = string(b)
+	}
+	return set, nil
+}
+
+// diffDocuments compares the documents by name, the ones the plugin kept in the order they went in followed
+// by the ones it added
+func diffDocuments(before, after documentSet) []DocumentDiff {
+	diffs := []DocumentDiff{}
+
+	for _, name := range before.names {
+		b, a := before.yaml[name], ""
+		status := documentRemoved
+		if y, ok := after.yaml[name]; ok {
+			a, status = y, documentChanged
+		}
+
+		if a == b {
+			diffs = append(diffs, DocumentDiff{Name: name, Status: documentUnchanged})
+			continue
+		}
+		diffs = append(diffs, DocumentDiff{Name: name, Status: status, Diff: unifiedDiff(name, b, a)})
+	}
+
+	for _, name := range after.names {
+		if _, ok := before.yaml[name]; !ok {
+			diffs = append(diffs, DocumentDiff{
+				Name:   name,
+				Status: documentAdded,
+				Diff:   unifiedDiff(name, "", after.yaml[name]),
+			})
+		}
+	}
+
+	return diffs
+}
+
+func unifiedDiff(name, before, after string) string {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(before),
+		B:        difflib.SplitLines(after),
+		FromFile: name + " (input)",
+		ToFile:   name + " (output)",
+		Context:  3,
+	})
+	if err != nil {
+		// the diff is only written to a buffer, this doesn't happen
+		return err.Error()
+	}
+	return diff
+}
@@ -15,9 +15,15 @@
 package ctl
 
 import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"opendev.org/airship/airshipctl/pkg/phase/ifc"
 	"opendev.org/airship/airshipui/pkg/configs"
 )
 
@@ -44,3 +50,80 @@ func TestHandleUnknownDocumentSubComponent(t *testing.T) {
 
 	assert.Equal(t, expected, response)
 }
+
+func TestDiffDocuments(t *testing.T) {
+	before := documentSet{
+		names: []string{"[none]/Namespace/kept", "default/ConfigMap/changed", "default/Secret/removed"},
+		yaml: map[string]string{
+			"[none]/Namespace/kept":     "kind: Namespace\nmetadata:\n  name: kept\n",
+			"default/ConfigMap/changed": "kind: ConfigMap\ndata:\n  a: \"1\"\n",
+			"default/Secret/removed":    "kind: Secret\n",
+		},
+	}
+	after := documentSet{
+		names: []string{"default/ConfigMap/added", "[none]/Namespace/kept", "default/ConfigMap/changed"},
+		yaml: map[string]string{
+			"default/ConfigMap/added":   "kind: ConfigMap\n",
+			"[none]/Namespace/kept":     "kind: Namespace\nmetadata:\n  name: kept\n",
+			"default/ConfigMap/changed": "kind: ConfigMap\ndata:\n  a: \"2\"\n",
+		},
+	}
+
+	diffs := diffDocuments(before, after)
+	require.Len(t, diffs, 4)
+
+	assert.Equal(t, DocumentDiff{Name: "[none]/Namespace/kept", Status: documentUnchanged}, diffs[0])
+
+	assert.Equal(t, "default/ConfigMap/changed", diffs[1].Name)
+	assert.Equal(t, documentChanged, diffs[1].Status)
+	assert.Contains(t, diffs[1].Diff, "--- default/ConfigMap/changed (input)\n+++ default/ConfigMap/changed (output)\n")
+	assert.Contains(t, diffs[1].Diff, "-  a: \"1\"\n+  a: \"2\"\n")
+
+	assert.Equal(t, "default/Secret/removed", diffs[2].Name)
+	assert.Equal(t, documentRemoved, diffs[2].Status)
+	assert.Contains(t, diffs[2].Diff, "-kind: Secret\n")
+
+	assert.Equal(t, "default/ConfigMap/added", diffs[3].Name)
+	assert.Equal(t, documentAdded, diffs[3].Status)
+	assert.Contains(t, diffs[3].Diff, "+kind: ConfigMap\n")
+}
+
+func TestPluginConfig(t *testing.T) {
+	yaml := "apiVersion: airshipit.org/v1alpha1\nkind: ReplacementTransformer\n"
+	cfg, err := pluginConfig(base64.StdEncoding.EncodeToString([]byte(yaml)), "")
+	require.NoError(t, err)
+	assert.Equal(t, yaml, string(cfg))
+
+	_, err = pluginConfig("", "")
+	assert.Error(t, err)
+	_, err = pluginConfig("", "no-such-document")
+	assert.EqualError(t, err, "document with ID 'no-such-document' not found")
+}
+
+func TestWritePluginOutputName(t *testing.T) {
+	for _, output := range []string{"../kustomization.yaml", "/etc/passwd", "sub/out.yaml", ".", ".."} {
+		_, err := writePluginOutput(ifc.ID{Name: "phase"}, output, nil, true)
+		assert.EqualError(t, err, "output '"+output+"' has to be a file name")
+	}
+}
+
+func TestWriteOutputFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "airshipui-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "out.yaml")
+	require.NoError(t, writeOutputFile(path, []byte("first"), false))
+
+	// the file that's there is kept unless it's to be overwritten
+	assert.EqualError(t, writeOutputFile(path, []byte("second"), false),
+		"output 'out.yaml' already exists, set overwrite to replace it")
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(b))
+
+	require.NoError(t, writeOutputFile(path, []byte("third"), true))
+	b, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "third", string(b))
+}
@@ -0,0 +1,458 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package ctl
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"opendev.org/airship/airshipctl/pkg/document"
+	"opendev.org/airship/airshipctl/pkg/phase/ifc"
+	"sigs.k8s.io/cli-utils/pkg/object"
+	"sigs.k8s.io/yaml"
+)
+
+// metadata fields set by the api server or the applier, these always differ from what was rendered
+var serverManagedMetadata = []string{
+	"creationTimestamp",
+	"deletionGracePeriodSeconds",
+	"deletionTimestamp",
+	"generation",
+	"managedFields",
+	"ownerReferences",
+	"resourceVersion",
+	"selfLink",
+	"uid",
+}
+
+// the applier's copy of what it last applied, it's never what was rendered
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// shown instead of the value of a secret, secrets are only compared by hash and never leave the server
+const redacted = "<redacted>"
+
+// fields whose values are resource quantities, the api server hands them back in canonical form
+// so i.e. a rendered 1000m is a live 1
+var quantityFields = map[string]bool{
+	"allocatable":    true,
+	"capacity":       true,
+	"default":        true,
+	"defaultRequest": true,
+	"hard":           true,
+	"limits":         true,
+	"max":            true,
+	"min":            true,
+	"requests":       true,
+}
+
+// PhaseDrift is the difference between the rendered documents of a phase and the live objects in the cluster
+type PhaseDrift struct {
+	Missing []ObjectRef   `json:"missing"`
+	Extra   []ObjectRef   `json:"extra"`
+	Drifted []ObjectDrift `json:"drifted"`
+}
+
+// ObjectRef identifies a kubernetes object
+type ObjectRef struct {
+	Group     string `json:"group,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// ObjectDrift holds the field level differences of a single object
+type ObjectDrift struct {
+	ObjectRef
+	Fields []FieldDiff `json:"fields"`
+}
+
+// FieldDiff is a single field whose live value is not what was rendered
+type FieldDiff struct {
+	Path     string      `json:"path"`
+	Rendered interface{} `json:"rendered"`
+	Live     interface{} `json:"live"`
+}
+
+// GetPhaseDrift compares the rendered documents of a phase with the live objects in the cluster
+// of the current airship context
+func (c *Client) GetPhaseDrift(id string) (*PhaseDrift, error) {
+	phaseID := ifc.ID{}
+
+	err := json.Unmarshal([]byte(id), &phaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle, err := c.getPhaseBundle(phaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered, err := bundleObjects(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	clientSet, dynamicClient, err := c.kubeClients()
+	if err != nil {
+		return nil, err
+	}
+
+	mapper, err := restMapper(clientSet)
+	if err != nil {
+		return nil, err
+	}
+
+	return detectDrift(clientSet, dynamicClient, mapper, inventoryID(phaseID.Name, rendered), rendered)
+}
+
+// bundleObjects converts the documents of a bundle into unstructured objects, a phase without
+// documents has nothing to compare
+func bundleObjects(bundle document.Bundle) ([]*unstructured.Unstructured, error) {
+	objects := []*unstructured.Unstructured{}
+	if bundle == nil {
+		return objects, nil
+	}
+
+	docs, err := bundle.GetAllDocuments()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		bytes, err := doc.AsYAML()
+		if err != nil {
+			return nil, err
+		}
+
+		// going through json gives the same number types the api server hands back
+		bytes, err = yaml.YAMLToJSON(bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		obj := &unstructured.Unstructured{}
+		err = obj.UnmarshalJSON(bytes)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+
+	return objects, nil
+}
+
+// detectDrift fetches the live object for every rendered one and reports what is missing, what differs
+// and what the inventory says was applied before but is no longer rendered
+func detectDrift(clientSet kubernetes.Interface, dynamicClient dynamic.Interface, mapper meta.RESTMapper,
+	invID string, rendered []*unstructured.Unstructured) (*PhaseDrift, error) {
+	drift := &PhaseDrift{
+		Missing: []ObjectRef{},
+		Extra:   []ObjectRef{},
+		Drifted: []ObjectDrift{},
+	}
+
+	expected := map[object.ObjMetadata]bool{}
+	for _, obj := range rendered {
+		if isInventory(obj) {
+			continue
+		}
+
+		gvk := obj.GroupVersionKind()
+		ref := ObjectRef{
+			Group:     gvk.Group,
+			Version:   gvk.Version,
+			Kind:      gvk.Kind,
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+		}
+
+		// the kind may not even be known to the cluster yet, i.e. the CRD hasn't been applied
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			if meta.IsNoMatchError(err) {
+				drift.Missing = append(drift.Missing, ref)
+				continue
+			}
+			return nil, err
+		}
+
+		ref.Namespace = objectNamespace(mapping, ref.Namespace)
+		expected[object.ObjMetadata{Namespace: ref.Namespace, Name: ref.Name, GroupKind: gvk.GroupKind()}] = true
+
+		live, err := dynamicClient.Resource(mapping.Resource).Namespace(ref.Namespace).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				drift.Missing = append(drift.Missing, ref)
+				continue
+			}
+			return nil, err
+		}
+
+		fields := diffObject(obj, live)
+		if len(fields) > 0 {
+			drift.Drifted = append(drift.Drifted, ObjectDrift{ObjectRef: ref, Fields: fields})
+		}
+	}
+
+	extra, err := extraObjects(clientSet, dynamicClient, mapper, invID, expected)
+	if err != nil {
+		return nil, err
+	}
+	drift.Extra = extra
+
+	return drift, nil
+}
+
+// extraObjects returns the objects tracked by the inventory that still exist but are no longer rendered
+func extraObjects(clientSet kubernetes.Interface, dynamicClient dynamic.Interface, mapper meta.RESTMapper,
+	invID string, expected map[object.ObjMetadata]bool) ([]ObjectRef, error) {
+	inventory, err := getInventory(clientSet, invID)
+	if err != nil {
+		return nil, err
+	}
+
+	extra := []ObjectRef{}
+	for _, obj := range inventory {
+		if expected[obj] {
+			continue
+		}
+
+		mapping, err := mapper.RESTMapping(obj.GroupKind)
+		if err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		// the inventory may still list objects that have since been deleted
+		_, err = dynamicClient.Resource(mapping.Resource).Namespace(obj.Namespace).Get(obj.Name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		extra = append(extra, ObjectRef{
+			Group:     obj.GroupKind.Group,
+			Version:   mapping.GroupVersionKind.Version,
+			Kind:      obj.GroupKind.Kind,
+			Namespace: obj.Namespace,
+			Name:      obj.Name,
+		})
+	}
+
+	return extra, nil
+}
+
+// diffObject compares the fields that were rendered with the live object.  Fields only present on the
+// live object are defaults or set by the server so they are not considered drift
+func diffObject(rendered, live *unstructured.Unstructured) []FieldDiff {
+	expected := rendered.DeepCopy().Object
+	delete(expected, "status")
+	for _, field := range serverManagedMetadata {
+		unstructured.RemoveNestedField(expected, "metadata", field)
+	}
+	unstructured.RemoveNestedField(expected, "metadata", "annotations", lastAppliedAnnotation)
+	annotations, found, _ := unstructured.NestedMap(expected, "metadata", "annotations")
+	if found && len(annotations) == 0 {
+		unstructured.RemoveNestedField(expected, "metadata", "annotations")
+	}
+
+	diffs := []FieldDiff{}
+	if !isSecret(rendered) {
+		diffFields("", expected, live.Object, &diffs)
+		return diffs
+	}
+
+	// the values of a secret are compared by hash so they aren't handed to the browser
+	delete(expected, "data")
+	delete(expected, "stringData")
+	diffFields("", expected, live.Object, &diffs)
+	return append(diffs, diffSecretData(secretHashes(rendered.Object), secretHashes(live.Object))...)
+}
+
+func isSecret(obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+	return gvk.Group == "" && gvk.Kind == "Secret"
+}
+
+// secretHashes hashes the decoded values of a secret, stringData is merged into data the way the api server does
+func secretHashes(obj map[string]interface{}) map[string][sha256.Size]byte {
+	hashes := map[string][sha256.Size]byte{}
+
+	data, _, _ := unstructured.NestedMap(obj, "data")
+	for key, value := range data {
+		encoded, _ := value.(string)
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			decoded = []byte(encoded)
+		}
+		hashes[key] = sha256.Sum256(decoded)
+	}
+
+	stringData, _, _ := unstructured.NestedMap(obj, "stringData")
+	for key, value := range stringData {
+		plain, _ := value.(string)
+		hashes[key] = sha256.Sum256([]byte(plain))
+	}
+
+	return hashes
+}
+
+// diffSecretData records every rendered secret value that isn't the live one, with both values redacted
+func diffSecretData(rendered, live map[string][sha256.Size]byte) []FieldDiff {
+	keys := make([]string, 0, len(rendered))
+	for key := range rendered {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	diffs := []FieldDiff{}
+	for _, key := range keys {
+		liveHash, found := live[key]
+		if !found {
+			diffs = append(diffs, FieldDiff{Path: "data." + key, Rendered: redacted})
+			continue
+		}
+		if liveHash != rendered[key] {
+			diffs = append(diffs, FieldDiff{Path: "data." + key, Rendered: redacted, Live: redacted})
+		}
+	}
+	return diffs
+}
+
+// diffFields walks the rendered value and records every leaf that doesn't match the live value
+func diffFields(path string, rendered, live interface{}, diffs *[]FieldDiff) {
+	switch r := rendered.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			*diffs = append(*diffs, FieldDiff{Path: path, Rendered: rendered, Live: live})
+			return
+		}
+
+		keys := make([]string, 0, len(r))
+		for key := range r {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+
+			liveValue, found := l[key]
+			if !found {
+				// an explicit null in the yaml is the same as the field not being there
+				if r[key] != nil {
+					*diffs = append(*diffs, FieldDiff{Path: fieldPath, Rendered: r[key]})
+				}
+				continue
+			}
+			diffFields(fieldPath, r[key], liveValue, diffs)
+		}
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(r) {
+			*diffs = append(*diffs, FieldDiff{Path: path, Rendered: rendered, Live: live})
+			return
+		}
+
+		for i := range r {
+			diffFields(fmt.Sprintf("%s[%d]", path, i), r[i], l[i], diffs)
+		}
+	default:
+		if !valuesEqual(rendered, live) && !(isQuantityField(path) && quantitiesEqual(rendered, live)) {
+			*diffs = append(*diffs, FieldDiff{Path: path, Rendered: rendered, Live: live})
+		}
+	}
+}
+
+// valuesEqual compares two scalar values, numbers are compared by value since yaml and json decoding
+// don't agree on int vs float
+func valuesEqual(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			return x == y
+		}
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// isQuantityField is true when the field at the path is in one of the maps of resource quantities
+func isQuantityField(path string) bool {
+	fields := strings.Split(path, ".")
+	return len(fields) > 1 && quantityFields[fields[len(fields)-2]]
+}
+
+// quantitiesEqual is true when both values are the same resource quantity, however they're written
+func quantitiesEqual(a, b interface{}) bool {
+	x, ok := toQuantity(a)
+	if !ok {
+		return false
+	}
+	y, ok := toQuantity(b)
+	return ok && x.Cmp(y) == 0
+}
+
+func toQuantity(v interface{}) (resource.Quantity, bool) {
+	value, ok := v.(string)
+	if !ok {
+		n, ok := toFloat(v)
+		if !ok {
+			return resource.Quantity{}, false
+		}
+		value = strconv.FormatFloat(n, 'f', -1, 64)
+	}
+
+	quantity, err := resource.ParseQuantity(value)
+	return quantity, err == nil
+}
@@ -0,0 +1,202 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package ctl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/cli-utils/pkg/common"
+)
+
+func TestDetectDrift(t *testing.T) {
+	rendered := []*unstructured.Unstructured{
+		testDeployment(int64(2)),
+		testObject("v1", "ConfigMap", "missing-cm", nil),
+		testObject("v1", "ConfigMap", "inventory", map[string]string{common.InventoryLabel: "test-phase"}),
+	}
+
+	// the live deployment has server managed fields and defaults on top of a changed replica count
+	live := testDeployment(int64(3))
+	live.SetUID("1234")
+	live.SetResourceVersion("42")
+	err := unstructured.SetNestedField(live.Object, "RollingUpdate", "spec", "strategy", "type")
+	require.NoError(t, err)
+	err = unstructured.SetNestedField(live.Object, int64(3), "status", "replicas")
+	require.NoError(t, err)
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		live,
+		testObject("v1", "ServiceAccount", "old-sa", nil),
+	)
+
+	clientSet := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "inventory",
+			Namespace: "airshipit",
+			Labels:    map[string]string{common.InventoryLabel: "test-phase"},
+		},
+		Data: map[string]string{
+			"default_app_apps_Deployment":    "",
+			"default_old-sa__ServiceAccount": "",
+			"default_gone__ServiceAccount":   "",
+		},
+	})
+
+	assert.Equal(t, "test-phase", inventoryID("some-phase", rendered))
+
+	drift, err := detectDrift(clientSet, dynamicClient, testRESTMapper(), "test-phase", rendered)
+	require.NoError(t, err)
+
+	assert.Equal(t, []ObjectRef{
+		{Version: "v1", Kind: "ConfigMap", Namespace: "default", Name: "missing-cm"},
+	}, drift.Missing)
+	assert.Equal(t, []ObjectRef{
+		{Version: "v1", Kind: "ServiceAccount", Namespace: "default", Name: "old-sa"},
+	}, drift.Extra)
+	assert.Equal(t, []ObjectDrift{
+		{
+			ObjectRef: ObjectRef{Group: "apps", Version: "v1", Kind: "Deployment", Namespace: "default", Name: "app"},
+			Fields: []FieldDiff{
+				{Path: "spec.replicas", Rendered: int64(2), Live: int64(3)},
+			},
+		},
+	}, drift.Drifted)
+}
+
+func TestDiffFields(t *testing.T) {
+	rendered := map[string]interface{}{
+		"count":   float64(1),
+		"missing": "value",
+		"null":    nil,
+		"list":    []interface{}{"a", "b"},
+	}
+	live := map[string]interface{}{
+		"count": int64(1),
+		"list":  []interface{}{"a", "c"},
+	}
+
+	diffs := []FieldDiff{}
+	diffFields("", rendered, live, &diffs)
+
+	assert.Equal(t, []FieldDiff{
+		{Path: "list[1]", Rendered: "b", Live: "c"},
+		{Path: "missing", Rendered: "value"},
+	}, diffs)
+}
+
+func TestDiffObjectSecret(t *testing.T) {
+	rendered := testObject("v1", "Secret", "creds", nil)
+	rendered.Object["data"] = map[string]interface{}{
+		"username": "YWRtaW4=",
+		"password": "c2VjcmV0",
+	}
+	rendered.Object["stringData"] = map[string]interface{}{
+		"token":  "abc",
+		"region": "east",
+	}
+
+	// stringData is returned as data by the api server
+	live := testObject("v1", "Secret", "creds", nil)
+	live.Object["data"] = map[string]interface{}{
+		"username": "YWRtaW4=",
+		"password": "b3RoZXI=",
+		"token":    "YWJj",
+	}
+	live.SetAnnotations(map[string]string{lastAppliedAnnotation: `{"stringData":{"token":"abc"}}`})
+
+	assert.Equal(t, []FieldDiff{
+		{Path: "data.password", Rendered: redacted, Live: redacted},
+		{Path: "data.region", Rendered: redacted},
+	}, diffObject(rendered, live))
+}
+
+func TestDiffObjectIgnored(t *testing.T) {
+	rendered := testDeployment(int64(2))
+	rendered.SetAnnotations(map[string]string{lastAppliedAnnotation: "{}"})
+	containers := []interface{}{
+		map[string]interface{}{
+			"name": "app",
+			"resources": map[string]interface{}{
+				"limits":   map[string]interface{}{"cpu": "1000m", "memory": "1024Mi"},
+				"requests": map[string]interface{}{"cpu": float64(1), "memory": "512Mi"},
+			},
+		},
+	}
+	require.NoError(t, unstructured.SetNestedSlice(rendered.Object, containers, "spec", "template", "spec", "containers"))
+
+	live := testDeployment(int64(2))
+	containers = []interface{}{
+		map[string]interface{}{
+			"name": "app",
+			"resources": map[string]interface{}{
+				"limits":   map[string]interface{}{"cpu": "1", "memory": "1Gi"},
+				"requests": map[string]interface{}{"cpu": "1", "memory": "256Mi"},
+			},
+		},
+	}
+	require.NoError(t, unstructured.SetNestedSlice(live.Object, containers, "spec", "template", "spec", "containers"))
+
+	assert.Equal(t, []FieldDiff{
+		{Path: "spec.template.spec.containers[0].resources.requests.memory", Rendered: "512Mi", Live: "256Mi"},
+	}, diffObject(rendered, live))
+}
+
+func testRESTMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{
+		{Version: "v1"},
+		{Group: "apps", Version: "v1"},
+	})
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ServiceAccount"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	return mapper
+}
+
+func testDeployment(replicas int64) *unstructured.Unstructured {
+	obj := testObject("apps/v1", "Deployment", "app", nil)
+	obj.Object["spec"] = map[string]interface{}{
+		"replicas": replicas,
+		"template": map[string]interface{}{
+			"spec": map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "app", "image": "app:v1"},
+				},
+			},
+		},
+	}
+	return obj
+}
+
+func testObject(apiVersion, kind, name string, labels map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetName(name)
+	obj.SetNamespace("default")
+	if labels != nil {
+		obj.SetLabels(labels)
+	}
+	return obj
+}
@@ -15,24 +15,37 @@
 package ctl
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
-	"strings"
+	"net/http"
+	"time"
 
 	"opendev.org/airship/airshipui/pkg/configs"
 	"opendev.org/airship/airshipui/pkg/log"
 	"opendev.org/airship/airshipui/pkg/statistics"
+	"opendev.org/airship/airshipui/pkg/webservice"
+	"opendev.org/airship/airshipui/util/utilhttp"
 )
 
-// This is close to but not exactly a transaction structure from statistics, it's redone here because reasons
-type record struct {
-	SubComponent configs.WsSubComponentType
-	User         *string
-	ActionType   *string
-	Target       *string
-	Success      bool
-	Started      int64
-	Elapsed      int64
-	Stopped      int64
+const (
+	// the http route the history can be downloaded from, it takes the same parameters as the history query
+	// plus the format
+	historyExportRoute = "/history/export"
+
+	// how much of an export is sent over the websocket in a single message
+	exportChunkSize = 64 * 1024
+)
+
+// historyExport holds the options of an export that aren't part of the history query
+type historyExport struct {
+	Format string `json:"format,omitempty"`
+}
+
+// exportSender sends an export over the websocket in chunks as it's written
+type exportSender struct {
+	response configs.WsMessage
+	buffer   bytes.Buffer
 }
 
 // HandleHistoryRequest will flop between requests so we don't have to have them all mapped as function calls
@@ -44,17 +57,33 @@ func HandleHistoryRequest(user *string, request configs.WsMessage) configs.WsMes
 		SubComponent: request.SubComponent,
 	}
 
-	var err error
+	store, err := statistics.Storage()
+	var query statistics.Query
+	if err == nil {
+		query, err = getHistoryQuery(request)
+	}
 
-	subComponent := request.SubComponent
-	switch subComponent {
-	case configs.GetDefaults:
-		response.Data, err = getData(nil, nil)
-	default:
-		err = fmt.Errorf("Subcomponent %s not found", request.SubComponent)
+	if err == nil {
+		switch request.SubComponent {
+		case configs.GetDefaults:
+			response.Data, err = getData(store, query)
+		case configs.GetHistory:
+			response.Data, err = store.QueryPage(query)
+		case configs.GetSuccessRate:
+			response.Data, err = store.SuccessRates(query)
+		case configs.GetElapsedPercentiles:
+			response.Data, err = store.Percentiles(query)
+		case configs.GetTopFailures:
+			response.Data, err = store.TopFailures(query)
+		case configs.Export:
+			response.Name, response.Message, err = exportHistory(store, query, request)
+		default:
+			err = fmt.Errorf("Subcomponent %s not found", request.SubComponent)
+		}
 	}
 
 	if err != nil {
+		log.Error(err)
 		e := err.Error()
 		response.Error = &e
 	}
@@ -62,78 +91,147 @@ func HandleHistoryRequest(user *string, request configs.WsMessage) configs.WsMes
 	return response
 }
 
-// getData will return all rows within a specific date range
-func getData(notBefore *int64, notAfter *int64) (map[string][]record, error) {
-	var wherePstmt strings.Builder
-	where := false
-	// because we may want data within a range add range slice where statements
-	if notBefore != nil {
-		where = true
-		wherePstmt.WriteString(fmt.Sprintf(" where started >= %d", notBefore))
-	}
-	if notAfter != nil {
-		if where {
-			wherePstmt.WriteString(fmt.Sprintf(" and stopped <= %d", notAfter))
-		} else {
-			wherePstmt.WriteString(fmt.Sprintf(" where stopped <= %d", notAfter))
-		}
+// getHistoryQuery reads the query out of the request data, no data means everything
+func getHistoryQuery(request configs.WsMessage) (statistics.Query, error) {
+	query := statistics.Query{}
+	if request.Data == nil {
+		return query, nil
 	}
 
-	data := map[string][]record{}
-	for _, table := range statistics.Tables {
-		// create a basic prepared statement to get data
-		// Why a prepared statement?  Little Bobby Tables is why:
-		// https://xkcd.com/327/
-		pstmt := fmt.Sprintf("select * from %s", table)
-		if where {
-			pstmt += wherePstmt.String()
-		}
+	bytes, err := json.Marshal(request.Data)
+	if err != nil {
+		return query, err
+	}
 
-		// Dark Helmet: Why are we always preparing?  Just go!
-		stmt, err := statistics.DB.Prepare(pstmt)
-		if err != nil {
-			log.Error(err)
-			return nil, err
-		}
+	err = json.Unmarshal(bytes, &query)
+	return query, err
+}
 
-		// Get the rows back from the query
-		rows, err := stmt.Query()
-		if err != nil {
-			log.Error(err)
-			return nil, err
-		}
-		defer rows.Close()
-
-		records := []record{}
-		for rows.Next() {
-			var r record
-			err = rows.Scan(
-				&r.SubComponent,
-				&r.User,
-				&r.ActionType,
-				&r.Target,
-				&r.Success,
-				&r.Started,
-				&r.Elapsed,
-				&r.Stopped,
-			)
-			if err != nil {
-				log.Error(err)
-				return nil, err
-			}
-			records = append(records, r)
-		}
+// getData will return all rows that match the query grouped by the component they belong to
+func getData(store statistics.Store, query statistics.Query) (map[string][]statistics.Record, error) {
+	records, err := store.Records(query)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string][]statistics.Record{}
+	for _, r := range records {
+		data[r.Component] = append(data[r.Component], r)
+	}
+
+	return data, nil
+}
 
-		err = rows.Err()
+// exportHistory sends the records that match the query over the websocket as csv or ndjson
+// The export is sent in chunks with the file name, the response lets the UI know it's complete
+func exportHistory(store statistics.Store, query statistics.Query,
+	request configs.WsMessage) (string, *string, error) {
+	opts := historyExport{}
+	if request.Data != nil {
+		b, err := json.Marshal(request.Data)
 		if err != nil {
-			log.Error(err)
-			return nil, err
+			return "", nil, err
 		}
 
-		if len(records) > 0 {
-			data[table] = records
+		if err = json.Unmarshal(b, &opts); err != nil {
+			return "", nil, err
 		}
 	}
+	if opts.Format == "" {
+		opts.Format = statistics.CSV
+	}
 
-	return data, nil
+	name := exportFileName(opts.Format)
+	sender := &exportSender{
+		response: configs.WsMessage{
+			Type:         configs.CTL,
+			Component:    configs.History,
+			SubComponent: configs.Export,
+			SessionID:    request.SessionID,
+			RequestID:    request.RequestID,
+			Name:         name,
+		},
+	}
+
+	count, err := statistics.Export(sender, store, query, opts.Format)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err = sender.flush(); err != nil {
+		return "", nil, err
+	}
+
+	m := fmt.Sprintf("%d records exported", count)
+	return name, &m, nil
+}
+
+// Write buffers up the export and sends it once there's a chunk worth sending
+func (s *exportSender) Write(p []byte) (int, error) {
+	n, err := s.buffer.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	if s.buffer.Len() >= exportChunkSize {
+		return n, s.flush()
+	}
+
+	return n, nil
+}
+
+// flush sends whatever is in the buffer
+func (s *exportSender) flush() error {
+	if s.buffer.Len() == 0 {
+		return nil
+	}
+
+	response := s.response
+	response.Data = s.buffer.String()
+	s.buffer.Reset()
+
+	return webservice.WebSocketSend(response)
+}
+
+// downloadHistory streams the records that match the query parameters as an attachment
+func downloadHistory(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(response, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store, err := statistics.Storage()
+	if err != nil {
+		utilhttp.HandleErr(response, err, http.StatusServiceUnavailable)
+		return
+	}
+
+	values := request.URL.Query()
+	query, err := statistics.ParseQuery(values)
+	if err != nil {
+		utilhttp.HandleErr(response, err, http.StatusBadRequest)
+		return
+	}
+
+	format := values.Get("format")
+	if format == "" {
+		format = statistics.CSV
+	}
+	if format != statistics.CSV && format != statistics.NDJSON {
+		utilhttp.HandleErr(response, fmt.Errorf("unknown export format %s", format), http.StatusBadRequest)
+		return
+	}
+
+	response.Header().Set("Content-Type", statistics.ContentType(format))
+	response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exportFileName(format)))
+
+	// once the export starts the status has been sent, so all that can be done is to log the failure
+	if _, err = statistics.Export(response, store, query, format); err != nil {
+		log.Errorf("Error exporting history: %s", err)
+	}
+}
+
+// exportFileName names the export after when it was taken
+func exportFileName(format string) string {
+	return fmt.Sprintf("airshipui-history-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
 }
@@ -15,11 +15,31 @@
 package ctl
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"opendev.org/airship/airshipctl/pkg/config"
 	"opendev.org/airship/airshipctl/pkg/phase"
+	"opendev.org/airship/airshipctl/pkg/phase/ifc"
 	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/metrics"
+	"opendev.org/airship/airshipui/util/utilhttp"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// artifactRoute is the http route the artifacts of the bootstrap phase can be downloaded from
+	artifactRoute = "/image/artifacts/"
 )
 
 // HandleImageRequest will flop between requests so we don't have to have them all mapped as function calls
@@ -27,7 +47,7 @@ import (
 func HandleImageRequest(user *string, request configs.WsMessage) configs.WsMessage {
 	response := configs.WsMessage{
 		Type:         configs.CTL,
-		Component:    configs.Baremetal,
+		Component:    configs.Image,
 		SubComponent: request.SubComponent,
 	}
 
@@ -47,9 +67,13 @@ func HandleImageRequest(user *string, request configs.WsMessage) configs.WsMessa
 		// since this is long running cache it up
 		// TODO: Test before running the geniso
 		runningRequests[subComponent] = true
+		metrics.TaskStarted()
 		message, err = client.generateIso()
 		// now that we're done forget we did anything
+		metrics.TaskEnded()
 		delete(runningRequests, subComponent)
+	case configs.GetArtifacts:
+		response.Data, err = client.getArtifacts()
 	default:
 		err = fmt.Errorf("Subcomponent %s not found", request.SubComponent)
 	}
@@ -74,3 +98,184 @@ func (c *Client) generateIso() (*string, error) {
 	s := "Success"
 	return &s, p.RunE()
 }
+
+// Artifact describes a file produced by the bootstrap (image generation) phase
+type Artifact struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+	Built    int64  `json:"built"`
+	URL      string `json:"url"`
+}
+
+// isoConfig is the small part of the bootstrap executor document we need to find the built artifacts
+type isoConfig struct {
+	Container struct {
+		Volume string `json:"volume,omitempty"`
+	} `json:"container,omitempty"`
+}
+
+// cached checksum of an artifact, so a multi gigabyte iso isn't hashed on every listing
+type checksum struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+var (
+	checksumCache = map[string]checksum{}
+	checksumMutex sync.Mutex
+)
+
+// getArtifacts returns the artifacts found in the output directory of the bootstrap phase
+func (c *Client) getArtifacts() ([]Artifact, error) {
+	dir, err := getArtifactDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return listArtifacts(dir)
+}
+
+// getArtifactDir reads the output directory out of the bootstrap phase executor document
+// the volume is defined as <host dir>:<container dir> and the artifacts land in the host dir
+func getArtifactDir() (string, error) {
+	helper, err := getHelper()
+	if err != nil {
+		return "", err
+	}
+
+	ed, err := helper.ExecutorDoc(ifc.ID{Name: config.BootstrapPhase})
+	if err != nil {
+		return "", err
+	}
+
+	bytes, err := ed.AsYAML()
+	if err != nil {
+		return "", err
+	}
+
+	conf := isoConfig{}
+	err = yaml.Unmarshal(bytes, &conf)
+	if err != nil {
+		return "", err
+	}
+
+	dir := strings.Split(conf.Container.Volume, ":")[0]
+	if dir == "" {
+		return "", fmt.Errorf("no output volume defined for phase %s", config.BootstrapPhase)
+	}
+
+	return dir, nil
+}
+
+// listArtifacts returns the details of all the files in the artifact directory
+func listArtifacts(dir string) ([]Artifact, error) {
+	artifacts := []Artifact{}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		// nothing has been built yet
+		if os.IsNotExist(err) {
+			return artifacts, nil
+		}
+		return nil, err
+	}
+
+	for _, f := range files {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		path := filepath.Join(dir, f.Name())
+		sum, err := getChecksum(path, f)
+		if err != nil {
+			return nil, err
+		}
+
+		artifacts = append(artifacts, Artifact{
+			Name:     f.Name(),
+			Path:     path,
+			Size:     f.Size(),
+			Checksum: sum,
+			Built:    f.ModTime().UnixNano() / 1000000,
+			URL:      artifactRoute + url.PathEscape(f.Name()),
+		})
+	}
+
+	return artifacts, nil
+}
+
+// getChecksum returns the sha256 of the file, only rehashing it if the file has changed since the last time
+func getChecksum(path string, info os.FileInfo) (string, error) {
+	checksumMutex.Lock()
+	defer checksumMutex.Unlock()
+
+	if c, ok := checksumCache[path]; ok && c.size == info.Size() && c.modTime.Equal(info.ModTime()) {
+		return c.sum, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return "", err
+	}
+
+	sum := "sha256:" + hex.EncodeToString(hash.Sum(nil))
+	checksumCache[path] = checksum{
+		size:    info.Size(),
+		modTime: info.ModTime(),
+		sum:     sum,
+	}
+
+	return sum, nil
+}
+
+// downloadArtifact is the http handler used to download the artifacts of the bootstrap phase
+func downloadArtifact(response http.ResponseWriter, request *http.Request) {
+	dir, err := getArtifactDir()
+	if err != nil {
+		utilhttp.HandleErr(response, err, http.StatusInternalServerError)
+		return
+	}
+
+	serveArtifact(response, request, dir)
+}
+
+// serveArtifact sends the requested artifact, http.ServeContent takes care of any range requests
+// so a large download can be resumed
+func serveArtifact(response http.ResponseWriter, request *http.Request, dir string) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		http.Error(response, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// only allow files directly in the artifact dir, anything else is someone poking around
+	name := strings.TrimPrefix(request.URL.Path, artifactRoute)
+	if name == "" || name != filepath.Base(name) {
+		http.NotFound(response, request)
+		return
+	}
+
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		http.NotFound(response, request)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(response, request)
+		return
+	}
+
+	response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeContent(response, request, name, info.ModTime(), f)
+}
@@ -15,10 +15,17 @@
 package ctl
 
 import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/util/utiltest"
 )
 
 func TestHandleUnknownBaremetalSubComponent(t *testing.T) {
@@ -44,3 +51,82 @@ func TestHandleUnknownBaremetalSubComponent(t *testing.T) {
 
 	assert.Equal(t, expected, response)
 }
+
+func TestHandleUnknownImageSubComponent(t *testing.T) {
+	request := configs.WsMessage{
+		Type:         configs.CTL,
+		Component:    configs.Image,
+		SubComponent: "fake_subcomponent",
+	}
+
+	path := "testdata/testairshipconfig"
+	configs.UIConfig.AirshipConfigPath = &path
+
+	user := "test"
+	response := HandleImageRequest(&user, request)
+
+	e := "Subcomponent fake_subcomponent not found"
+	expected := configs.WsMessage{
+		Type:         configs.CTL,
+		Component:    configs.Image,
+		SubComponent: "fake_subcomponent",
+		Error:        &e,
+	}
+
+	assert.Equal(t, expected, response)
+}
+
+func TestListArtifacts(t *testing.T) {
+	dir, cleanup := utiltest.TempDir(t, "airshipui-artifacts")
+	defer cleanup(t)
+
+	err := ioutil.WriteFile(filepath.Join(dir, "ephemeral.iso"), []byte("fake iso"), 0600)
+	require.NoError(t, err)
+	err = os.Mkdir(filepath.Join(dir, "subdir"), 0700)
+	require.NoError(t, err)
+
+	artifacts, err := listArtifacts(dir)
+	require.NoError(t, err)
+	require.Len(t, artifacts, 1)
+
+	artifact := artifacts[0]
+	assert.Equal(t, "ephemeral.iso", artifact.Name)
+	assert.Equal(t, filepath.Join(dir, "ephemeral.iso"), artifact.Path)
+	assert.Equal(t, int64(8), artifact.Size)
+	assert.Equal(t, "sha256:38a1adde4c478df626316edd1d8bdb450d067666f4a54ad8703535c056db55fa", artifact.Checksum)
+	assert.Equal(t, artifactRoute+"ephemeral.iso", artifact.URL)
+}
+
+func TestListArtifactsNotBuilt(t *testing.T) {
+	artifacts, err := listArtifacts("/does/not/exist")
+	require.NoError(t, err)
+	assert.Empty(t, artifacts)
+}
+
+func TestServeArtifact(t *testing.T) {
+	dir, cleanup := utiltest.TempDir(t, "airshipui-artifacts")
+	defer cleanup(t)
+
+	err := ioutil.WriteFile(filepath.Join(dir, "ephemeral.iso"), []byte("0123456789"), 0600)
+	require.NoError(t, err)
+
+	t.Run("RangeRequest", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodGet, artifactRoute+"ephemeral.iso", nil)
+		request.Header.Set("Range", "bytes=2-5")
+		recorder := httptest.NewRecorder()
+
+		serveArtifact(recorder, request, dir)
+
+		assert.Equal(t, http.StatusPartialContent, recorder.Code)
+		assert.Equal(t, "2345", recorder.Body.String())
+	})
+
+	t.Run("OutsideArtifactDir", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodGet, artifactRoute+"../ephemeral.iso", nil)
+		recorder := httptest.NewRecorder()
+
+		serveArtifact(recorder, request, dir)
+
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+}
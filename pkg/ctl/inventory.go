@@ -0,0 +1,80 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package ctl
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+	"opendev.org/airship/airshipui/pkg/log"
+	"sigs.k8s.io/cli-utils/pkg/common"
+	"sigs.k8s.io/cli-utils/pkg/object"
+)
+
+// inventoryID returns the id of the cli-utils inventory that tracks the objects applied by a phase.
+// A bundle can carry its own inventory template, otherwise the applier names the inventory after the phase
+func inventoryID(phaseName string, rendered []*unstructured.Unstructured) string {
+	for _, obj := range rendered {
+		if id, ok := obj.GetLabels()[common.InventoryLabel]; ok {
+			return id
+		}
+	}
+
+	return phaseName
+}
+
+// isInventory determines if a rendered document is the inventory template rather than an object to apply
+func isInventory(obj *unstructured.Unstructured) bool {
+	_, ok := obj.GetLabels()[common.InventoryLabel]
+	return ok
+}
+
+// getInventory returns the objects recorded in the live cli-utils inventory with the given id
+func getInventory(clientSet kubernetes.Interface, id string) ([]object.ObjMetadata, error) {
+	configMaps, err := clientSet.CoreV1().ConfigMaps(metav1.NamespaceAll).List(metav1.ListOptions{
+		LabelSelector: common.InventoryLabel + "=" + id,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []object.ObjMetadata{}
+	for _, cm := range configMaps.Items {
+		for key := range cm.Data {
+			obj, err := object.ParseObjMetadata(key)
+			if err != nil {
+				log.Errorf("Unable to parse inventory entry %s in %s/%s: %s", key, cm.Namespace, cm.Name, err)
+				continue
+			}
+			objects = append(objects, obj)
+		}
+	}
+
+	return objects, nil
+}
+
+// objectNamespace returns the namespace an object lives in, namespaced objects without one land in default
+func objectNamespace(mapping *meta.RESTMapping, namespace string) string {
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return ""
+	}
+
+	if namespace == "" {
+		return metav1.NamespaceDefault
+	}
+
+	return namespace
+}
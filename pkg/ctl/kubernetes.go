@@ -0,0 +1,67 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package ctl
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// restConfig builds the rest config for the cluster defined by the kubeconfig of the current airship context
+func (c *Client) restConfig() (*rest.Config, error) {
+	context, err := c.Config.GetCurrentContext()
+	if err != nil {
+		return nil, err
+	}
+
+	rules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: c.Config.KubeConfigPath()}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: context.NameInKubeconf}
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+}
+
+// kubeClients returns the typed and dynamic kubernetes clients for the cluster of the current airship context
+func (c *Client) kubeClients() (kubernetes.Interface, dynamic.Interface, error) {
+	restConfig, err := c.restConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clientSet, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return clientSet, dynamicClient, nil
+}
+
+// restMapper returns a mapper built from the api groups and resources the cluster serves
+func restMapper(clientSet kubernetes.Interface) (meta.RESTMapper, error) {
+	groupResources, err := restmapper.GetAPIGroupResources(clientSet.Discovery())
+	if err != nil {
+		return nil, err
+	}
+
+	return restmapper.NewDiscoveryRESTMapper(groupResources), nil
+}
@@ -0,0 +1,262 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package ctl
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"opendev.org/airship/airshipctl/pkg/phase/ifc"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/status"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// the number of events returned when drilling down on a live object
+	maxEvents = 20
+)
+
+var (
+	// liveIndex keeps track of the live objects handed to the UI so they can be looked up again on drill down
+	// The ID is derived from the object so every session listing it gets the same one and the index only grows
+	// with the objects in the inventories
+	liveIndex = map[string]ObjectRef{}
+	liveMutex sync.RWMutex
+)
+
+// LiveObject is an object applied by a phase along with its kstatus health
+type LiveObject struct {
+	ID string `json:"id"`
+	ObjectRef
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// LiveEvent is a kubernetes event recorded against a live object
+type LiveEvent struct {
+	Type     string `json:"type"`
+	Reason   string `json:"reason"`
+	Message  string `json:"message"`
+	Count    int32  `json:"count"`
+	LastSeen int64  `json:"lastSeen"`
+}
+
+// GetLiveObjects returns the live objects tracked by the inventory of a phase with their health
+func (c *Client) GetLiveObjects(id string) ([]LiveObject, error) {
+	phaseID := ifc.ID{}
+
+	err := json.Unmarshal([]byte(id), &phaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle, err := c.getPhaseBundle(phaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered, err := bundleObjects(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	clientSet, dynamicClient, err := c.kubeClients()
+	if err != nil {
+		return nil, err
+	}
+
+	mapper, err := restMapper(clientSet)
+	if err != nil {
+		return nil, err
+	}
+
+	return listLiveObjects(clientSet, dynamicClient, mapper, inventoryID(phaseID.Name, rendered))
+}
+
+// GetLiveObject returns the name, live YAML and recent events of an object returned by GetLiveObjects
+func (c *Client) GetLiveObject(id string) (string, string, []LiveEvent, error) {
+	liveMutex.RLock()
+	ref, ok := liveIndex[id]
+	liveMutex.RUnlock()
+	if !ok {
+		return "", "", nil, fmt.Errorf("live object with ID '%s' not found", id)
+	}
+
+	clientSet, dynamicClient, err := c.kubeClients()
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	mapper, err := restMapper(clientSet)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return getLiveObject(clientSet, dynamicClient, mapper, ref)
+}
+
+// listLiveObjects fetches every object in the inventory and computes its kstatus
+func listLiveObjects(clientSet kubernetes.Interface, dynamicClient dynamic.Interface, mapper meta.RESTMapper,
+	invID string) ([]LiveObject, error) {
+	inventory, err := getInventory(clientSet, invID)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []LiveObject{}
+	for _, obj := range inventory {
+		liveObject := LiveObject{
+			ObjectRef: ObjectRef{
+				Group:     obj.GroupKind.Group,
+				Kind:      obj.GroupKind.Kind,
+				Namespace: obj.Namespace,
+				Name:      obj.Name,
+			},
+			Status: string(status.NotFoundStatus),
+		}
+		liveObject.ID = liveID(liveObject.ObjectRef)
+
+		live, err := getLive(dynamicClient, mapper, &liveObject.ObjectRef)
+		switch {
+		case err == nil:
+			result, err := status.Compute(live)
+			if err != nil {
+				liveObject.Status = string(status.UnknownStatus)
+				liveObject.Message = err.Error()
+			} else {
+				liveObject.Status = string(result.Status)
+				liveObject.Message = result.Message
+			}
+		case apierrors.IsNotFound(err) || meta.IsNoMatchError(err):
+			// the object is tracked, but it isn't there
+		default:
+			return nil, err
+		}
+
+		liveMutex.Lock()
+		liveIndex[liveObject.ID] = liveObject.ObjectRef
+		liveMutex.Unlock()
+		objects = append(objects, liveObject)
+	}
+
+	return objects, nil
+}
+
+// liveID identifies the object, the version is left out as it's whatever the cluster serves it at
+func liveID(ref ObjectRef) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(
+		[]string{ref.Group, ref.Kind, ref.Namespace, ref.Name}, "/")))
+}
+
+// getLiveObject returns the name, base64 encoded live YAML and the most recent events of an object
+func getLiveObject(clientSet kubernetes.Interface, dynamicClient dynamic.Interface, mapper meta.RESTMapper,
+	ref ObjectRef) (string, string, []LiveEvent, error) {
+	live, err := getLive(dynamicClient, mapper, &ref)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	// managed fields are noise for anyone reading the yaml
+	unstructured.RemoveNestedField(live.Object, "metadata", "managedFields")
+
+	bytes, err := yaml.Marshal(live.Object)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	events, err := getEvents(clientSet, ref)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return ref.Name, base64.StdEncoding.EncodeToString(bytes), events, nil
+}
+
+// getLive fetches the live object for the ref, filling in the version the cluster serves it at
+func getLive(dynamicClient dynamic.Interface, mapper meta.RESTMapper,
+	ref *ObjectRef) (*unstructured.Unstructured, error) {
+	mapping, err := mapper.RESTMapping(schema.GroupKind{Group: ref.Group, Kind: ref.Kind})
+	if err != nil {
+		return nil, err
+	}
+
+	ref.Version = mapping.GroupVersionKind.Version
+	return dynamicClient.Resource(mapping.Resource).Namespace(ref.Namespace).Get(ref.Name, metav1.GetOptions{})
+}
+
+// getEvents returns the most recent events recorded against an object
+func getEvents(clientSet kubernetes.Interface, ref ObjectRef) ([]LiveEvent, error) {
+	selector := fields.Set{
+		"involvedObject.kind": ref.Kind,
+		"involvedObject.name": ref.Name,
+	}.AsSelector().String()
+
+	list, err := clientSet.CoreV1().Events(ref.Namespace).List(metav1.ListOptions{FieldSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	items := []corev1.Event{}
+	for _, e := range list.Items {
+		// not every client honors the field selector, so double check
+		if e.InvolvedObject.Kind == ref.Kind && e.InvolvedObject.Name == ref.Name {
+			items = append(items, e)
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return eventTime(items[i]).After(eventTime(items[j]))
+	})
+
+	if len(items) > maxEvents {
+		items = items[:maxEvents]
+	}
+
+	events := []LiveEvent{}
+	for _, e := range items {
+		events = append(events, LiveEvent{
+			Type:     e.Type,
+			Reason:   e.Reason,
+			Message:  e.Message,
+			Count:    e.Count,
+			LastSeen: eventTime(e).UnixNano() / 1000000,
+		})
+	}
+
+	return events, nil
+}
+
+// eventTime returns the last time an event was seen, newer event sources only set the event time
+func eventTime(e corev1.Event) time.Time {
+	if !e.LastTimestamp.IsZero() {
+		return e.LastTimestamp.Time
+	}
+
+	return e.EventTime.Time
+}
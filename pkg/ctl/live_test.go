@@ -0,0 +1,99 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package ctl
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/cli-utils/pkg/common"
+)
+
+func TestListLiveObjects(t *testing.T) {
+	now := time.Now()
+	clientSet := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "inventory",
+				Namespace: "airshipit",
+				Labels:    map[string]string{common.InventoryLabel: "test-phase"},
+			},
+			Data: map[string]string{
+				"default_settings__ConfigMap":  "",
+				"default_gone__ServiceAccount": "",
+			},
+		},
+		testEvent("old", "settings", now.Add(-time.Hour)),
+		testEvent("new", "settings", now),
+		testEvent("other", "someone-else", now),
+	)
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		testObject("v1", "ConfigMap", "settings", nil),
+	)
+
+	objects, err := listLiveObjects(clientSet, dynamicClient, testRESTMapper(), "test-phase")
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+
+	statuses := map[string]string{}
+	for _, obj := range objects {
+		statuses[obj.Name] = obj.Status
+		assert.Contains(t, liveIndex, obj.ID)
+	}
+	assert.Equal(t, map[string]string{"settings": "Current", "gone": "NotFound"}, statuses)
+
+	// listing again hands out the same IDs, the ones already given out stay good
+	again, err := listLiveObjects(clientSet, dynamicClient, testRESTMapper(), "test-phase")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, objects, again)
+
+	name, yaml, events, err := getLiveObject(clientSet, dynamicClient, testRESTMapper(),
+		ObjectRef{Kind: "ConfigMap", Namespace: "default", Name: "settings"})
+	require.NoError(t, err)
+	assert.Equal(t, "settings", name)
+
+	decoded, err := base64.StdEncoding.DecodeString(yaml)
+	require.NoError(t, err)
+	assert.Contains(t, string(decoded), "name: settings")
+
+	require.Len(t, events, 2)
+	assert.Equal(t, "new", events[0].Reason)
+	assert.Equal(t, "old", events[1].Reason)
+}
+
+func testEvent(reason, objectName string, seen time.Time) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      objectName + "." + reason,
+			Namespace: "default",
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:      "ConfigMap",
+			Namespace: "default",
+			Name:      objectName,
+		},
+		Reason:        reason,
+		Type:          corev1.EventTypeNormal,
+		LastTimestamp: metav1.NewTime(seen),
+	}
+}
@@ -16,6 +16,7 @@ package ctl
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -23,22 +24,29 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"opendev.org/airship/airshipui/pkg/webservice"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 	"opendev.org/airship/airshipctl/pkg/document"
 	"opendev.org/airship/airshipctl/pkg/events"
 	"opendev.org/airship/airshipctl/pkg/phase"
 	"opendev.org/airship/airshipctl/pkg/phase/ifc"
 	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/metrics"
 	"opendev.org/airship/airshipui/pkg/task"
+	"opendev.org/airship/airshipui/pkg/tracing"
 )
 
+// docIndex is replaced by every search of the documents while other requests read from it, it's guarded
+// by the docMutex
 var (
 	fileIndex map[string]string
 	docIndex  map[string]document.Document
+	docMutex  sync.RWMutex
 )
 
 // HandlePhaseRequest will flop between requests so we don't have to have them all mapped as function calls
@@ -67,7 +75,7 @@ func HandlePhaseRequest(user *string, request configs.WsMessage) configs.WsMessa
 	case configs.Run:
 		err = client.RunPhase(request)
 	case configs.ValidatePhase:
-		valid, err = client.ValidatePhase(request.ID, request.SessionID)
+		valid, err = client.ValidatePhase(request.ID, request.SessionID, request.RequestID)
 		message = validateHelper(valid)
 	case configs.YamlWrite:
 		response.Name, response.YAML, err = client.writeYamlFile(id, request.YAML)
@@ -91,6 +99,12 @@ func HandlePhaseRequest(user *string, request configs.WsMessage) configs.WsMessa
 		response.Name, response.YAML, err = client.GetExecutorDoc(id)
 	case configs.GetPhaseSourceFiles:
 		response.Data, err = client.getPhaseSource(id)
+	case configs.GetDrift:
+		response.Data, err = client.GetPhaseDrift(id)
+	case configs.GetLiveObjects:
+		response.Data, err = client.GetLiveObjects(id)
+	case configs.GetLiveObject:
+		response.Name, response.YAML, response.Data, err = client.GetLiveObject(id)
 	default:
 		err = fmt.Errorf("Subcomponent %s not found", request.SubComponent)
 	}
@@ -185,7 +199,7 @@ func (c *Client) getYaml(id, message string) (string, string, error) {
 }
 
 func (c *Client) getDocumentYaml(id string) (string, string, error) {
-	doc, ok := docIndex[id]
+	doc, ok := indexedDocument(id)
 	if !ok {
 		return "", "", fmt.Errorf("document with ID '%s' not found", id)
 	}
@@ -240,7 +254,16 @@ func (c *Client) writeYamlFile(id, yaml64 string) (string, string, error) {
 	return c.getFileYaml(id)
 }
 
-func getPhaseBundle(id ifc.ID) (document.Bundle, error) {
+func (c *Client) getPhaseBundle(id ifc.ID) (document.Bundle, error) {
+	_, span := tracing.StartSpan(c.trace, "render bundle", attribute.String("phase", id.Name))
+	defer span.End()
+
+	b, err := renderPhaseBundle(id)
+	tracing.RecordError(span, err)
+	return b, err
+}
+
+func renderPhaseBundle(id ifc.ID) (document.Bundle, error) {
 	helper, err := getHelper()
 	if err != nil {
 		return nil, err
@@ -286,7 +309,7 @@ func (c *Client) GetPhase(id string) (string, string, string, error) {
 		return "", "", "", err
 	}
 
-	bundle, err := getPhaseBundle(phaseID)
+	bundle, err := c.getPhaseBundle(phaseID)
 	if err != nil {
 		return "", "", "", err
 	}
@@ -325,7 +348,9 @@ type GVK struct {
 // GetDocumentsBySelector returns a slice of KustomNodes representing all phase
 // documents returned by applying the provided Selector
 func GetDocumentsBySelector(id string, data string) ([]KustomNode, error) {
+	docMutex.Lock()
 	docIndex = map[string]document.Document{}
+	docMutex.Unlock()
 
 	selector, err := getSelector(data)
 	if err != nil {
@@ -366,6 +391,7 @@ func GetDocumentsBySelector(id string, data string) ([]KustomNode, error) {
 	}
 
 	results := []KustomNode{}
+	index := map[string]document.Document{}
 
 	for _, doc := range docs {
 		// this is a workaround for a kustomize issue where cluster-scoped objects
@@ -376,26 +402,29 @@ func GetDocumentsBySelector(id string, data string) ([]KustomNode, error) {
 		}
 
 		id := uuid.New().String()
-		docIndex[id] = doc
-
-		name := doc.GetNamespace()
-		if name == "" {
-			name = "[none]"
-		}
+		index[id] = doc
 
 		results = append(results, KustomNode{
-			ID: id,
-			Name: fmt.Sprintf("%s/%s/%s",
-				name,
-				doc.GetKind(),
-				doc.GetName(),
-			)},
-		)
+			ID:   id,
+			Name: documentName(doc),
+		})
 	}
 
+	docMutex.Lock()
+	docIndex = index
+	docMutex.Unlock()
+
 	return results, nil
 }
 
+// indexedDocument is the document with the ID from the last search
+func indexedDocument(id string) (document.Document, bool) {
+	docMutex.RLock()
+	defer docMutex.RUnlock()
+	doc, ok := docIndex[id]
+	return doc, ok
+}
+
 func getSelector(data string) (document.Selector, error) {
 	params := SelectorParams{}
 	err := json.Unmarshal([]byte(data), &params)
@@ -434,7 +463,7 @@ func getSelector(data string) (document.Selector, error) {
 // ValidatePhase validates the specified phase
 // (ifc.Phase.Validate isn't implemented yet, so this function
 // currently always returns "valid")
-func (c *Client) ValidatePhase(id, sessionID string) (bool, error) {
+func (c *Client) ValidatePhase(id, sessionID, requestID string) (bool, error) {
 	phaseID := ifc.ID{}
 	err := json.Unmarshal([]byte(id), &phaseID)
 	if err != nil {
@@ -444,7 +473,7 @@ func (c *Client) ValidatePhase(id, sessionID string) (bool, error) {
 	// probably not needed for validate, but let's create one anyway
 	taskid := uuid.New().String()
 
-	phaseIfc, err := getPhaseIfc(phaseID, taskid, sessionID)
+	phaseIfc, err := getPhaseIfc(c.trace, phaseID, taskid, sessionID, requestID)
 	if err != nil {
 		return false, err
 	}
@@ -469,7 +498,7 @@ func (c *Client) RunPhase(request configs.WsMessage) error {
 
 	taskID := uuid.New().String()
 
-	phaseIfc, err := getPhaseIfc(phaseID, taskID, request.SessionID)
+	phaseIfc, err := getPhaseIfc(c.trace, phaseID, taskID, request.SessionID, request.RequestID)
 	if err != nil {
 		return err
 	}
@@ -491,6 +520,7 @@ func (c *Client) RunPhase(request configs.WsMessage) error {
 	// send initial TaskStart message to create task on frontend
 	msg := configs.WsMessage{
 		SessionID:    request.SessionID,
+		RequestID:    request.RequestID,
 		Type:         configs.UI,
 		Component:    configs.Task,
 		SubComponent: configs.TaskStart,
@@ -503,23 +533,36 @@ func (c *Client) RunPhase(request configs.WsMessage) error {
 		},
 	}
 
-	err = webservice.WebSocketSend(msg)
+	err = webservice.Publish(msg, webservice.TaskTopic(taskID), webservice.PhaseTopic(name))
 	if err != nil {
 		return err
 	}
 
-	return phaseIfc.Run(opts)
+	metrics.TaskStarted()
+	defer metrics.TaskEnded()
+
+	_, span := tracing.StartSpan(c.trace, "phase run",
+		attribute.String("phase", name), attribute.String("task.id", taskID))
+	err = phaseIfc.Run(opts)
+	tracing.RecordError(span, err)
+	span.End()
+	metrics.ObservePhaseRun(name, err == nil)
+
+	return err
 }
 
 // helper function to return a Phase interface based on a JSON
 // string representation of an ifc.ID value
-func getPhaseIfc(phaseID ifc.ID, taskID, sessionID string) (ifc.Phase, error) {
+func getPhaseIfc(trace context.Context, phaseID ifc.ID, taskID, sessionID, requestID string) (ifc.Phase, error) {
+	_, span := tracing.StartSpan(trace, "create helper")
 	helper, err := getHelper()
+	tracing.RecordError(span, err)
+	span.End()
 	if err != nil {
 		return nil, err
 	}
 
-	tsk := task.NewTask(sessionID, taskID, phaseID.Name)
+	tsk := task.NewTask(sessionID, taskID, requestID, phaseID.Name, webservice.PhaseTopic(phaseID.Name))
 
 	var procFunc phase.ProcessorFunc
 	procFunc = func() events.EventProcessor {
@@ -0,0 +1,192 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package ctl
+
+import (
+	"fmt"
+
+	ctlconfig "opendev.org/airship/airshipctl/pkg/config"
+	"opendev.org/airship/airshipctl/pkg/phase/ifc"
+	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/schema"
+	"opendev.org/airship/airshipui/pkg/statistics"
+)
+
+// historyExportRequest is what the data of a history export holds, the query and the format it's exported in
+type historyExportRequest struct {
+	statistics.Query
+	historyExport
+}
+
+// ctlMessages describes the ctl messages that need more than the type, component and subcomponent, the schemas
+// of these are published and the messages are validated against them before they're handled
+func ctlMessages() []schema.Message {
+	messages := []schema.Message{
+		// config
+		{
+			Component:    configs.CTLConfig,
+			SubComponent: configs.SetContext,
+			Description:  "Creates or modifies a context",
+			Required:     []string{"name", "data"},
+			Data:         ctlconfig.ContextOptions{},
+		},
+		{
+			Component:    configs.CTLConfig,
+			SubComponent: configs.SetEncryptionConfig,
+			Description:  "Creates or modifies an encryption config",
+			Required:     []string{"name", "data"},
+			Data:         ctlconfig.EncryptionConfigOptions{},
+		},
+		{
+			Component:    configs.CTLConfig,
+			SubComponent: configs.SetManagementConfig,
+			Description:  "Creates or modifies a management config",
+			Required:     []string{"name", "data"},
+			Data:         ctlconfig.ManagementConfiguration{},
+		},
+		{
+			Component:    configs.CTLConfig,
+			SubComponent: configs.SetManifest,
+			Description:  "Creates or modifies a manifest",
+			Required:     []string{"name", "data"},
+			Data:         ctlconfig.ManifestOptions{},
+		},
+		{
+			Component:    configs.CTLConfig,
+			SubComponent: configs.UseContext,
+			Description:  "Switches the current context",
+			Required:     []string{"name"},
+		},
+
+		// phase
+		{
+			Component:    configs.Phase,
+			SubComponent: configs.Run,
+			Description:  "Runs a phase as a task, the id is the JSON of the phase id",
+			Required:     []string{"id"},
+			Data:         ifc.RunOptions{},
+		},
+		{
+			Component:    configs.Phase,
+			SubComponent: configs.ValidatePhase,
+			Description:  "Validates a phase, the id is the JSON of the phase id",
+			Required:     []string{"id"},
+		},
+		{
+			Component:    configs.Phase,
+			SubComponent: configs.YamlWrite,
+			Description:  "Saves a document of a phase",
+			Required:     []string{"id", "yaml"},
+		},
+		{
+			Component:    configs.Phase,
+			SubComponent: configs.GetYaml,
+			Description:  "Gets a document of a phase, the message is source or rendered",
+			Required:     []string{"id", "message"},
+		},
+		{
+			Component:    configs.Phase,
+			SubComponent: configs.GetDocumentsBySelector,
+			Description:  "Gets the documents of a phase that match the selector in the message",
+			Required:     []string{"id", "message"},
+		},
+
+		// document
+		{
+			Component:    configs.Document,
+			SubComponent: configs.Plugin,
+			Description:  "Runs a document plugin against the documents of a phase, the id is the JSON of the phase id",
+			Required:     []string{"id"},
+			Data:         PluginRun{},
+		},
+
+		// stream
+		{
+			Component:    configs.Stream,
+			SubComponent: configs.PodLogs,
+			Description:  "Streams the logs of a pod",
+			Required:     []string{"data"},
+			Data:         StreamOptions{},
+		},
+		{
+			Component:    configs.Stream,
+			SubComponent: configs.Events,
+			Description:  "Streams the events of the cluster",
+			Data:         StreamOptions{},
+		},
+		{
+			Component:    configs.Stream,
+			SubComponent: configs.Unsubscribe,
+			Description:  "Stops a stream, the id is the one the subscription returned",
+			Required:     []string{"id"},
+		},
+
+		// history
+		{
+			Component:    configs.History,
+			SubComponent: configs.Export,
+			Description:  "Exports the history as csv or ndjson",
+			Data:         historyExportRequest{},
+		},
+	}
+
+	// the other history requests all take a query
+	for _, sub := range []configs.WsSubComponentType{configs.GetDefaults, configs.GetHistory, configs.GetSuccessRate,
+		configs.GetElapsedPercentiles, configs.GetTopFailures} {
+		messages = append(messages, schema.Message{
+			Component:    configs.History,
+			SubComponent: sub,
+			Description:  "Queries the history",
+			Data:         statistics.Query{},
+		})
+	}
+
+	for i := range messages {
+		messages[i].Type = configs.CTL
+	}
+	return messages
+}
+
+// ctlRequests describes the rest of the ctl messages, the ones that are only the type, component and subcomponent.
+// They're registered so every request the ctl handlers know is in the registry, anything else is made up
+func ctlRequests() []schema.Message {
+	requests := []struct {
+		component     configs.WsComponentType
+		subComponents []configs.WsSubComponentType
+	}{
+		{configs.Baremetal, []configs.WsSubComponentType{configs.GetDefaults, configs.EjectMedia, configs.PowerOff,
+			configs.PowerOn, configs.PowerStatus, configs.Reboot, configs.RemoteDirect}},
+		{configs.Cluster, []configs.WsSubComponentType{configs.GetDefaults, configs.Init, configs.Move,
+			configs.Status}},
+		{configs.Document, []configs.WsSubComponentType{configs.Pull}},
+		{configs.Image, []configs.WsSubComponentType{configs.Generate, configs.GetArtifacts}},
+		{configs.Phase, []configs.WsSubComponentType{configs.GetPhaseTree, configs.GetPhase, configs.GetExecutorDoc,
+			configs.GetPhaseSourceFiles, configs.GetDrift, configs.GetLiveObjects, configs.GetLiveObject}},
+		{configs.Secret, []configs.WsSubComponentType{configs.Generate}},
+	}
+
+	messages := []schema.Message{}
+	for _, request := range requests {
+		for _, sub := range request.subComponents {
+			messages = append(messages, schema.Message{
+				Type:         configs.CTL,
+				Component:    request.component,
+				SubComponent: sub,
+				Description:  fmt.Sprintf("Handled by the %s component", request.component),
+			})
+		}
+	}
+	return messages
+}
@@ -0,0 +1,446 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package ctl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/log"
+	"opendev.org/airship/airshipui/pkg/webservice"
+)
+
+const (
+	// a chatty pod can't be allowed to flood the websocket, so lines are batched up and flushed
+	// at most once per interval, a stream with more than the max lines in an interval waits for the next one
+	flushInterval    = 250 * time.Millisecond
+	maxLinesPerFlush = 100
+
+	// pod log lines can be quite long, e.g. json formatted logs
+	maxLineSize = 1024 * 1024
+
+	// the api server closes watches after a while, a followed stream waits this long before watching again
+	rewatchDelay = time.Second
+)
+
+// subscriptions keeps track of the running streams so they can be unsubscribed
+var (
+	subscriptions = map[string]*subscription{}
+	subMutex      sync.Mutex
+)
+
+// StreamOptions are the options the UI can send when subscribing to a stream
+type StreamOptions struct {
+	Namespace string `json:"namespace,omitempty"`
+	Pod       string `json:"pod,omitempty"`
+	Container string `json:"container,omitempty"`
+	Follow    bool   `json:"follow,omitempty"`
+	SinceTime *int64 `json:"sinceTime,omitempty"` // milliseconds since the epoch
+	TailLines *int64 `json:"tailLines,omitempty"`
+}
+
+// subscription is a single running stream for a session
+type subscription struct {
+	id        string
+	sessionID string
+	cancel    context.CancelFunc
+}
+
+// streamSender batches up the lines of a stream and sends them to the UI at a limited rate
+type streamSender struct {
+	response configs.WsMessage
+	send     func(configs.WsMessage) error
+	lines    []string
+	// closed on every flush, the lines waiting for room in the queue wait on it
+	flushed chan struct{}
+	mutex   sync.Mutex
+}
+
+// HandleStreamRequest subscribes to or unsubscribes from the pod log and event streams of the cluster
+// of the current airship context.  The stream itself is sent asynchronously
+func HandleStreamRequest(user *string, request configs.WsMessage) configs.WsMessage {
+	response := configs.WsMessage{
+		Type:         configs.CTL,
+		Component:    configs.Stream,
+		SubComponent: request.SubComponent,
+	}
+
+	var err error
+	var message *string
+
+	switch request.SubComponent {
+	case configs.PodLogs, configs.Events:
+		response.ID, err = subscribe(request)
+		s := fmt.Sprintf("Subscribed to %s", request.SubComponent)
+		message = &s
+	case configs.Unsubscribe:
+		response.ID = request.ID
+		err = unsubscribe(request.SessionID, request.ID)
+		s := fmt.Sprintf("Unsubscribed from %s", request.ID)
+		message = &s
+	default:
+		err = fmt.Errorf("Subcomponent %s not found", request.SubComponent)
+	}
+
+	if err != nil {
+		e := err.Error()
+		response.Error = &e
+	} else {
+		response.Message = message
+	}
+
+	return response
+}
+
+// subscribe starts a stream for the session and returns the id used to unsubscribe
+func subscribe(request configs.WsMessage) (string, error) {
+	opts := StreamOptions{}
+	if request.Data != nil {
+		bytes, err := json.Marshal(request.Data)
+		if err != nil {
+			return "", err
+		}
+
+		err = json.Unmarshal(bytes, &opts)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if request.SubComponent == configs.PodLogs && opts.Pod == "" {
+		return "", errors.New("No pod defined.  Cannot stream logs")
+	}
+
+	client, err := NewClient(configs.UIConfig.AirshipConfigPath, request)
+	if err != nil {
+		return "", err
+	}
+
+	clientSet, _, err := client.kubeClients()
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := &subscription{
+		id:        uuid.New().String(),
+		sessionID: request.SessionID,
+		cancel:    cancel,
+	}
+
+	subMutex.Lock()
+	subscriptions[sub.id] = sub
+	subMutex.Unlock()
+
+	sender := newStreamSender(configs.WsMessage{
+		Type:         configs.CTL,
+		Component:    configs.Stream,
+		SubComponent: request.SubComponent,
+		SessionID:    request.SessionID,
+		RequestID:    request.RequestID,
+		ID:           sub.id,
+	}, webservice.WebSocketSend)
+
+	go func() {
+		defer sub.close()
+		go sender.run(ctx, cancel)
+
+		var err error
+		if request.SubComponent == configs.PodLogs {
+			err = streamPodLogs(ctx, clientSet, opts, sender)
+		} else {
+			err = streamEvents(ctx, clientSet, opts, sender)
+		}
+
+		sender.end(err)
+	}()
+
+	return sub.id, nil
+}
+
+// unsubscribe stops a running stream, only the session that started the stream can stop it
+func unsubscribe(sessionID, id string) error {
+	subMutex.Lock()
+	sub, ok := subscriptions[id]
+	subMutex.Unlock()
+
+	if !ok || sub.sessionID != sessionID {
+		return fmt.Errorf("Subscription %s not found", id)
+	}
+
+	sub.close()
+	return nil
+}
+
+// close cancels the stream and forgets about it
+func (sub *subscription) close() {
+	sub.cancel()
+
+	subMutex.Lock()
+	delete(subscriptions, sub.id)
+	subMutex.Unlock()
+}
+
+// streamPodLogs sends the log lines of a pod container until the stream ends or is cancelled
+func streamPodLogs(ctx context.Context, clientSet kubernetes.Interface, opts StreamOptions,
+	sender *streamSender) error {
+	logOpts := &corev1.PodLogOptions{
+		Container: opts.Container,
+		Follow:    opts.Follow,
+		TailLines: opts.TailLines,
+	}
+	if opts.SinceTime != nil {
+		since := metav1.NewTime(time.Unix(0, *opts.SinceTime*int64(time.Millisecond)))
+		logOpts.SinceTime = &since
+	}
+
+	stream, err := clientSet.CoreV1().Pods(opts.Namespace).GetLogs(opts.Pod, logOpts).Context(ctx).Stream()
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		if !sender.add(ctx, scanner.Text()) {
+			break
+		}
+	}
+
+	// a cancelled request shows up as a read error, that's not worth reporting
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
+
+// streamEvents sends the events of a namespace, and keeps watching for new ones when following
+func streamEvents(ctx context.Context, clientSet kubernetes.Interface, opts StreamOptions, sender *streamSender) error {
+	list, err := clientSet.CoreV1().Events(opts.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	events := list.Items
+	sort.Slice(events, func(i, j int) bool {
+		return eventTime(events[i]).Before(eventTime(events[j]))
+	})
+
+	if opts.SinceTime != nil {
+		since := time.Unix(0, *opts.SinceTime*int64(time.Millisecond))
+		for len(events) > 0 && eventTime(events[0]).Before(since) {
+			events = events[1:]
+		}
+	}
+
+	if opts.TailLines != nil && int64(len(events)) > *opts.TailLines {
+		events = events[int64(len(events))-*opts.TailLines:]
+	}
+
+	for _, e := range events {
+		if !sender.add(ctx, formatEvent(e)) {
+			return nil
+		}
+	}
+
+	if !opts.Follow {
+		return nil
+	}
+
+	// the watch is started again from the last event seen every time the api server closes it, if the server
+	// no longer has that far back the events are listed again to start from now
+	resourceVersion := list.ResourceVersion
+	for {
+		watcher, err := clientSet.CoreV1().Events(opts.Namespace).Watch(metav1.ListOptions{
+			ResourceVersion:     resourceVersion,
+			AllowWatchBookmarks: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		resourceVersion, err = watchEvents(ctx, watcher, resourceVersion, sender)
+		watcher.Stop()
+		if err != nil || ctx.Err() != nil {
+			return err
+		}
+
+		if resourceVersion == "" {
+			log.Warnf("Events of namespace %s expired before the watch could resume, some may be missing",
+				opts.Namespace)
+			if list, err = clientSet.CoreV1().Events(opts.Namespace).List(metav1.ListOptions{}); err != nil {
+				return err
+			}
+			resourceVersion = list.ResourceVersion
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(rewatchDelay):
+		}
+	}
+}
+
+// watchEvents sends the events of the watch until it's closed, the resource version is the last one seen.
+// It's empty if the watch ended because the version it started from is too old
+func watchEvents(ctx context.Context, watcher watch.Interface, resourceVersion string,
+	sender *streamSender) (string, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return resourceVersion, nil
+		case e, ok := <-watcher.ResultChan():
+			if !ok {
+				return resourceVersion, nil
+			}
+
+			switch e.Type {
+			case watch.Error:
+				err := apierrors.FromObject(e.Object)
+				if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+					return "", nil
+				}
+				return resourceVersion, err
+			case watch.Added, watch.Modified, watch.Bookmark:
+				event, ok := e.Object.(*corev1.Event)
+				if !ok {
+					continue
+				}
+				resourceVersion = event.ResourceVersion
+				if e.Type != watch.Bookmark && !sender.add(ctx, formatEvent(*event)) {
+					return resourceVersion, nil
+				}
+			}
+		}
+	}
+}
+
+// formatEvent turns an event into a single line similar to kubectl get events
+func formatEvent(e corev1.Event) string {
+	return fmt.Sprintf("%s %s %s %s/%s: %s",
+		eventTime(e).Format(time.RFC3339),
+		e.Type,
+		e.Reason,
+		e.InvolvedObject.Kind,
+		e.InvolvedObject.Name,
+		e.Message,
+	)
+}
+
+// newStreamSender creates a sender using the response as the stub for every message
+func newStreamSender(response configs.WsMessage, send func(configs.WsMessage) error) *streamSender {
+	return &streamSender{
+		response: response,
+		send:     send,
+		lines:    []string{},
+		flushed:  make(chan struct{}),
+	}
+}
+
+// add queues up a line to be sent, if the queue is full it waits for the next flush so a stream that's faster
+// than the rate is slowed down instead of losing lines.  It's false if the stream was cancelled while waiting
+func (s *streamSender) add(ctx context.Context, line string) bool {
+	for {
+		s.mutex.Lock()
+		if len(s.lines) < maxLinesPerFlush {
+			s.lines = append(s.lines, line)
+			s.mutex.Unlock()
+			return true
+		}
+		flushed := s.flushed
+		s.mutex.Unlock()
+
+		select {
+		case <-flushed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// run flushes the queued lines every interval until the stream is done
+// if the session has gone away there is no reason to keep the stream open
+func (s *streamSender) run(ctx context.Context, cancel context.CancelFunc) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.flush(); err != nil {
+				log.Errorf("Error sending stream %s, closing it: %s", s.response.ID, err)
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// flush sends all queued lines as a single message and makes room for the lines waiting on it
+func (s *streamSender) flush() error {
+	s.mutex.Lock()
+	lines := s.lines
+	s.lines = []string{}
+	close(s.flushed)
+	s.flushed = make(chan struct{})
+	s.mutex.Unlock()
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	response := s.response
+	response.Data = lines
+	return s.send(response)
+}
+
+// end sends whatever is left and lets the UI know that the stream is done
+func (s *streamSender) end(err error) {
+	if flushErr := s.flush(); flushErr != nil {
+		log.Errorf("Error sending stream %s: %s", s.response.ID, flushErr)
+		return
+	}
+
+	response := s.response
+	response.SubComponent = configs.Unsubscribe
+	if err != nil {
+		e := err.Error()
+		response.Error = &e
+	} else {
+		m := "Stream ended"
+		response.Message = &m
+	}
+
+	if err = s.send(response); err != nil {
+		log.Errorf("Error sending stream %s: %s", s.response.ID, err)
+	}
+}
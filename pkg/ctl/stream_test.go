@@ -0,0 +1,221 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package ctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"opendev.org/airship/airshipui/pkg/configs"
+)
+
+func TestStreamSenderFlush(t *testing.T) {
+	sent := []configs.WsMessage{}
+	sender := newStreamSender(configs.WsMessage{ID: "test"}, func(response configs.WsMessage) error {
+		sent = append(sent, response)
+		return nil
+	})
+
+	// nothing queued, nothing sent
+	require.NoError(t, sender.flush())
+	assert.Empty(t, sent)
+
+	ctx := context.Background()
+	for i := 0; i < maxLinesPerFlush; i++ {
+		require.True(t, sender.add(ctx, "line"))
+	}
+
+	// a full queue holds up the stream until the next flush rather than dropping lines
+	added := make(chan bool)
+	go func() {
+		added <- sender.add(ctx, "one more")
+	}()
+	select {
+	case <-added:
+		t.Fatal("line was added to a full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.NoError(t, sender.flush())
+	assert.True(t, <-added)
+	require.Len(t, sent, 1)
+	assert.Equal(t, "test", sent[0].ID)
+	assert.Len(t, sent[0].Data, maxLinesPerFlush)
+	assert.Nil(t, sent[0].Message)
+
+	sender.end(errors.New("stream broke"))
+	require.Len(t, sent, 3)
+	assert.Equal(t, []string{"one more"}, sent[1].Data)
+	assert.Equal(t, configs.Unsubscribe, sent[2].SubComponent)
+	require.NotNil(t, sent[2].Error)
+	assert.Equal(t, "stream broke", *sent[2].Error)
+}
+
+func TestStreamSenderCancelWhileFull(t *testing.T) {
+	sender := newStreamSender(configs.WsMessage{}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	for i := 0; i < maxLinesPerFlush; i++ {
+		require.True(t, sender.add(ctx, "line"))
+	}
+
+	cancel()
+	assert.False(t, sender.add(ctx, "line"))
+}
+
+func TestStreamSenderCancelOnError(t *testing.T) {
+	sender := newStreamSender(configs.WsMessage{}, func(configs.WsMessage) error {
+		return errors.New("session closed")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sender.add(ctx, "line")
+
+	done := make(chan struct{})
+	go func() {
+		sender.run(ctx, cancel)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sender did not stop after a send error")
+	}
+	assert.Error(t, ctx.Err())
+}
+
+func TestStreamEvents(t *testing.T) {
+	now := time.Now()
+	clientSet := fake.NewSimpleClientset(
+		testEvent("Created", "old", now.Add(-time.Hour)),
+		testEvent("Updated", "first", now.Add(-2*time.Minute)),
+		testEvent("Updated", "second", now.Add(-time.Minute)),
+	)
+
+	sender := newStreamSender(configs.WsMessage{}, nil)
+	since := now.Add(-10*time.Minute).UnixNano() / 1000000
+	tail := int64(1)
+
+	err := streamEvents(context.Background(), clientSet, StreamOptions{
+		Namespace: "default",
+		SinceTime: &since,
+		TailLines: &tail,
+	}, sender)
+	require.NoError(t, err)
+	require.Len(t, sender.lines, 1)
+	assert.Contains(t, sender.lines[0], "ConfigMap/second")
+}
+
+func TestStreamEventsTail(t *testing.T) {
+	// a tail of more lines than are flushed at once all gets there, just over more than one flush
+	now := time.Now()
+	clientSet := fake.NewSimpleClientset()
+	for i := 0; i < 2*maxLinesPerFlush+50; i++ {
+		_, err := clientSet.CoreV1().Events("default").Create(
+			testEvent("Updated", fmt.Sprintf("object-%d", i), now.Add(time.Duration(i)*time.Second)))
+		require.NoError(t, err)
+	}
+
+	var mutex sync.Mutex
+	lines := []string{}
+	messages := 0
+	sender := newStreamSender(configs.WsMessage{}, func(response configs.WsMessage) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if data, ok := response.Data.([]string); ok {
+			lines = append(lines, data...)
+		}
+		messages++
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		sender.run(ctx, cancel)
+		close(done)
+	}()
+
+	tail := int64(2*maxLinesPerFlush + 50)
+	err := streamEvents(ctx, clientSet, StreamOptions{Namespace: "default", TailLines: &tail}, sender)
+	require.NoError(t, err)
+	cancel()
+	<-done
+	sender.end(nil)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Len(t, lines, int(tail))
+	assert.Contains(t, lines[0], "ConfigMap/object-0")
+	assert.Contains(t, lines[tail-1], fmt.Sprintf("ConfigMap/object-%d", tail-1))
+	assert.True(t, messages > 3)
+}
+
+func TestStreamEventsRewatch(t *testing.T) {
+	clientSet := fake.NewSimpleClientset()
+	watchers := make(chan *watch.FakeWatcher, 2)
+	versions := make(chan string, 2)
+	clientSet.PrependWatchReactor("events", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		versions <- action.(k8stesting.WatchAction).GetWatchRestrictions().ResourceVersion
+		w := watch.NewFakeWithChanSize(1, false)
+		watchers <- w
+		return true, w, nil
+	})
+
+	sender := newStreamSender(configs.WsMessage{}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- streamEvents(ctx, clientSet, StreamOptions{Namespace: "default", Follow: true}, sender)
+	}()
+
+	// the api server closes the first watch after an event
+	first := <-watchers
+	<-versions
+	event := testEvent("Created", "first", time.Now())
+	event.ResourceVersion = "5"
+	first.Add(event)
+	first.Stop()
+
+	// the stream carries on from that event instead of ending
+	var second *watch.FakeWatcher
+	select {
+	case second = <-watchers:
+	case <-time.After(5 * time.Second):
+		t.Fatal("events were not watched again")
+	}
+	assert.Equal(t, "5", <-versions)
+	second.Add(testEvent("Created", "second", time.Now()))
+
+	assert.Eventually(t, func() bool {
+		sender.mutex.Lock()
+		defer sender.mutex.Unlock()
+		return len(sender.lines) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+	assert.Contains(t, sender.lines[1], "ConfigMap/second")
+}
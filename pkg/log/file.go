@@ -0,0 +1,141 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package log
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// FileOptions describes the file the logs are written to and how it's rotated
+// The file is rotated when it reaches MaxSize megabytes and, if RotateEvery is set, on that interval
+// Rotated files are gzipped if Compress is set, MaxBackups and MaxAge in days limit how many are kept
+type FileOptions struct {
+	Path        string
+	MaxSize     int
+	MaxBackups  int
+	MaxAge      int
+	RotateEvery time.Duration
+	Compress    bool
+}
+
+// the size in megabytes the file is rotated at if there's no size in the options
+const defaultMaxSize = 100
+
+var (
+	logFile    *lumberjack.Logger
+	stopRotate chan struct{}
+	fileMutex  sync.Mutex
+)
+
+// SetFile sends the logs to the rotated file instead of stderr
+func SetFile(opts FileOptions) error {
+	if opts.Path == "" {
+		return errors.New("no log file path")
+	}
+	if opts.MaxSize < 0 || opts.MaxBackups < 0 || opts.MaxAge < 0 || opts.RotateEvery < 0 {
+		return errors.New("log file limits cannot be negative")
+	}
+
+	size := opts.MaxSize
+	if size == 0 {
+		size = defaultMaxSize
+	}
+
+	file := &lumberjack.Logger{
+		Filename:   opts.Path,
+		MaxSize:    size,
+		MaxBackups: opts.MaxBackups,
+		MaxAge:     opts.MaxAge,
+		Compress:   opts.Compress,
+	}
+
+	// make sure the file can be written now so a bad path is found at startup rather than on the first log
+	if err := os.MkdirAll(filepath.Dir(opts.Path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(opts.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	if err := CloseFile(); err != nil {
+		return err
+	}
+
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	logFile = file
+	writeMutex.Lock()
+	airshipLog.SetOutput(file)
+	writeMutex.Unlock()
+
+	if opts.RotateEvery > 0 {
+		stop := make(chan struct{})
+		stopRotate = stop
+		go rotateEvery(file, opts.RotateEvery, stop)
+	}
+
+	return nil
+}
+
+// CloseFile stops the rotation and closes the log file, the logs go back to stderr
+func CloseFile() error {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	if stopRotate != nil {
+		close(stopRotate)
+		stopRotate = nil
+	}
+
+	if logFile == nil {
+		return nil
+	}
+
+	writeMutex.Lock()
+	airshipLog.SetOutput(os.Stderr)
+	writeMutex.Unlock()
+
+	err := logFile.Close()
+	logFile = nil
+	return err
+}
+
+// rotateEvery rotates the file on the interval until it's stopped
+func rotateEvery(file *lumberjack.Logger, interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := file.Rotate(); err != nil {
+				Errorf("Error rotating the log file: %s", err)
+			}
+		}
+	}
+}
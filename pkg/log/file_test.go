@@ -0,0 +1,94 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package log_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"opendev.org/airship/airshipui/pkg/log"
+)
+
+// backups returns the rotated files next to the log file
+func backups(t *testing.T, dir string) []string {
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, f := range files {
+		if f.Name() != "airshipui.log" {
+			names = append(names, f.Name())
+		}
+	}
+	return names
+}
+
+func TestSetFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "airshipui-log")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "logs", "airshipui.log")
+	require.NoError(t, log.SetFile(log.FileOptions{Path: path, MaxSize: 1, MaxBackups: 1, Compress: true}))
+	defer func() {
+		require.NoError(t, log.CloseFile())
+	}()
+	log.Init(4, log.Writer())
+
+	log.Info("FileViewable")
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "FileViewable")
+
+	// past a megabyte the file is rotated and compressed, only one backup is kept
+	line := strings.Repeat("x", 1024)
+	for i := 0; i < 2500; i++ {
+		log.Info(line)
+	}
+
+	assert.Eventually(t, func() bool {
+		names := backups(t, filepath.Dir(path))
+		return len(names) == 1 && strings.HasSuffix(names[0], ".log.gz")
+	}, 5*time.Second, 50*time.Millisecond)
+
+	assert.Error(t, log.SetFile(log.FileOptions{}))
+	assert.Error(t, log.SetFile(log.FileOptions{Path: path, MaxSize: -1}))
+}
+
+func TestRotateEvery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "airshipui-log")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "airshipui.log")
+	require.NoError(t, log.SetFile(log.FileOptions{Path: path, MaxBackups: 2, RotateEvery: 50 * time.Millisecond}))
+	log.Init(4, log.Writer())
+	log.Info("RotateViewable")
+
+	assert.Eventually(t, func() bool {
+		return len(backups(t, dir)) == 2
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// closing stops the rotation and puts the logs back on stderr
+	require.NoError(t, log.CloseFile())
+	assert.Equal(t, os.Stderr, log.Writer())
+}
@@ -15,16 +15,27 @@
 package log
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
+	"time"
+)
+
+// the formats the logs can be written in
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
 )
 
 var (
-	// LogLevel can specify what level the system runs at
-	LogLevel = 6
+	// LogLevel can specify what level the system runs at, subsystems without a level of their own use it
+	LogLevel = 4
 	levels   = map[int]string{
 		6: "TRACE",
 		5: "DEBUG",
@@ -33,75 +44,172 @@ var (
 		2: "ERROR",
 		1: "FATAL",
 	}
-	airshipLog = log.New(os.Stderr, "[airshipui] ", log.LstdFlags|log.Llongfile)
-	writeMutex sync.Mutex
+	// Subsystems are the parts of the UI that can be given a log level of their own
+	Subsystems = []string{"webservice", "ctl", "statistics", "proxy", "plugin"}
+
+	airshipLog      = log.New(os.Stderr, "[airshipui] ", log.LstdFlags|log.Llongfile)
+	writeMutex      sync.Mutex
+	levelMutex      sync.RWMutex
+	subsystemLevels = map[string]int{}
+	format          = TextFormat
 )
 
+// Fields adds context to a log entry, they're written as fields of their own in the json format
+type Fields struct {
+	SessionID string `json:"sessionID,omitempty"`
+	User      string `json:"user,omitempty"`
+	Component string `json:"component,omitempty"`
+	TaskID    string `json:"taskID,omitempty"`
+	RequestID string `json:"requestID,omitempty"`
+}
+
+// Entry is a logger that adds the fields to everything it writes
+type Entry struct {
+	fields Fields
+}
+
+// jsonEntry is a single line of the json format
+type jsonEntry struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Subsystem string `json:"subsystem,omitempty"`
+	Caller    string `json:"caller"`
+	Message   string `json:"msg"`
+	Fields
+}
+
 // Init initializes settings related to logging
 func Init(levelSet int, out io.Writer) {
+	levelMutex.Lock()
 	LogLevel = levelSet
+	levelMutex.Unlock()
 	airshipLog.SetOutput(out)
 }
 
+// SetFormat switches between the text and json formats
+func SetFormat(f string) error {
+	if f != TextFormat && f != JSONFormat {
+		return fmt.Errorf("unknown log format %s, expected %s or %s", f, TextFormat, JSONFormat)
+	}
+
+	levelMutex.Lock()
+	defer levelMutex.Unlock()
+	format = f
+	return nil
+}
+
+// SetLevels sets the default level and the levels of the subsystems, a subsystem set to 0 goes back to the default
+// Nothing is changed if any of the levels are invalid
+func SetLevels(defaultLevel int, subsystems map[string]int) error {
+	if _, ok := levels[defaultLevel]; !ok {
+		return fmt.Errorf("invalid log level %d, expected 1 - 6", defaultLevel)
+	}
+
+	for subsystem, level := range subsystems {
+		if !isSubsystem(subsystem) {
+			return fmt.Errorf("unknown log subsystem %s, expected one of %s", subsystem, strings.Join(Subsystems, ", "))
+		}
+		if _, ok := levels[level]; !ok && level != 0 {
+			return fmt.Errorf("invalid log level %d for %s, expected 1 - 6", level, subsystem)
+		}
+	}
+
+	levelMutex.Lock()
+	defer levelMutex.Unlock()
+	LogLevel = defaultLevel
+	for subsystem, level := range subsystems {
+		if level == 0 {
+			delete(subsystemLevels, subsystem)
+		} else {
+			subsystemLevels[subsystem] = level
+		}
+	}
+	return nil
+}
+
+// Levels returns the default level and the levels of the subsystems that have their own
+func Levels() (int, map[string]int) {
+	levelMutex.RLock()
+	defer levelMutex.RUnlock()
+
+	subsystems := make(map[string]int, len(subsystemLevels))
+	for subsystem, level := range subsystemLevels {
+		subsystems[subsystem] = level
+	}
+	return LogLevel, subsystems
+}
+
+// Format returns the format the logs are written in
+func Format() string {
+	levelMutex.RLock()
+	defer levelMutex.RUnlock()
+	return format
+}
+
+// WithFields returns a logger that adds the fields to everything it writes
+func WithFields(fields Fields) *Entry {
+	return &Entry{fields: fields}
+}
+
 // Trace is a wrapper for log.Trace
 func Trace(v ...interface{}) {
-	writeLog(6, v...)
+	writeLog(6, nil, v...)
 }
 
 // Tracef is a wrapper for log.Tracef
 func Tracef(format string, v ...interface{}) {
-	writeLog(6, fmt.Sprintf(format, v...))
+	writeLog(6, nil, fmt.Sprintf(format, v...))
 }
 
 // Debug is a wrapper for log.Debug
 func Debug(v ...interface{}) {
-	writeLog(5, v...)
+	writeLog(5, nil, v...)
 }
 
 // Debugf is a wrapper for log.Debugf
 func Debugf(format string, v ...interface{}) {
-	writeLog(5, fmt.Sprintf(format, v...))
+	writeLog(5, nil, fmt.Sprintf(format, v...))
 }
 
 // Info is a wrapper for log.Info
 func Info(v ...interface{}) {
-	writeLog(4, v...)
+	writeLog(4, nil, v...)
 }
 
 // Infof is a wrapper for log.Infof
 func Infof(format string, v ...interface{}) {
-	writeLog(4, fmt.Sprintf(format, v...))
+	writeLog(4, nil, fmt.Sprintf(format, v...))
 }
 
 // Warn is a wrapper for log.Warn
 func Warn(v ...interface{}) {
-	writeLog(3, v...)
+	writeLog(3, nil, v...)
 }
 
 // Warnf is a wrapper for log.Warnf
 func Warnf(format string, v ...interface{}) {
-	writeLog(3, fmt.Sprintf(format, v...))
+	writeLog(3, nil, fmt.Sprintf(format, v...))
 }
 
 // Error is a wrapper for log.Error
 func Error(v ...interface{}) {
-	writeLog(2, v...)
+	writeLog(2, nil, v...)
 }
 
 // Errorf is a wrapper for log.Errorf
 func Errorf(format string, v ...interface{}) {
-	writeLog(2, fmt.Sprintf(format, v...))
+	writeLog(2, nil, fmt.Sprintf(format, v...))
 }
 
 // Fatal is a wrapper for log.Fatal
 func Fatal(v ...interface{}) {
-	writeLog(1, v...)
+	writeLog(1, nil, v...)
 	os.Exit(-1)
 }
 
 // Fatalf is a wrapper for log.Fatalf
 func Fatalf(format string, v ...interface{}) {
-	writeLog(1, fmt.Sprintf(format, v...))
+	writeLog(1, nil, fmt.Sprintf(format, v...))
 	os.Exit(-1)
 }
 
@@ -115,16 +223,157 @@ func Logger() *log.Logger {
 	return airshipLog
 }
 
-func writeLog(level int, v ...interface{}) {
+// Trace writes the entry at the trace level
+func (e *Entry) Trace(v ...interface{}) {
+	writeLog(6, &e.fields, v...)
+}
+
+// Tracef writes the entry at the trace level
+func (e *Entry) Tracef(format string, v ...interface{}) {
+	writeLog(6, &e.fields, fmt.Sprintf(format, v...))
+}
+
+// Debug writes the entry at the debug level
+func (e *Entry) Debug(v ...interface{}) {
+	writeLog(5, &e.fields, v...)
+}
+
+// Debugf writes the entry at the debug level
+func (e *Entry) Debugf(format string, v ...interface{}) {
+	writeLog(5, &e.fields, fmt.Sprintf(format, v...))
+}
+
+// Info writes the entry at the info level
+func (e *Entry) Info(v ...interface{}) {
+	writeLog(4, &e.fields, v...)
+}
+
+// Infof writes the entry at the info level
+func (e *Entry) Infof(format string, v ...interface{}) {
+	writeLog(4, &e.fields, fmt.Sprintf(format, v...))
+}
+
+// Warn writes the entry at the warn level
+func (e *Entry) Warn(v ...interface{}) {
+	writeLog(3, &e.fields, v...)
+}
+
+// Warnf writes the entry at the warn level
+func (e *Entry) Warnf(format string, v ...interface{}) {
+	writeLog(3, &e.fields, fmt.Sprintf(format, v...))
+}
+
+// Error writes the entry at the error level
+func (e *Entry) Error(v ...interface{}) {
+	writeLog(2, &e.fields, v...)
+}
+
+// Errorf writes the entry at the error level
+func (e *Entry) Errorf(format string, v ...interface{}) {
+	writeLog(2, &e.fields, fmt.Sprintf(format, v...))
+}
+
+func writeLog(level int, fields *Fields, v ...interface{}) {
+	// the caller of the wrapper decides which subsystem's level applies
+	_, file, line, _ := runtime.Caller(2)
+	subsystem := subsystemOf(file)
+
+	levelMutex.RLock()
+	threshold, ok := subsystemLevels[subsystem]
+	if !ok {
+		threshold = LogLevel
+	}
+	f := format
+	levelMutex.RUnlock()
+
 	// determine if we need to display the logs
-	if level <= LogLevel {
-		writeMutex.Lock()
-		defer writeMutex.Unlock()
-		// the origionall caller of this is 3 steps back, the output will display who called it
-		err := airshipLog.Output(3, fmt.Sprintf("[%s] %v", levels[level], fmt.Sprint(v...)))
-		if err != nil {
-			airshipLog.Print(v...)
-			airshipLog.Print(err)
+	if level > threshold {
+		return
+	}
+
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	if f == JSONFormat {
+		writeJSON(level, subsystem, file, line, fields, v...)
+		return
+	}
+
+	message := fmt.Sprint(v...)
+	if fields != nil {
+		message = fields.String() + message
+	}
+
+	// the origionall caller of this is 3 steps back, the output will display who called it
+	err := airshipLog.Output(3, fmt.Sprintf("[%s] %v", levels[level], message))
+	if err != nil {
+		airshipLog.Print(v...)
+		airshipLog.Print(err)
+	}
+}
+
+// writeJSON writes the entry as a single line of json
+func writeJSON(level int, subsystem, file string, line int, fields *Fields, v ...interface{}) {
+	entry := jsonEntry{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Level:     levels[level],
+		Subsystem: subsystem,
+		Caller:    fmt.Sprintf("%s/%s:%d", filepath.Base(filepath.Dir(file)), filepath.Base(file), line),
+		Message:   fmt.Sprint(v...),
+	}
+	if fields != nil {
+		entry.Fields = *fields
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		airshipLog.Print(v...)
+		airshipLog.Print(err)
+		return
+	}
+
+	if _, err = airshipLog.Writer().Write(append(b, '\n')); err != nil {
+		airshipLog.Print(v...)
+		airshipLog.Print(err)
+	}
+}
+
+// String puts the fields that are set in front of the message for the text format
+func (f Fields) String() string {
+	var b strings.Builder
+	for _, field := range []struct{ name, value string }{
+		{"session", f.SessionID},
+		{"user", f.User},
+		{"component", f.Component},
+		{"task", f.TaskID},
+		{"request", f.RequestID},
+	} {
+		if field.value != "" {
+			fmt.Fprintf(&b, "[%s=%s] ", field.name, field.value)
+		}
+	}
+	return b.String()
+}
+
+// subsystemOf works out which subsystem the file that's logging belongs to
+// A file named after a subsystem belongs to it, e.g. webservice/proxy.go, otherwise it's the package
+func subsystemOf(file string) string {
+	if name := strings.TrimSuffix(filepath.Base(file), ".go"); isSubsystem(name) {
+		return name
+	}
+
+	if pkg := filepath.Base(filepath.Dir(file)); isSubsystem(pkg) {
+		return pkg
+	}
+
+	return ""
+}
+
+func isSubsystem(name string) bool {
+	for _, subsystem := range Subsystems {
+		if subsystem == name {
+			return true
 		}
 	}
+	return false
 }
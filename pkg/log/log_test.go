@@ -16,6 +16,7 @@ package log_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"regexp"
 	"strings"
 	"testing"
@@ -272,3 +273,78 @@ func TestLoggingError(t *testing.T) {
 		assert.Equal("", output.String())
 	})
 }
+
+func TestLoggingFields(t *testing.T) {
+	output := new(bytes.Buffer)
+	log.Init(4, output)
+
+	log.WithFields(log.Fields{SessionID: "s-1", TaskID: "t-1", RequestID: "r-1"}).Infof("%s %d", "FieldsViewable args", 5)
+	actual := output.String()
+	require.Regexp(t, logFormatRegex, actual)
+	assert.Contains(t, actual, "[INFO] [session=s-1] [task=t-1] [request=r-1] FieldsViewable args 5")
+
+	output.Reset()
+	log.WithFields(log.Fields{User: "a"}).Debug("FieldsNotViewable")
+	assert.Equal(t, "", output.String())
+}
+
+func TestLoggingJSON(t *testing.T) {
+	output := new(bytes.Buffer)
+	log.Init(4, output)
+	require.NoError(t, log.SetFormat(log.JSONFormat))
+	defer func() {
+		require.NoError(t, log.SetFormat(log.TextFormat))
+	}()
+
+	log.WithFields(log.Fields{SessionID: "s-1", User: "a", Component: "phase", TaskID: "t-1",
+		RequestID: "r-1"}).Warn("JSONViewable ", 5)
+	log.Info("JSONNoFields")
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, lines, 2)
+
+	entry := map[string]string{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "WARN", entry["level"])
+	assert.Equal(t, "JSONViewable 5", entry["msg"])
+	assert.Equal(t, "s-1", entry["sessionID"])
+	assert.Equal(t, "a", entry["user"])
+	assert.Equal(t, "phase", entry["component"])
+	assert.Equal(t, "t-1", entry["taskID"])
+	assert.Equal(t, "r-1", entry["requestID"])
+	assert.Regexp(t, `^log/log_test.go:\d+$`, entry["caller"])
+	assert.NotEmpty(t, entry["time"])
+
+	entry = map[string]string{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	assert.Equal(t, "JSONNoFields", entry["msg"])
+	assert.NotContains(t, entry, "sessionID")
+
+	assert.Error(t, log.SetFormat("xml"))
+	assert.Equal(t, log.JSONFormat, log.Format())
+}
+
+func TestSetLevels(t *testing.T) {
+	log.Init(4, new(bytes.Buffer))
+	defer func() {
+		require.NoError(t, log.SetLevels(4, map[string]int{"ctl": 0}))
+	}()
+
+	require.NoError(t, log.SetLevels(3, map[string]int{"ctl": 6}))
+	level, levels := log.Levels()
+	assert.Equal(t, 3, level)
+	assert.Equal(t, map[string]int{"ctl": 6}, levels)
+
+	// nothing changes when any of the levels are bad
+	assert.Error(t, log.SetLevels(7, nil))
+	assert.Error(t, log.SetLevels(5, map[string]int{"nope": 5}))
+	assert.Error(t, log.SetLevels(5, map[string]int{"proxy": 9}))
+	level, levels = log.Levels()
+	assert.Equal(t, 3, level)
+	assert.Equal(t, map[string]int{"ctl": 6}, levels)
+
+	// 0 puts a subsystem back on the default level
+	require.NoError(t, log.SetLevels(3, map[string]int{"ctl": 0}))
+	_, levels = log.Levels()
+	assert.Empty(t, levels)
+}
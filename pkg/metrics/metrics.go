@@ -0,0 +1,192 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/schema"
+)
+
+const (
+	namespace = "airshipui"
+
+	success = "success"
+	failure = "failure"
+
+	// what a label the client made up is counted as, so a client can't create series without end
+	unknown = "unknown"
+)
+
+// the collectors are registered with the default prometheus registry which also brings along the go runtime
+// and process collectors
+var (
+	sessions = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_sessions",
+		Help:      "Number of open websocket sessions.",
+	})
+
+	requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "Number of websocket requests handled by type, component, subcomponent and result.",
+	}, []string{"type", "component", "subcomponent", "result"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to handle websocket requests by type, component and subcomponent.",
+		Buckets:   []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300, 900},
+	}, []string{"type", "component", "subcomponent"})
+
+	queuedRequests = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queued_requests",
+		Help:      "Number of websocket requests waiting for a worker.",
+	})
+
+	activeRequests = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_requests",
+		Help:      "Number of websocket requests being handled by a worker.",
+	})
+
+	rejectedRequests = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rejected_requests_total",
+		Help:      "Number of websocket requests turned away because the queue was full.",
+	})
+
+	runningTasks = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "running_tasks",
+		Help:      "Number of long running tasks in progress, e.g. phase runs and image builds.",
+	})
+
+	phaseRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "phase_runs_total",
+		Help:      "Number of phase runs by phase and result.",
+	}, []string{"phase", "result"})
+
+	baremetalActions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "baremetal_actions_total",
+		Help:      "Number of baremetal actions by action and result.",
+	}, []string{"action", "result"})
+
+	proxyRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "proxy_requests_total",
+		Help:      "Number of requests proxied to dashboards by dashboard, method and status code.",
+	}, []string{"dashboard", "method", "code"})
+)
+
+// Handler returns the http handler that serves the metrics to be scraped
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// SessionOpened counts a new websocket session
+func SessionOpened() {
+	sessions.Inc()
+}
+
+// SessionClosed counts a websocket session going away
+func SessionClosed() {
+	sessions.Dec()
+}
+
+// ObserveRequest records the outcome and duration of a websocket request.  It's only called once a handler was
+// found for the type and component, a subcomponent that isn't in the schema registry is counted as unknown
+func ObserveRequest(request configs.WsMessage, started time.Time, succeeded bool) {
+	subComponent := string(request.SubComponent)
+	if !schema.Registered(request.Type, request.Component, request.SubComponent) {
+		subComponent = unknown
+	}
+
+	requests.WithLabelValues(string(request.Type), string(request.Component), subComponent,
+		result(succeeded)).Inc()
+	requestDuration.WithLabelValues(string(request.Type), string(request.Component), subComponent).
+		Observe(time.Since(started).Seconds())
+}
+
+// RequestQueued counts a websocket request waiting for a worker
+func RequestQueued() {
+	queuedRequests.Inc()
+}
+
+// RequestDequeued counts a websocket request that's no longer waiting, either it got a worker or it was dropped
+func RequestDequeued() {
+	queuedRequests.Dec()
+}
+
+// RequestStarted counts a websocket request being handled by a worker
+func RequestStarted() {
+	activeRequests.Inc()
+}
+
+// RequestFinished counts a websocket request that a worker is done with
+func RequestFinished() {
+	activeRequests.Dec()
+}
+
+// RequestRejected counts a websocket request turned away because the server was busy
+func RequestRejected() {
+	rejectedRequests.Inc()
+}
+
+// TaskStarted counts a long running task as in progress
+func TaskStarted() {
+	runningTasks.Inc()
+}
+
+// TaskEnded counts a long running task as finished regardless of how it finished
+func TaskEnded() {
+	runningTasks.Dec()
+}
+
+// ObservePhaseRun records the outcome of a phase run
+func ObservePhaseRun(phase string, succeeded bool) {
+	phaseRuns.WithLabelValues(phase, result(succeeded)).Inc()
+}
+
+// ObserveBaremetalAction records the outcome of a baremetal action against a single host, an action that isn't
+// in the schema registry is counted as unknown
+func ObserveBaremetalAction(action string, succeeded bool) {
+	if !schema.Registered(configs.CTL, configs.Baremetal, configs.WsSubComponentType(action)) {
+		action = unknown
+	}
+	baremetalActions.WithLabelValues(action, result(succeeded)).Inc()
+}
+
+// InstrumentProxy wraps the proxy handler of a dashboard so the requests to it are counted
+func InstrumentProxy(dashboard string, handler http.Handler) http.Handler {
+	counter := proxyRequests.MustCurryWith(prometheus.Labels{"dashboard": dashboard})
+	return promhttp.InstrumentHandlerCounter(counter, handler)
+}
+
+func result(succeeded bool) string {
+	if succeeded {
+		return success
+	}
+	return failure
+}
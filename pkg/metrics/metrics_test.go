@@ -0,0 +1,86 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/schema"
+)
+
+func TestObserveRequest(t *testing.T) {
+	schema.Register(schema.Message{Type: configs.CTL, Component: configs.Phase, SubComponent: configs.Run})
+	request := configs.WsMessage{
+		Type:         configs.CTL,
+		Component:    configs.Phase,
+		SubComponent: configs.Run,
+	}
+
+	ObserveRequest(request, time.Now(), true)
+	ObserveRequest(request, time.Now(), false)
+	ObserveRequest(request, time.Now(), false)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(requests.WithLabelValues("ctl", "phase", "run", success)))
+	assert.Equal(t, float64(2), testutil.ToFloat64(requests.WithLabelValues("ctl", "phase", "run", failure)))
+
+	// whatever else the client sends is all the one series
+	for _, sub := range []configs.WsSubComponentType{"made-up-1", "made-up-2"} {
+		request.SubComponent = sub
+		ObserveRequest(request, time.Now(), false)
+	}
+	assert.Equal(t, float64(2), testutil.ToFloat64(requests.WithLabelValues("ctl", "phase", unknown, failure)))
+	assert.Equal(t, 3, testutil.CollectAndCount(requests))
+}
+
+func TestObserveBaremetalAction(t *testing.T) {
+	schema.Register(schema.Message{Type: configs.CTL, Component: configs.Baremetal, SubComponent: configs.Reboot})
+
+	ObserveBaremetalAction(string(configs.Reboot), true)
+	ObserveBaremetalAction("made-up", true)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(baremetalActions.WithLabelValues("reboot", success)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(baremetalActions.WithLabelValues(unknown, success)))
+}
+
+func TestInstrumentProxy(t *testing.T) {
+	handler := InstrumentProxy("test", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(proxyRequests.WithLabelValues("test", "get", "418")))
+}
+
+func TestHandler(t *testing.T) {
+	SessionOpened()
+	defer SessionClosed()
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	body, err := ioutil.ReadAll(recorder.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "airshipui_websocket_sessions 1")
+}
@@ -0,0 +1,119 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package plugin runs the components that aren't compiled into the UI.  A plugin is an executable that answers
+// JSON-RPC calls on its stdin and stdout, it says which request type and components it serves and the UI hands it
+// the messages for them
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/log"
+	"opendev.org/airship/airshipui/pkg/webservice"
+)
+
+// defaultTimeout is how long a call to a plugin gets when the config doesn't say
+const defaultTimeout = 30 * time.Second
+
+// plugins are the plugins that were started, by name
+var plugins = map[string]*process{}
+
+// Init starts the plugins in the directory from the config and registers the components they serve.  A plugin
+// that can't be started or doesn't describe itself is left out, the UI works without it
+func Init() error {
+	conf := configs.UIConfig.Plugins
+	if conf == nil || conf.Directory == "" {
+		return nil
+	}
+
+	timeout := defaultTimeout
+	if conf.Timeout != "" {
+		t, err := time.ParseDuration(conf.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid plugin timeout %q: %s", conf.Timeout, err)
+		}
+		if t <= 0 {
+			return fmt.Errorf("invalid plugin timeout %q: must be more than 0", conf.Timeout)
+		}
+		timeout = t
+	}
+
+	paths, err := discover(conf.Directory)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		p := newProcess(path, timeout)
+		if err = register(p); err != nil {
+			log.Errorf("Plugin %s not loaded: %s", path, err)
+			p.stop()
+			continue
+		}
+
+		requestType, components := p.Components()
+		log.Infof("Plugin %s (version %q) serving %s %v", p.name(), p.description.Version, requestType, components)
+	}
+
+	return nil
+}
+
+// register describes the plugin and adds its components and readiness check to the webservice
+func register(p *process) error {
+	if err := p.describe(); err != nil {
+		return err
+	}
+
+	name := p.name()
+	if _, ok := plugins[name]; ok {
+		return fmt.Errorf("there is already a plugin named %s", name)
+	}
+	if err := webservice.AppendComponentHandler(p); err != nil {
+		return err
+	}
+
+	plugins[name] = p
+	webservice.AppendToReadyChecks("plugin "+name, p.health)
+	return nil
+}
+
+// discover finds the executables in the directory, in name order so they're always loaded the same way
+func discover(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("plugin directory: %s", err)
+	}
+
+	var paths []string
+	for _, f := range files {
+		if !f.Mode().IsRegular() || f.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, f.Name()))
+	}
+
+	return paths, nil
+}
+
+// Shutdown stops all the plugins
+func Shutdown() {
+	for _, p := range plugins {
+		p.stop()
+	}
+}
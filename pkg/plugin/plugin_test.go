@@ -0,0 +1,230 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+)
+
+// the test binary is the plugin when this is set, which one it is says what it serves
+const pluginEnv = "AIRSHIPUI_TEST_PLUGIN"
+
+const testType configs.WsRequestType = "cmdb"
+
+type testHandler struct {
+	name string
+}
+
+func (h testHandler) Describe() Description {
+	if h.name == "broken" {
+		return Description{Name: h.name}
+	}
+	return Description{
+		Name:       h.name,
+		Version:    "1.0.0",
+		Type:       testType,
+		Components: []configs.WsComponentType{configs.WsComponentType(h.name)},
+	}
+}
+
+func (h testHandler) Handle(request Request) configs.WsMessage {
+	switch request.Message.ID {
+	case "sleep":
+		time.Sleep(time.Second)
+	case "exit":
+		os.Exit(1)
+	}
+
+	token := "none"
+	if request.Message.Token != nil {
+		token = *request.Message.Token
+	}
+	return configs.WsMessage{
+		Type:         configs.UI,
+		SubComponent: "found",
+		Name:         request.User,
+		ID:           request.Message.ID,
+		Details:      token,
+	}
+}
+
+func (h testHandler) Health() Health {
+	return Health{Status: "ok"}
+}
+
+func TestMain(m *testing.M) {
+	if name := os.Getenv(pluginEnv); name != "" {
+		if err := Serve(testHandler{name: name}); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// writePlugin puts a script that runs the test binary as the plugin in the directory
+func writePlugin(t *testing.T, dir, name string) {
+	script := fmt.Sprintf("#!/bin/sh\n%s=%s exec %q \"$@\"\n", pluginEnv, name, os.Args[0])
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0755))
+}
+
+func testDir(t *testing.T) (string, func()) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test plugins are shell scripts")
+	}
+	dir, err := ioutil.TempDir("", "airshipui-plugins")
+	require.NoError(t, err)
+	return dir, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	dir, cleanup := testDir(t)
+	defer cleanup()
+
+	writePlugin(t, dir, "b")
+	writePlugin(t, dir, "a")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a plugin"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "lib"), 0755))
+
+	paths, err := discover(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}, paths)
+
+	_, err = discover(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestProcess(t *testing.T) {
+	dir, cleanup := testDir(t)
+	defer cleanup()
+	writePlugin(t, dir, "lookup")
+
+	p := newProcess(filepath.Join(dir, "lookup"), 500*time.Millisecond)
+	defer p.stop()
+
+	require.NoError(t, p.describe())
+	requestType, components := p.Components()
+	assert.Equal(t, testType, requestType)
+	assert.Equal(t, []configs.WsComponentType{"lookup"}, components)
+	assert.Equal(t, "lookup", p.name())
+	assert.NoError(t, p.health())
+
+	// the tokens stay with the UI and the response is the component that was asked
+	user, token := "admin", "secret"
+	response := p.Handle(&user, configs.WsMessage{Type: testType, Component: "lookup", ID: "host1", Token: &token})
+	assert.Nil(t, response.Error)
+	assert.Equal(t, testType, response.Type)
+	assert.Equal(t, configs.WsComponentType("lookup"), response.Component)
+	assert.Equal(t, configs.WsSubComponentType("found"), response.SubComponent)
+	assert.Equal(t, "admin", response.Name)
+	assert.Equal(t, "host1", response.ID)
+	assert.Equal(t, "none", response.Details)
+
+	p.mutex.Lock()
+	stuck := p.current
+	p.mutex.Unlock()
+	response = p.Handle(nil, configs.WsMessage{Type: testType, Component: "lookup", ID: "sleep"})
+	require.NotNil(t, response.Error)
+	assert.Contains(t, *response.Error, "did not answer")
+
+	// a plugin that doesn't answer in time is ended and the next call goes to a new one
+	select {
+	case <-stuck.exited:
+	case <-time.After(stopWait + time.Second):
+		t.Fatal("the plugin that didn't answer is still running")
+	}
+	response = p.Handle(nil, configs.WsMessage{Type: testType, Component: "lookup", ID: "host3"})
+	assert.Nil(t, response.Error)
+	assert.Equal(t, "host3", response.ID)
+	p.mutex.Lock()
+	assert.NotEqual(t, stuck, p.current)
+	p.mutex.Unlock()
+
+	// a plugin that goes away is started again, unless it's only just been started
+	response = p.Handle(nil, configs.WsMessage{Type: testType, Component: "lookup", ID: "exit"})
+	require.NotNil(t, response.Error)
+	assert.Contains(t, *response.Error, errExited.Error())
+
+	response = p.Handle(nil, configs.WsMessage{Type: testType, Component: "lookup", ID: "host2"})
+	require.NotNil(t, response.Error)
+	assert.Contains(t, *response.Error, "after it was started")
+
+	p.mutex.Lock()
+	p.current.started = p.current.started.Add(-restartBackoff)
+	p.mutex.Unlock()
+	response = p.Handle(nil, configs.WsMessage{Type: testType, Component: "lookup", ID: "host2"})
+	assert.Nil(t, response.Error)
+	assert.Equal(t, "host2", response.ID)
+}
+
+func TestInit(t *testing.T) {
+	dir, cleanup := testDir(t)
+	defer cleanup()
+	// the components stay registered with the webservice, so every run needs a plugin of its own
+	name := fmt.Sprintf("inventory%d", time.Now().UnixNano())
+	writePlugin(t, dir, name)
+	writePlugin(t, dir, "broken")
+
+	old := configs.UIConfig.Plugins
+	defer func() {
+		configs.UIConfig.Plugins = old
+		Shutdown()
+		plugins = map[string]*process{}
+	}()
+
+	configs.UIConfig.Plugins = &configs.Plugins{Directory: dir, Timeout: "often"}
+	assert.Error(t, Init())
+
+	configs.UIConfig.Plugins = &configs.Plugins{Directory: dir, Timeout: "5s"}
+	require.NoError(t, Init())
+
+	// the broken plugin doesn't serve anything so it's left out
+	assert.Len(t, plugins, 1)
+	require.Contains(t, plugins, name)
+
+	// the same components can't be served twice
+	again := newProcess(filepath.Join(dir, name), time.Second)
+	defer again.stop()
+	assert.Error(t, register(again))
+}
+
+func TestEOFReader(t *testing.T) {
+	done := 0
+	r := &eofReader{ReadCloser: ioutil.NopCloser(strings.NewReader("ok")), done: func() { done++ }}
+
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(data))
+	assert.Equal(t, 1, done)
+
+	// done is only called the once
+	require.NoError(t, r.Close())
+	assert.Equal(t, 1, done)
+}
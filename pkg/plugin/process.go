@@ -0,0 +1,324 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/log"
+)
+
+const (
+	// a plugin that exits this soon after it was started isn't started again until it's been this long
+	restartBackoff = 5 * time.Second
+	// how long a plugin gets to exit after its stdin is closed before it's killed
+	stopWait = 5 * time.Second
+	// how long the health check waits, it's part of /readyz which is probed far more often than the call timeout
+	healthTimeout = 2 * time.Second
+)
+
+var errExited = errors.New("plugin exited")
+
+// process is a plugin, it's started again on the next call if it exits
+type process struct {
+	path    string
+	timeout time.Duration
+
+	// the description is set once the plugin has been described, it doesn't change after that
+	description Description
+
+	mutex   sync.Mutex
+	current *instance
+}
+
+// instance is one run of the plugin process
+type instance struct {
+	cmd     *exec.Cmd
+	client  *rpc.Client
+	exited  chan struct{}
+	started time.Time
+}
+
+func newProcess(path string, timeout time.Duration) *process {
+	return &process{path: path, timeout: timeout}
+}
+
+// name is what the plugin is called in the logs and errors
+func (p *process) name() string {
+	if p.description.Name != "" {
+		return p.description.Name
+	}
+	return filepath.Base(p.path)
+}
+
+// start runs the plugin with its stdin and stdout as the connection
+func (p *process) start() (*instance, error) {
+	cmd := exec.Command(p.path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	name := p.name()
+	log.Debugf("Started plugin %s, pid %d", name, cmd.Process.Pid)
+
+	// Wait closes the pipes, so it has to wait until the connection and the logging are done reading them
+	var reading sync.WaitGroup
+	reading.Add(2)
+	output := &eofReader{ReadCloser: stdout, done: reading.Done}
+
+	i := &instance{
+		cmd:     cmd,
+		client:  jsonrpc.NewClient(stdio{ReadCloser: output, WriteCloser: stdin}),
+		exited:  make(chan struct{}),
+		started: time.Now(),
+	}
+	go func() {
+		defer reading.Done()
+		logOutput(name, stderr)
+	}()
+	go func() {
+		reading.Wait()
+		err := cmd.Wait()
+		i.client.Close()
+		close(i.exited)
+		if err != nil {
+			log.Errorf("Plugin %s exited: %s", name, err)
+		} else {
+			log.Debugf("Plugin %s exited", name)
+		}
+	}()
+
+	return i, nil
+}
+
+// running makes sure the plugin is running, starting it if it isn't.  A plugin that exits right after it's
+// started is left alone for a while so it isn't started over and over
+func (p *process) running() (*instance, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if i := p.current; i != nil {
+		select {
+		case <-i.exited:
+			if since := time.Since(i.started); since < restartBackoff {
+				return nil, fmt.Errorf("plugin %s exited %s after it was started", p.name(), since.Round(time.Millisecond))
+			}
+		default:
+			return i, nil
+		}
+	}
+
+	i, err := p.start()
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s could not be started: %s", p.name(), err)
+	}
+	p.current = i
+	return i, nil
+}
+
+// call calls the method of the plugin, waiting for at most the timeout
+func (p *process) call(method string, args, reply interface{}, timeout time.Duration) error {
+	i, err := p.running()
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	call := i.client.Go(method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		if _, ok := call.Error.(rpc.ServerError); ok || call.Error == nil {
+			return call.Error
+		}
+		// the connection only breaks when the plugin is on its way out, it's made sure it's gone so the
+		// next call starts it again
+		p.end(i)
+		return errExited
+	case <-i.exited:
+		return errExited
+	case <-timer.C:
+		// a plugin that doesn't answer is taken to be stuck, ending it fails the call it's still holding and
+		// the next call starts it again
+		p.discard(i)
+		return fmt.Errorf("plugin %s did not answer %s within %s", p.name(), method, timeout)
+	}
+}
+
+// discard ends the instance in the background, it's no longer the one the calls go to
+func (p *process) discard(i *instance) {
+	p.mutex.Lock()
+	if p.current == i {
+		p.current = nil
+	}
+	p.mutex.Unlock()
+
+	go p.end(i)
+}
+
+// end closes the plugin's stdin so it can exit by itself, if it hasn't in a while it's killed
+func (p *process) end(i *instance) {
+	i.client.Close()
+	select {
+	case <-i.exited:
+	case <-time.After(stopWait):
+		log.Warnf("Plugin %s did not exit, killing it", p.name())
+		if err := i.cmd.Process.Kill(); err != nil {
+			log.Errorf("Error killing plugin %s: %s", p.name(), err)
+		}
+		<-i.exited
+	}
+}
+
+// describe asks the plugin what it serves, the components can't be registered without it
+func (p *process) describe() error {
+	var description Description
+	if err := p.call(describeMethod, Empty{}, &description, p.timeout); err != nil {
+		return err
+	}
+
+	if description.Name == "" {
+		description.Name = filepath.Base(p.path)
+	}
+	if description.Type == "" || len(description.Components) == 0 {
+		return fmt.Errorf("plugin %s does not serve any components", description.Name)
+	}
+
+	p.description = description
+	return nil
+}
+
+// Components are the request type and components the plugin serves
+func (p *process) Components() (configs.WsRequestType, []configs.WsComponentType) {
+	return p.description.Type, p.description.Components
+}
+
+// Handle passes the request to the plugin, a plugin that can't be reached gets the UI an error back
+func (p *process) Handle(user *string, request configs.WsMessage) configs.WsMessage {
+	args := Request{Message: request}
+	args.Message.Token = nil
+	args.Message.RefreshToken = nil
+	if user != nil {
+		args.User = *user
+	}
+
+	var response configs.WsMessage
+	if err := p.call(handleMethod, args, &response, p.timeout); err != nil {
+		log.WithFields(log.Fields{
+			SessionID: request.SessionID,
+			Component: string(request.Component),
+			RequestID: request.RequestID,
+		}).Errorf("Plugin %s: %s", p.name(), err)
+
+		e := fmt.Sprintf("Plugin %s: %s", p.name(), err)
+		return configs.WsMessage{
+			Type:         request.Type,
+			Component:    request.Component,
+			SubComponent: request.SubComponent,
+			Error:        &e,
+		}
+	}
+
+	// the response goes back as the component that was asked, whatever the plugin says
+	response.Type = request.Type
+	response.Component = request.Component
+	if response.SubComponent == "" {
+		response.SubComponent = request.SubComponent
+	}
+	return response
+}
+
+// health is the readiness check of the plugin
+func (p *process) health() error {
+	timeout := healthTimeout
+	if p.timeout < timeout {
+		timeout = p.timeout
+	}
+
+	var health Health
+	if err := p.call(healthMethod, Empty{}, &health, timeout); err != nil {
+		return err
+	}
+	if health.Status != "ok" {
+		if health.Detail != "" {
+			return fmt.Errorf("%s: %s", health.Status, health.Detail)
+		}
+		return fmt.Errorf("%s", health.Status)
+	}
+	return nil
+}
+
+// stop ends the plugin if it's running
+func (p *process) stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.current != nil {
+		p.end(p.current)
+	}
+}
+
+// logOutput logs what the plugin writes to stderr
+func logOutput(name string, stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		log.Infof("Plugin %s: %s", name, scanner.Text())
+	}
+}
+
+// eofReader calls done once reading is over, when a read fails or it's closed
+type eofReader struct {
+	io.ReadCloser
+	done func()
+	once sync.Once
+}
+
+func (r *eofReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil {
+		r.once.Do(r.done)
+	}
+	return n, err
+}
+
+func (r *eofReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.done)
+	return err
+}
@@ -0,0 +1,109 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+)
+
+// the methods a plugin serves, they're JSON-RPC 1.0 calls over the stdin and stdout of the plugin process
+const (
+	ServiceName = "Plugin"
+
+	describeMethod = ServiceName + ".Describe"
+	handleMethod   = ServiceName + ".Handle"
+	healthMethod   = ServiceName + ".Health"
+)
+
+// Empty is the argument of the calls that don't need one
+type Empty struct{}
+
+// Description is what the plugin answers Describe with, the request type and components it serves
+type Description struct {
+	Name       string                    `json:"name"`
+	Version    string                    `json:"version,omitempty"`
+	Type       configs.WsRequestType     `json:"type"`
+	Components []configs.WsComponentType `json:"components"`
+}
+
+// Request is what Handle is called with, the message for one of the plugin's components and the user that sent it.
+// The tokens are taken off the message, the UI has already checked them
+type Request struct {
+	User    string            `json:"user,omitempty"`
+	Message configs.WsMessage `json:"message"`
+}
+
+// Health is what the plugin answers Health with, a status other than ok fails the readiness check of the UI
+type Health struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Handler is what a plugin written in Go implements, Serve does the rest
+type Handler interface {
+	Describe() Description
+	Handle(Request) configs.WsMessage
+	Health() Health
+}
+
+// Serve answers the calls of the UI on stdin and stdout until the UI closes stdin.  Anything the plugin wants
+// logged has to go to stderr
+func Serve(handler Handler) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName(ServiceName, &service{handler: handler}); err != nil {
+		return err
+	}
+	server.ServeCodec(jsonrpc.NewServerCodec(stdio{ReadCloser: os.Stdin, WriteCloser: os.Stdout}))
+	return nil
+}
+
+// service adapts the handler to net/rpc
+type service struct {
+	handler Handler
+}
+
+func (s *service) Describe(_ Empty, reply *Description) error {
+	*reply = s.handler.Describe()
+	return nil
+}
+
+func (s *service) Handle(request Request, reply *configs.WsMessage) error {
+	*reply = s.handler.Handle(request)
+	return nil
+}
+
+func (s *service) Health(_ Empty, reply *Health) error {
+	*reply = s.handler.Health()
+	return nil
+}
+
+// stdio joins the reading and writing ends of a process into one connection
+type stdio struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+func (s stdio) Close() error {
+	werr := s.WriteCloser.Close()
+	if err := s.ReadCloser.Close(); err != nil {
+		return err
+	}
+	return werr
+}
@@ -0,0 +1,186 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package schema
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+)
+
+// Message describes a message the backend takes, the message fields it can't do without and the type its data
+// is unmarshalled into, if it has any
+type Message struct {
+	Type         configs.WsRequestType
+	Component    configs.WsComponentType
+	SubComponent configs.WsSubComponentType
+	Description  string
+	Required     []string
+	Data         interface{}
+}
+
+// messages holds the documents of the registered messages by key, the UI messages the webservice handles itself
+// are here from the start and the other packages register theirs when they're initialized
+var (
+	messages = map[string]*Schema{
+		Key(configs.UI, configs.Keepalive, ""): document(Message{
+			Type:        configs.UI,
+			Component:   configs.Keepalive,
+			Description: "Keeps the websocket busy so it isn't timed out",
+		}),
+		Key(configs.UI, configs.Auth, configs.Authenticate): document(Message{
+			Type:         configs.UI,
+			Component:    configs.Auth,
+			SubComponent: configs.Authenticate,
+			Description:  "Logs in with an id and password for a token",
+			Required:     []string{"authentication"},
+		}),
+		Key(configs.UI, configs.Auth, configs.Validate): document(Message{
+			Type:         configs.UI,
+			Component:    configs.Auth,
+			SubComponent: configs.Validate,
+			Description:  "Checks the token is still good",
+			Required:     []string{"token"},
+		}),
+		Key(configs.UI, configs.Task, configs.TaskRemove): document(Message{
+			Type:         configs.UI,
+			Component:    configs.Task,
+			SubComponent: configs.TaskRemove,
+			Description:  "Removes a finished task",
+			Required:     []string{"id"},
+		}),
+		Key(configs.UI, configs.Topic, configs.Subscribe): document(Message{
+			Type:         configs.UI,
+			Component:    configs.Topic,
+			SubComponent: configs.Subscribe,
+			Description:  "Subscribes the session to a topic, task/<id>, node/<name> or phase/<name>",
+			Required:     []string{"token", "topic"},
+		}),
+		Key(configs.UI, configs.Topic, configs.Unsubscribe): document(Message{
+			Type:         configs.UI,
+			Component:    configs.Topic,
+			SubComponent: configs.Unsubscribe,
+			Description:  "Unsubscribes the session from a topic",
+			Required:     []string{"token", "topic"},
+		}),
+	}
+	messageMutex sync.RWMutex
+)
+
+// Key is how the documents are looked up, type/component/subcomponent, e.g. ctl/phase/run
+func Key(t configs.WsRequestType, component configs.WsComponentType,
+	subComponent configs.WsSubComponentType) string {
+	return strings.TrimSuffix(fmt.Sprintf("%s/%s/%s", t, component, subComponent), "/")
+}
+
+// Register adds the documents of the messages, registering a message again replaces its document
+func Register(ms ...Message) {
+	messageMutex.Lock()
+	defer messageMutex.Unlock()
+	for _, m := range ms {
+		messages[Key(m.Type, m.Component, m.SubComponent)] = document(m)
+	}
+}
+
+// Document is the schema of the message of the type, component and subcomponent.  Messages that aren't
+// registered only have to fit the structure every message has
+func Document(t configs.WsRequestType, component configs.WsComponentType,
+	subComponent configs.WsSubComponentType) *Schema {
+	messageMutex.RLock()
+	defer messageMutex.RUnlock()
+	if s, ok := messages[Key(t, component, subComponent)]; ok {
+		return s
+	}
+	return base
+}
+
+// Registered is true when there's a document for the message of the type, component and subcomponent
+func Registered(t configs.WsRequestType, component configs.WsComponentType,
+	subComponent configs.WsSubComponentType) bool {
+	messageMutex.RLock()
+	defer messageMutex.RUnlock()
+	_, ok := messages[Key(t, component, subComponent)]
+	return ok
+}
+
+// Documents are the schemas of all the registered messages by key
+func Documents() map[string]*Schema {
+	messageMutex.RLock()
+	defer messageMutex.RUnlock()
+	documents := make(map[string]*Schema, len(messages))
+	for key, s := range messages {
+		documents[key] = s
+	}
+	return documents
+}
+
+// Validate checks the message as it was decoded from the frame, before it's decoded into a WsMessage, against
+// the document for it.  Anything that isn't a message is checked against the structure every message has
+func Validate(value interface{}) error {
+	t, component, subComponent := keyOf(value)
+	return Document(t, component, subComponent).Validate(value)
+}
+
+// KeyOf is the key of the document of the message as it was decoded from the frame
+func KeyOf(value interface{}) string {
+	return Key(keyOf(value))
+}
+
+// keyOf pulls the type, component and subcomponent out of the decoded message, anything missing is left empty
+func keyOf(value interface{}) (configs.WsRequestType, configs.WsComponentType, configs.WsSubComponentType) {
+	message, _ := value.(map[string]interface{})
+	t, _ := message["type"].(string)
+	component, _ := message["component"].(string)
+	subComponent, _ := message["subComponent"].(string)
+	return configs.WsRequestType(t), configs.WsComponentType(component), configs.WsSubComponentType(subComponent)
+}
+
+// base is the schema of the structure every message has
+var base = func() *Schema {
+	s := Generate(configs.WsMessage{})
+	s.Draft = Draft
+	s.ID = fmt.Sprintf("airshipui/v%d/message", configs.ProtocolVersion)
+	s.Title = "message"
+	s.Required = []string{"type", "component"}
+	return s
+}()
+
+// document builds the schema of the message on top of the structure every message has
+func document(m Message) *Schema {
+	key := Key(m.Type, m.Component, m.SubComponent)
+
+	s := Generate(configs.WsMessage{})
+	s.Draft = Draft
+	s.ID = fmt.Sprintf("airshipui/v%d/%s", configs.ProtocolVersion, key)
+	s.Title = key
+	s.Description = m.Description
+
+	s.Properties["type"].Const = string(m.Type)
+	s.Properties["component"].Const = string(m.Component)
+	s.Required = []string{"type", "component"}
+	if m.SubComponent != "" {
+		s.Properties["subComponent"].Const = string(m.SubComponent)
+		s.Required = append(s.Required, "subComponent")
+	}
+	s.Required = append(s.Required, m.Required...)
+
+	if m.Data != nil {
+		s.Properties["data"] = Generate(m.Data)
+	}
+
+	return s
+}
@@ -0,0 +1,176 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Draft is the JSON Schema draft the documents are written against
+const Draft = "http://json-schema.org/draft-07/schema#"
+
+// the JSON Schema types
+const (
+	objectType  = "object"
+	arrayType   = "array"
+	stringType  = "string"
+	integerType = "integer"
+	numberType  = "number"
+	booleanType = "boolean"
+	nullType    = "null"
+)
+
+// Schema is the subset of JSON Schema the documents are generated with and validated against
+type Schema struct {
+	Draft                string             `json:"$schema,omitempty"`
+	ID                   string             `json:"$id,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 []string           `json:"-"`
+	Format               string             `json:"format,omitempty"`
+	Const                interface{}        `json:"const,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// MarshalJSON writes the type as a string when there's only one, which is how it's usually written
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	type plain Schema
+	out := struct {
+		Type interface{} `json:"type,omitempty"`
+		*plain
+	}{plain: (*plain)(s)}
+
+	switch len(s.Type) {
+	case 0:
+	case 1:
+		out.Type = s.Type[0]
+	default:
+		out.Type = s.Type
+	}
+
+	return json.Marshal(out)
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	durationType  = reflect.TypeOf(time.Duration(0))
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// Generate builds the schema of the JSON the value is marshalled to and unmarshalled from
+func Generate(v interface{}) *Schema {
+	if v == nil {
+		return &Schema{}
+	}
+	return generate(reflect.TypeOf(v), map[reflect.Type]bool{})
+}
+
+// generate works through the type, seen holds the structs being generated so recursive types stop
+func generate(t reflect.Type, seen map[reflect.Type]bool) *Schema {
+	if t.Kind() == reflect.Ptr {
+		s := generate(t.Elem(), seen)
+		if len(s.Type) > 0 {
+			s.Type = append(s.Type, nullType)
+		}
+		return s
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: []string{stringType}, Format: "date-time"}
+	case t == durationType:
+		return &Schema{Type: []string{integerType}, Description: "nanoseconds"}
+	case t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType):
+		// the type decides what its JSON looks like
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: []string{booleanType}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: []string{integerType}}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: []string{numberType}}
+	case reflect.String:
+		return &Schema{Type: []string{stringType}}
+	case reflect.Slice, reflect.Array:
+		// byte slices are base64 strings
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: []string{stringType}}
+		}
+		types := []string{arrayType}
+		if t.Kind() == reflect.Slice {
+			types = append(types, nullType)
+		}
+		return &Schema{Type: types, Items: generate(t.Elem(), seen)}
+	case reflect.Map:
+		return &Schema{Type: []string{objectType, nullType}, AdditionalProperties: generate(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			return &Schema{Type: []string{objectType}}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		s := &Schema{Type: []string{objectType}, Properties: map[string]*Schema{}}
+		addFields(s, t, seen)
+		return s
+	}
+
+	// interfaces can be anything
+	return &Schema{}
+}
+
+// addFields adds the exported fields of the struct to the properties the way encoding/json names them,
+// embedded structs without a name have their fields promoted
+func addFields(s *Schema, t reflect.Type, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addFields(s, ft, seen)
+				continue
+			}
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, ok := s.Properties[name]; !ok {
+			s.Properties[name] = generate(field.Type, seen)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package schema_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/schema"
+)
+
+type embedded struct {
+	Format string `json:"format,omitempty"`
+}
+
+type options struct {
+	embedded
+	Namespace string            `json:"namespace"`
+	Follow    bool              `json:"follow,omitempty"`
+	TailLines *int64            `json:"tailLines,omitempty"`
+	Ratio     float64           `json:"ratio,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Targets   []string          `json:"targets,omitempty"`
+	Since     time.Time         `json:"since,omitempty"`
+	Timeout   time.Duration     `json:"timeout,omitempty"`
+	Anything  interface{}       `json:"anything,omitempty"`
+	Next      *options          `json:"next,omitempty"`
+	Skipped   string            `json:"-"`
+	NoTag     string
+	hidden    string
+}
+
+// decode turns the JSON into what the validation works on
+func decode(t *testing.T, s string) interface{} {
+	var value interface{}
+	require.NoError(t, json.Unmarshal([]byte(s), &value))
+	return value
+}
+
+func TestGenerate(t *testing.T) {
+	s := schema.Generate(options{})
+
+	b, err := json.Marshal(s)
+	require.NoError(t, err)
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &doc))
+	assert.Equal(t, "object", doc["type"])
+
+	properties := doc["properties"].(map[string]interface{})
+	assert.Len(t, properties, 12)
+	assert.NotContains(t, properties, "Skipped")
+	assert.NotContains(t, properties, "hidden")
+	assert.Contains(t, properties, "NoTag")
+
+	expected := map[string]interface{}{
+		"format":    "string",
+		"namespace": "string",
+		"follow":    "boolean",
+		"tailLines": []interface{}{"integer", "null"},
+		"ratio":     "number",
+		"labels":    []interface{}{"object", "null"},
+		"targets":   []interface{}{"array", "null"},
+		"since":     "string",
+		"timeout":   "integer",
+		"next":      []interface{}{"object", "null"},
+	}
+	for name, typ := range expected {
+		assert.Equal(t, typ, properties[name].(map[string]interface{})["type"], name)
+	}
+	assert.NotContains(t, properties["anything"], "type")
+	assert.Equal(t, "date-time", properties["since"].(map[string]interface{})["format"])
+}
+
+func TestValidate(t *testing.T) {
+	s := schema.Generate(options{})
+	s.Required = []string{"namespace"}
+
+	tests := []struct {
+		json string
+		err  string
+	}{
+		{json: `{"namespace": "default", "tailLines": 10, "ratio": 1, "labels": {"a": "b"}, "anything": [1]}`},
+		{json: `{"namespace": "default", "tailLines": null, "targets": null, "next": {"follow": true}}`},
+		{json: `{"follow": true}`, err: "namespace is required"},
+		{json: `{"namespace": 1}`, err: "namespace must be string, not integer"},
+		{json: `{"namespace": "default", "tailLines": 1.5}`, err: "tailLines must be integer or null, not number"},
+		{json: `{"namespace": "default", "labels": {"a": 1}}`, err: "labels.a must be string, not integer"},
+		{json: `{"namespace": "default", "targets": ["a", false]}`, err: "targets[1] must be string, not boolean"},
+		{json: `{"namespace": "default", "next": {"format": "yaml"}}`},
+		{json: `{"namespace": "default", "next": []}`, err: "next must be object or null, not array"},
+		// recursive types are only described to one level
+		{json: `{"namespace": "default", "next": {"next": {"format": []}}}`},
+		{json: `[]`, err: "message must be object, not array"},
+	}
+	for _, tt := range tests {
+		err := s.Validate(decode(t, tt.json))
+		if tt.err == "" {
+			assert.NoError(t, err, tt.json)
+		} else {
+			assert.EqualError(t, err, tt.err, tt.json)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	schema.Register(schema.Message{
+		Type:         configs.CTL,
+		Component:    "test",
+		SubComponent: "run",
+		Required:     []string{"id"},
+		Data:         options{},
+	})
+
+	key := schema.Key(configs.CTL, "test", "run")
+	assert.Equal(t, "ctl/test/run", key)
+	assert.True(t, schema.Registered(configs.CTL, "test", "run"))
+	assert.False(t, schema.Registered(configs.CTL, "test", "walk"))
+	assert.Equal(t, "ui/keepalive", schema.Key(configs.UI, configs.Keepalive, ""))
+
+	documents := schema.Documents()
+	require.Contains(t, documents, key)
+	assert.Contains(t, documents, "ui/topic/subscribe")
+	assert.Equal(t, schema.Draft, documents[key].Draft)
+	assert.Equal(t, fmt.Sprintf("airshipui/v%d/ctl/test/run", configs.ProtocolVersion), documents[key].ID)
+	assert.Equal(t, []string{"type", "component", "subComponent", "id"}, documents[key].Required)
+
+	request := decode(t, `{"type": "ctl", "component": "test", "subComponent": "run"}`)
+	assert.Equal(t, key, schema.KeyOf(request))
+	assert.EqualError(t, schema.Validate(request), "id is required")
+
+	request = decode(t, `{"type": "ctl", "component": "test", "subComponent": "run", "id": "phase",
+		"data": {"namespace": 5}}`)
+	assert.EqualError(t, schema.Validate(request), "data.namespace must be string, not integer")
+
+	request = decode(t, `{"type": "ctl", "component": "test", "subComponent": "run", "id": "phase",
+		"data": {"namespace": "default"}}`)
+	assert.NoError(t, schema.Validate(request))
+
+	// what's checked is what was sent, not what's left of it once it's a WsMessage
+	request = decode(t, `{"type": "ctl", "component": "test", "subComponent": "run", "id": 5}`)
+	assert.EqualError(t, schema.Validate(request), "id must be string, not integer")
+
+	// messages that aren't registered only need the basics
+	assert.NoError(t, schema.Validate(decode(t, `{"type": "ctl", "component": "other"}`)))
+	assert.EqualError(t, schema.Validate(decode(t, `{"type": "ctl"}`)), "component is required")
+	assert.Error(t, schema.Validate(decode(t, `[]`)))
+	assert.Equal(t, "ui/keepalive", schema.KeyOf(decode(t, `{"type": "ui", "component": "keepalive"}`)))
+}
@@ -0,0 +1,143 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package schema
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Validate checks the decoded JSON value, as encoding/json decodes into an interface{}, against the schema
+func (s *Schema) Validate(value interface{}) error {
+	return s.validate(value, "")
+}
+
+func (s *Schema) validate(value interface{}, path string) error {
+	if s.Const != nil && !reflect.DeepEqual(normalize(s.Const), value) {
+		return fmt.Errorf("%s must be %v", describe(path), s.Const)
+	}
+
+	if len(s.Type) > 0 {
+		actual := typeOf(value)
+		if !s.allows(actual) {
+			return fmt.Errorf("%s must be %s, not %s", describe(path), strings.Join(s.Type, " or "), actual)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s is required", describe(join(path, name)))
+			}
+		}
+
+		// go through the keys in order so the same message always gets the same error
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			property, ok := s.Properties[key]
+			if !ok {
+				property = s.AdditionalProperties
+			}
+			if property == nil {
+				continue
+			}
+			if err := property.validate(v[key], join(path, key)); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if s.Items == nil {
+			return nil
+		}
+		for i, item := range v {
+			if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// allows reports if the schema takes values of the type, an integer is a number too
+func (s *Schema) allows(actual string) bool {
+	for _, t := range s.Type {
+		if t == actual || (t == numberType && actual == integerType) {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf is the JSON Schema type of a decoded JSON value
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return nullType
+	case bool:
+		return booleanType
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return integerType
+		}
+		return numberType
+	case string:
+		return stringType
+	case []interface{}:
+		return arrayType
+	case map[string]interface{}:
+		return objectType
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// normalize makes a go value comparable with its decoded JSON, numbers are decoded as float64
+func normalize(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	}
+	return value
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func describe(path string) string {
+	if path == "" {
+		return "message"
+	}
+	return path
+}
@@ -0,0 +1,216 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package statistics
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	sqlite3 "github.com/mutecomm/go-sqlcipher/v4"
+	"opendev.org/airship/airshipui/pkg/log"
+)
+
+// An encrypted statistics database is a SQLCipher database, every page is encrypted with AES-256 as it's written
+// so each insert is on disk as soon as it's committed.  SQLCipher derives the key from the passphrase with
+// PBKDF2-HMAC-SHA512 and a random salt kept at the start of the file
+
+const (
+	// KeyEnv is the environment variable the statistics key can be passed in, it takes precedence over the config
+	KeyEnv = "AIRSHIPUI_STATISTICS_KEY"
+
+	// a plaintext sqlite database starts with this, an encrypted one is random from the first byte
+	sqliteMagic = "SQLite format 3\x00"
+)
+
+var (
+	errNoKey    = fmt.Errorf("statistics database is encrypted, set statistics.key in the config or %s", KeyEnv)
+	errWrongKey = errors.New("statistics database was encrypted with a different key")
+	errNoCipher = errors.New("sqlite was built without SQLCipher, the statistics database can't be encrypted")
+)
+
+// keyedConnector opens connections to the sqlite database that are keyed with the passphrase before anything
+// else is done with them, the key never goes in the data source so it can't end up in a log
+type keyedConnector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+}
+
+func newKeyedConnector(dsn, passphrase string) *keyedConnector {
+	key := "PRAGMA key = " + quote(passphrase)
+	return &keyedConnector{
+		dsn: dsn,
+		driver: &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				_, err := conn.Exec(key, nil)
+				return err
+			},
+		},
+	}
+}
+
+// Connect opens a keyed connection
+func (c *keyedConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+// Driver is the sqlite driver with the hook that keys the connections
+func (c *keyedConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// openEncrypted opens the sqlite database at the path with the passphrase
+// A plaintext database from before there was a key is encrypted the first time it's opened with one
+func openEncrypted(path, passphrase string) (*sql.DB, error) {
+	plaintext, err := isPlaintext(path)
+	if err != nil {
+		return nil, err
+	}
+	if plaintext {
+		if err = encryptPlaintext(path, passphrase); err != nil {
+			return nil, fmt.Errorf("encrypting the statistics database: %s", err)
+		}
+	}
+
+	db := sql.OpenDB(newKeyedConnector(path, passphrase))
+	if err = checkKey(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// checkKey makes sure the database really is encrypted and the key is the one it was encrypted with
+// sqlite without SQLCipher takes PRAGMA key and does nothing with it, which would leave the database in plaintext
+func checkKey(db *sql.DB) error {
+	if ok, err := hasCipher(db); err != nil || !ok {
+		if err == nil {
+			err = errNoCipher
+		}
+		return err
+	}
+
+	// the first read of a database with the wrong key finds it isn't a database at all
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master").Scan(&count); err != nil {
+		log.Debugf("Reading the encrypted statistics database: %s", err)
+		return errWrongKey
+	}
+	return nil
+}
+
+// hasCipher is true when the sqlite the database was opened with is SQLCipher
+func hasCipher(db *sql.DB) (bool, error) {
+	var version string
+	err := db.QueryRow("PRAGMA cipher_version").Scan(&version)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return version != "", err
+}
+
+// encryptPlaintext replaces the plaintext database at the path with an encrypted copy of it
+func encryptPlaintext(path, passphrase string) error {
+	log.Infof("Statistics database %s is not encrypted, encrypting it", path)
+
+	encrypted := path + ".encrypting"
+	if err := os.Remove(encrypted); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	db, err := sql.Open(SQLite, path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if ok, err := hasCipher(db); err != nil || !ok {
+		if err == nil {
+			err = errNoCipher
+		}
+		return err
+	}
+
+	// the attached database only exists for the connection that attached it
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, statement := range []string{
+		fmt.Sprintf("ATTACH DATABASE %s AS encrypted KEY %s", quote(encrypted), quote(passphrase)),
+		"SELECT sqlcipher_export('encrypted')",
+		"DETACH DATABASE encrypted",
+	} {
+		if _, err = conn.ExecContext(context.Background(), statement); err != nil {
+			os.Remove(encrypted)
+			return err
+		}
+	}
+
+	if err = os.Rename(encrypted, path); err != nil {
+		return err
+	}
+
+	// nothing of the plaintext database is left behind beside it
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		if err = os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// isEncrypted is true when the file at the path is an encrypted database, which can't be opened without the key
+func isEncrypted(path string) (bool, error) {
+	magic, err := readMagic(path)
+	return magic != "" && magic != sqliteMagic, err
+}
+
+// isPlaintext is true when the file at the path is a sqlite database that isn't encrypted
+func isPlaintext(path string) (bool, error) {
+	magic, err := readMagic(path)
+	return magic == sqliteMagic, err
+}
+
+// readMagic reads what the file at the path starts with, nothing if there's no file or nothing in it yet
+func readMagic(path string) (string, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(sqliteMagic))
+	n, err := io.ReadFull(file, magic)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return string(magic[:n]), err
+}
+
+// quote makes the value a sql string literal
+func quote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
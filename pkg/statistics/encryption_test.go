@@ -0,0 +1,210 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package statistics
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// requireCipher skips the test when the sqlite driver was built without SQLCipher
+func requireCipher(t *testing.T) {
+	db, err := sql.Open(SQLite, ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ok, err := hasCipher(db)
+	require.NoError(t, err)
+	if !ok {
+		t.Skip("sqlite was built without SQLCipher")
+	}
+}
+
+// insertSecret writes a record with a user and target that shouldn't be readable from the file
+func insertSecret(t *testing.T, s *sqlStore) {
+	user, target := "secret-operator", "secret-host-1"
+	require.NoError(t, s.Insert("baremetal", Record{
+		SubComponent: "reboot",
+		User:         &user,
+		Target:       &target,
+		Started:      1,
+		Elapsed:      1,
+		Stopped:      2,
+	}))
+}
+
+// assertUnreadable checks the file can't be read as a sqlite database and doesn't give anything away
+func assertUnreadable(t *testing.T, path string) {
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	for _, plain := range []string{sqliteMagic, "secret-operator", "secret-host-1", "baremetal", "reboot"} {
+		assert.NotContains(t, string(b), plain)
+	}
+
+	db, err := sql.Open(SQLite, path)
+	require.NoError(t, err)
+	defer db.Close()
+	var count int
+	assert.Error(t, db.QueryRow("SELECT COUNT(*) FROM baremetal").Scan(&count))
+	assert.Error(t, db.QueryRow("SELECT COUNT(*) FROM sqlite_master").Scan(&count))
+}
+
+func tempPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "airshipui-statistics")
+	require.NoError(t, err)
+	return filepath.Join(dir, "statistics.db"), func() { os.RemoveAll(dir) }
+}
+
+func TestEncryption(t *testing.T) {
+	requireCipher(t)
+	path, cleanup := tempPath(t)
+	defer cleanup()
+
+	s, err := newSQLStore(SQLite, path, "test key")
+	require.NoError(t, err)
+	insertSecret(t, s)
+
+	// what's inserted is in the file straight away
+	assertUnreadable(t, path)
+	reader, err := newSQLStore(SQLite, path, "test key")
+	require.NoError(t, err)
+	user := "secret-operator"
+	records, err := reader.Records(Query{User: &user})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "secret-host-1", *records[0].Target)
+	require.NoError(t, reader.Close())
+	require.NoError(t, s.Close())
+
+	// the database can't be opened without the key or with the wrong one
+	_, err = newSQLStore(SQLite, path, "")
+	assert.Equal(t, errNoKey, err)
+	_, err = newSQLStore(SQLite, path, "wrong key")
+	assert.Equal(t, errWrongKey, err)
+
+	// a key with quotes in it is still the key
+	path, cleanup = tempPath(t)
+	defer cleanup()
+	s, err = newSQLStore(SQLite, path, `it's a "key"`)
+	require.NoError(t, err)
+	insertSecret(t, s)
+	require.NoError(t, s.Close())
+	s, err = newSQLStore(SQLite, path, `it's a "key"`)
+	require.NoError(t, err)
+	defer s.Close()
+	records, err = s.Records(Query{})
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+}
+
+func TestEncryptExisting(t *testing.T) {
+	requireCipher(t)
+	path, cleanup := tempPath(t)
+	defer cleanup()
+
+	// a plaintext database from before there was a key
+	s, err := newSQLStore(SQLite, path, "")
+	require.NoError(t, err)
+	insertSecret(t, s)
+	require.NoError(t, s.Close())
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "secret-host-1")
+
+	// opening it with a key encrypts what's there
+	s, err = newSQLStore(SQLite, path, "test key")
+	require.NoError(t, err)
+	assertUnreadable(t, path)
+
+	failures, err := s.TopFailures(Query{})
+	require.NoError(t, err)
+	require.Len(t, failures, 1)
+	assert.Equal(t, "secret-host-1", failures[0].Target)
+	require.NoError(t, s.Close())
+
+	_, err = newSQLStore(SQLite, path, "")
+	assert.Equal(t, errNoKey, err)
+}
+
+func TestEncryptionWithoutCipher(t *testing.T) {
+	db, err := sql.Open(SQLite, ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	ok, err := hasCipher(db)
+	require.NoError(t, err)
+	if ok {
+		t.Skip("sqlite was built with SQLCipher")
+	}
+
+	// the key would be ignored, so the database is refused rather than left in plaintext
+	path, cleanup := tempPath(t)
+	defer cleanup()
+	_, err = newSQLStore(SQLite, path, "test key")
+	assert.Equal(t, errNoCipher, err)
+
+	s, err := newSQLStore(SQLite, path, "")
+	require.NoError(t, err)
+	insertSecret(t, s)
+	require.NoError(t, s.Close())
+	_, err = newSQLStore(SQLite, path, "test key")
+	assert.Error(t, err)
+
+	// the plaintext database is left as it was
+	s, err = newSQLStore(SQLite, path, "")
+	require.NoError(t, err)
+	defer s.Close()
+	records, err := s.Records(Query{})
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+}
+
+func TestEncryptionDriver(t *testing.T) {
+	_, err := newSQLStore(Postgres, "postgres://localhost/airshipui", "test key")
+	assert.Error(t, err)
+}
+
+func TestQuote(t *testing.T) {
+	assert.Equal(t, `'plain'`, quote("plain"))
+	assert.Equal(t, `'it''s'`, quote("it's"))
+}
+
+func TestIsEncrypted(t *testing.T) {
+	path, cleanup := tempPath(t)
+	defer cleanup()
+
+	encrypted, err := isEncrypted(path)
+	require.NoError(t, err)
+	assert.False(t, encrypted)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(sqliteMagic+"rest of the file"), 0600))
+	encrypted, err = isEncrypted(path)
+	require.NoError(t, err)
+	assert.False(t, encrypted)
+	plaintext, err := isPlaintext(path)
+	require.NoError(t, err)
+	assert.True(t, plaintext)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("0123456789abcdef random bytes"), 0600))
+	encrypted, err = isEncrypted(path)
+	require.NoError(t, err)
+	assert.True(t, encrypted)
+}
@@ -0,0 +1,197 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package statistics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the formats the history can be exported in
+const (
+	CSV    = "csv"
+	NDJSON = "ndjson"
+)
+
+// the header of the csv export, the times are written as RFC 3339 in UTC so they can be read by people
+var csvHeader = []string{"component", "subcomponent", "user", "type", "target", "success", "started", "elapsed_ms",
+	"stopped"}
+
+// ContentType returns the mime type of the export format
+func ContentType(format string) string {
+	if format == NDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv"
+}
+
+// Export writes every record that matches the filters of the query to the writer in the format
+// The records are read a page at a time so the whole history never has to be held in memory
+// The number of records written is returned
+func Export(w io.Writer, s Store, q Query, format string) (int, error) {
+	write, flush, err := newExportWriter(w, format)
+	if err != nil {
+		return 0, err
+	}
+
+	q.Limit = maxLimit
+	q.Cursor = ""
+	count := 0
+	for {
+		page, err := s.QueryPage(q)
+		if err != nil {
+			return count, err
+		}
+
+		for _, r := range page.Records {
+			if err = write(r); err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		if err = flush(); err != nil {
+			return count, err
+		}
+
+		if page.Next == "" {
+			return count, nil
+		}
+		q.Cursor = page.Next
+	}
+}
+
+// newExportWriter returns the functions to write a record and flush what has been written in the format
+func newExportWriter(w io.Writer, format string) (func(Record) error, func() error, error) {
+	switch format {
+	case CSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return nil, nil, err
+		}
+
+		write := func(r Record) error {
+			return cw.Write([]string{
+				csvText(r.Component),
+				csvText(string(r.SubComponent)),
+				csvText(stringOrEmpty(r.User)),
+				csvText(stringOrEmpty(r.ActionType)),
+				csvText(stringOrEmpty(r.Target)),
+				strconv.FormatBool(r.Success),
+				formatMillis(r.Started),
+				strconv.FormatInt(r.Elapsed, 10),
+				formatMillis(r.Stopped),
+			})
+		}
+		flush := func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+		return write, flush, nil
+	case NDJSON:
+		encoder := json.NewEncoder(w)
+		write := func(r Record) error {
+			return encoder.Encode(r)
+		}
+		return write, func() error { return nil }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown export format %s, expected %s or %s", format, CSV, NDJSON)
+	}
+}
+
+// ParseQuery reads the history query out of url parameters named the same as the json of the query
+// notBefore and notAfter are milliseconds since the epoch, both of them bound when the transactions started
+func ParseQuery(values url.Values) (Query, error) {
+	q := Query{
+		SortBy: values.Get("sortBy"),
+		Order:  values.Get("order"),
+		Cursor: values.Get("cursor"),
+	}
+
+	int64Param := func(name string) (*int64, error) {
+		v := values.Get(name)
+		if v == "" {
+			return nil, nil
+		}
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %s", name, v)
+		}
+		return &i, nil
+	}
+
+	stringParam := func(name string) *string {
+		v := values.Get(name)
+		if v == "" {
+			return nil
+		}
+		return &v
+	}
+
+	var err error
+	if q.NotBefore, err = int64Param("notBefore"); err != nil {
+		return q, err
+	}
+	if q.NotAfter, err = int64Param("notAfter"); err != nil {
+		return q, err
+	}
+
+	q.User = stringParam("user")
+	q.Component = stringParam("component")
+	q.SubComponent = stringParam("subComponent")
+	q.Target = stringParam("target")
+
+	if v := values.Get("success"); v != "" {
+		success, err := strconv.ParseBool(v)
+		if err != nil {
+			return q, fmt.Errorf("invalid success %s", v)
+		}
+		q.Success = &success
+	}
+
+	if v := values.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil {
+			return q, fmt.Errorf("invalid limit %s", v)
+		}
+	}
+
+	return q, nil
+}
+
+// csvText keeps a spreadsheet from taking the text as a formula, text that starts like one gets a ' in front
+// The users and targets come from the requests so anyone could have put a formula in them
+func csvText(s string) string {
+	if s != "" && strings.ContainsAny(s[:1], "=+-@\t\r") {
+		return "'" + s
+	}
+	return s
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func formatMillis(ms int64) string {
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,103 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package statistics
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportCSV(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *sqlStore) {
+		var buf bytes.Buffer
+		count, err := Export(&buf, s, Query{}, CSV)
+		require.NoError(t, err)
+		assert.Equal(t, 12, count)
+
+		rows, err := csv.NewReader(&buf).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, rows, 13)
+		assert.Equal(t, csvHeader, rows[0])
+		assert.Equal(t, []string{"baremetal", "reboot", "b", "", "node-1", "false",
+			"1970-01-01T00:00:00.2Z", "5", "1970-01-01T00:00:00.205Z"}, rows[1])
+	})
+}
+
+func TestCSVText(t *testing.T) {
+	for _, text := range []string{"=HYPERLINK(\"http://evil\")", "+1", "-1", "@SUM(A1)", "\tx", "\rx"} {
+		assert.Equal(t, "'"+text, csvText(text))
+	}
+	for _, text := range []string{"", "admin", "node-1", "a=b"} {
+		assert.Equal(t, text, csvText(text))
+	}
+}
+
+func TestExportNDJSON(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *sqlStore) {
+		user := "a"
+		var buf bytes.Buffer
+		count, err := Export(&buf, s, Query{User: &user, SortBy: "started", Order: "asc"}, NDJSON)
+		require.NoError(t, err)
+		assert.Equal(t, 10, count)
+
+		scanner := bufio.NewScanner(&buf)
+		started := int64(0)
+		for scanner.Scan() {
+			r := Record{}
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+			assert.Equal(t, "phase", r.Component)
+			assert.Greater(t, r.Started, started)
+			started = r.Started
+		}
+		assert.Equal(t, int64(10), started)
+
+		_, err = Export(&buf, s, Query{}, "xml")
+		assert.Error(t, err)
+	})
+}
+
+func TestParseQuery(t *testing.T) {
+	q, err := ParseQuery(url.Values{
+		"notBefore": {"10"},
+		"user":      {"a"},
+		"success":   {"false"},
+		"sortBy":    {"elapsed"},
+		"limit":     {"5"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), *q.NotBefore)
+	assert.Nil(t, q.NotAfter)
+	assert.Equal(t, "a", *q.User)
+	assert.Nil(t, q.Target)
+	assert.False(t, *q.Success)
+	assert.Equal(t, "elapsed", q.SortBy)
+	assert.Equal(t, 5, q.Limit)
+
+	for _, values := range []url.Values{
+		{"notAfter": {"yesterday"}},
+		{"success": {"maybe"}},
+		{"limit": {"all"}},
+	} {
+		_, err = ParseQuery(values)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,214 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package statistics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"opendev.org/airship/airshipui/pkg/log"
+)
+
+const (
+	// keeps track of the migrations that have been applied to the database
+	schemaCreate = `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer primary key,
+		description text,
+		applied bigint)`
+	schemaVersion = `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`
+	schemaInsert  = `INSERT INTO schema_migrations(version, description, applied) values(?,?,?)`
+
+	// the table structure used for the records in postgres, which has no rowid to page on
+	postgresTableCreate = `CREATE TABLE IF NOT EXISTS table (
+		id bigserial primary key,
+		subcomponent varchar(64) null,
+		"user" varchar(64),
+		type text check(type in ('direct', 'phase')) null,
+		target text null,
+		success smallint default 0,
+		started bigint,
+		elapsed bigint,
+		stopped bigint)`
+
+	// old records are summed up by day in here when the retention policy rolls them up
+	rollupCreate = `CREATE TABLE IF NOT EXISTS rollup (
+		component varchar(64),
+		subcomponent varchar(64),
+		day bigint,
+		total bigint,
+		succeeded bigint,
+		elapsed bigint,
+		PRIMARY KEY (component, subcomponent, day))`
+
+	// holds the key check once the database is encrypted
+	encryptionCreate = `CREATE TABLE IF NOT EXISTS encryption (
+		id integer primary key,
+		value text not null)`
+	encryptionDrop = `DROP TABLE IF EXISTS encryption`
+)
+
+// migration is a single versioned change to the schema
+// Migrations are applied in order and must never change once released, a schema change is always a new migration
+type migration struct {
+	description string
+	statements  []string
+}
+
+// the component tables that existed when the migrations were introduced, later tables come with their own migration
+var initialTables = []string{"baremetal", "cluster", "config", "document", "image", "phase", "secret"}
+
+// sqliteMigrations is the history of the sqlite schema, the version of a migration is its position in the list
+// starting at 1
+var sqliteMigrations = []migration{
+	{
+		// the tables existing installs were created with, so this is a no op for them
+		description: "create the component tables",
+		statements:  perTable(tableCreate, initialTables...),
+	},
+	{
+		description: "index the started and user columns",
+		statements: append(
+			perTable("CREATE INDEX IF NOT EXISTS table_started ON table (started)", initialTables...),
+			perTable("CREATE INDEX IF NOT EXISTS table_user ON table (user)", initialTables...)...),
+	},
+	{
+		description: "create the daily roll up table",
+		statements:  []string{rollupCreate},
+	},
+	{
+		description: "create the encryption key check table",
+		statements:  []string{encryptionCreate},
+	},
+	{
+		// the whole file is encrypted by SQLCipher now, which checks the key itself
+		description: "drop the encryption key check table",
+		statements:  []string{encryptionDrop},
+	},
+}
+
+// postgresMigrations is the history of the postgres schema, the versions line up with the sqlite ones
+var postgresMigrations = []migration{
+	{
+		description: "create the component tables",
+		statements:  perTable(postgresTableCreate, initialTables...),
+	},
+	{
+		description: "index the started and user columns",
+		statements: append(
+			perTable("CREATE INDEX IF NOT EXISTS table_started ON table (started)", initialTables...),
+			perTable(`CREATE INDEX IF NOT EXISTS table_user ON table ("user")`, initialTables...)...),
+	},
+	{
+		description: "create the daily roll up table",
+		statements:  []string{rollupCreate},
+	},
+	{
+		// an encrypted user doesn't fit in the 64 characters a plain one did
+		description: "create the encryption key check table",
+		statements: append(
+			perTable(`ALTER TABLE table ALTER COLUMN "user" TYPE text`, initialTables...),
+			encryptionCreate),
+	},
+	{
+		description: "drop the encryption key check table",
+		statements:  []string{encryptionDrop},
+	},
+}
+
+// perTable fills in the statement for each of the tables
+func perTable(statement string, tables ...string) []string {
+	statements := make([]string, len(tables))
+	for i, table := range tables {
+		statements[i] = strings.ReplaceAll(statement, "table", table)
+	}
+	return statements
+}
+
+// migrate brings the schema of the database up to the latest version
+// The migrations run on a single connection so the lock, when the database has one, is held throughout
+func (s *sqlStore) migrate() error {
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if s.dialect.lock != "" {
+		if _, err = conn.ExecContext(ctx, s.dialect.lock); err != nil {
+			return err
+		}
+		defer func() {
+			if _, err := conn.ExecContext(ctx, s.dialect.unlock); err != nil {
+				log.Error(err)
+			}
+		}()
+	}
+
+	if _, err = conn.ExecContext(ctx, schemaCreate); err != nil {
+		return err
+	}
+
+	var version int
+	if err = conn.QueryRowContext(ctx, schemaVersion).Scan(&version); err != nil {
+		return err
+	}
+
+	migrations := s.dialect.migrations
+	if version > len(migrations) {
+		return fmt.Errorf("statistics database is at version %d which is newer than this version of airshipui (%d)",
+			version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if err = s.applyMigration(ctx, conn, i+1, migrations[i]); err != nil {
+			return fmt.Errorf("statistics migration %d (%s) failed: %s", i+1, migrations[i].description, err)
+		}
+		log.Debugf("Statistics migration %d applied: %s", i+1, migrations[i].description)
+	}
+
+	return nil
+}
+
+// applyMigration runs the statements of a migration and records it in a single transaction
+func (s *sqlStore) applyMigration(ctx context.Context, conn *sql.Conn, version int, m migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = func(tx *sql.Tx) error {
+		for _, statement := range m.statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.Exec(s.rebind(schemaInsert), version, m.description, time.Now().UnixNano()/1000000)
+		return err
+	}(tx)
+
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Error(rollbackErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,472 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package statistics
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+)
+
+const (
+	defaultLimit   = 100
+	maxLimit       = 1000
+	defaultTopN    = 10
+	ascending      = "asc"
+	descending     = "desc"
+	defaultSortBy  = "started"
+	recordColumns  = `component, id, subcomponent, "user", type, target, success, started, elapsed, stopped`
+	unionSelectRow = `SELECT '%s' AS component, %s AS id, subcomponent, "user", type, target, success, ` +
+		`started, elapsed, stopped FROM %s`
+)
+
+// the columns that can be sorted on, the values are used as is in the sql so they have to be known
+var sortColumns = map[string]bool{
+	"started": true,
+	"stopped": true,
+	"elapsed": true,
+}
+
+// Record is a single transaction read back from the database
+type Record struct {
+	Component    string
+	ID           int64
+	SubComponent configs.WsSubComponentType
+	User         *string
+	ActionType   *string
+	Target       *string
+	Success      bool
+	Started      int64
+	Elapsed      int64
+	Stopped      int64
+}
+
+// Query holds the filters, sorting and paging used to read the transactions back
+// Times are in milliseconds since the epoch like the recorded transactions, both bounds are on when they started
+type Query struct {
+	NotBefore    *int64  `json:"notBefore,omitempty"`
+	NotAfter     *int64  `json:"notAfter,omitempty"`
+	User         *string `json:"user,omitempty"`
+	Component    *string `json:"component,omitempty"`
+	SubComponent *string `json:"subComponent,omitempty"`
+	Target       *string `json:"target,omitempty"`
+	Success      *bool   `json:"success,omitempty"`
+	SortBy       string  `json:"sortBy,omitempty"`
+	Order        string  `json:"order,omitempty"`
+	Limit        int     `json:"limit,omitempty"`
+	Cursor       string  `json:"cursor,omitempty"`
+}
+
+// Page is a page of records along with the cursor to get the next one, no cursor means there are no more pages
+type Page struct {
+	Records []Record `json:"records"`
+	Next    string   `json:"next,omitempty"`
+}
+
+// SuccessRate is the success rate of a component's subcomponent
+type SuccessRate struct {
+	Component    string  `json:"component"`
+	SubComponent string  `json:"subComponent"`
+	Total        int64   `json:"total"`
+	Succeeded    int64   `json:"succeeded"`
+	Rate         float64 `json:"rate"`
+}
+
+// ElapsedPercentiles are the percentiles of the time in milliseconds taken by a component's subcomponent
+type ElapsedPercentiles struct {
+	Component    string `json:"component"`
+	SubComponent string `json:"subComponent"`
+	Count        int    `json:"count"`
+	P50          int64  `json:"p50"`
+	P90          int64  `json:"p90"`
+	P95          int64  `json:"p95"`
+	P99          int64  `json:"p99"`
+	Max          int64  `json:"max"`
+}
+
+// TargetFailures is the number of failed transactions against a target
+type TargetFailures struct {
+	Component   string `json:"component"`
+	Target      string `json:"target"`
+	Failures    int64  `json:"failures"`
+	LastFailure int64  `json:"lastFailure"`
+}
+
+// cursor is the position of the last record of a page, it's handed out base64 encoded
+type cursor struct {
+	Value     int64  `json:"v"`
+	Component string `json:"c"`
+	ID        int64  `json:"i"`
+}
+
+// Records returns every record that matches the filters of the query, the paging is ignored
+func (s *sqlStore) Records(q Query) ([]Record, error) {
+	q.Cursor = ""
+	source, args, err := s.source(q)
+	if err != nil {
+		return nil, err
+	}
+
+	sortBy, order, err := q.sort()
+	if err != nil {
+		return nil, err
+	}
+
+	// the sort column and order are checked against known values, everything else is a parameter
+	return s.queryRecords(fmt.Sprintf("SELECT %s FROM %s ORDER BY %s %s, component %s, id %s",
+		recordColumns, source, sortBy, order, order, order), args...)
+}
+
+// QueryPage returns a single page of the records that match the query
+func (s *sqlStore) QueryPage(q Query) (Page, error) {
+	page := Page{Records: []Record{}}
+
+	source, args, err := s.source(q)
+	if err != nil {
+		return page, err
+	}
+
+	sortBy, order, err := q.sort()
+	if err != nil {
+		return page, err
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	where := ""
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return page, err
+		}
+
+		op := "<"
+		if order == ascending {
+			op = ">"
+		}
+
+		where = fmt.Sprintf(" WHERE (%[1]s %[2]s ? OR (%[1]s = ? AND (component %[2]s ? OR (component = ? AND id %[2]s ?))))",
+			sortBy, op)
+		args = append(args, c.Value, c.Value, c.Component, c.Component, c.ID)
+	}
+
+	// ask for one more than the limit to know if there is another page
+	args = append(args, limit+1)
+	records, err := s.queryRecords(fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s %s, component %s, id %s LIMIT ?",
+		recordColumns, source, where, sortBy, order, order, order), args...)
+	if err != nil {
+		return page, err
+	}
+
+	if len(records) > limit {
+		records = records[:limit]
+		last := records[limit-1]
+		page.Next, err = encodeCursor(cursor{Value: sortValue(last, sortBy), Component: last.Component, ID: last.ID})
+		if err != nil {
+			return page, err
+		}
+	}
+
+	page.Records = records
+	return page, nil
+}
+
+// SuccessRates returns the success rate of every component and subcomponent that matches the query
+func (s *sqlStore) SuccessRates(q Query) ([]SuccessRate, error) {
+	source, args, err := s.source(q)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(s.rebind(fmt.Sprintf("SELECT component, subcomponent, COUNT(*), SUM(success) FROM %s "+
+		"GROUP BY component, subcomponent ORDER BY component, subcomponent", source)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []SuccessRate{}
+	for rows.Next() {
+		var r SuccessRate
+		if err = rows.Scan(&r.Component, &r.SubComponent, &r.Total, &r.Succeeded); err != nil {
+			return nil, err
+		}
+		if r.Total > 0 {
+			r.Rate = float64(r.Succeeded) / float64(r.Total)
+		}
+		rates = append(rates, r)
+	}
+
+	return rates, rows.Err()
+}
+
+// Percentiles returns the percentiles of the elapsed time of every component and subcomponent that matches the query
+func (s *sqlStore) Percentiles(q Query) ([]ElapsedPercentiles, error) {
+	source, args, err := s.source(q)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(s.rebind(fmt.Sprintf("SELECT component, subcomponent, elapsed FROM %s "+
+		"ORDER BY component, subcomponent, elapsed", source)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	percentiles := []ElapsedPercentiles{}
+	var component, subComponent string
+	var elapsed []int64
+	for rows.Next() {
+		var c, sub string
+		var e int64
+		if err = rows.Scan(&c, &sub, &e); err != nil {
+			return nil, err
+		}
+
+		// the rows come back sorted so a change in the component or subcomponent starts a new group
+		if len(elapsed) > 0 && (c != component || sub != subComponent) {
+			percentiles = append(percentiles, newElapsedPercentiles(component, subComponent, elapsed))
+			elapsed = nil
+		}
+		component, subComponent = c, sub
+		elapsed = append(elapsed, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(elapsed) > 0 {
+		percentiles = append(percentiles, newElapsedPercentiles(component, subComponent, elapsed))
+	}
+
+	return percentiles, nil
+}
+
+// TopFailures returns the targets with the most failures that match the query, the success filter is ignored
+func (s *sqlStore) TopFailures(q Query) ([]TargetFailures, error) {
+	failed := false
+	q.Success = &failed
+
+	source, args, err := s.source(q)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultTopN
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	args = append(args, limit)
+
+	rows, err := s.db.Query(s.rebind(fmt.Sprintf("SELECT component, target, COUNT(*), MAX(stopped) FROM %s "+
+		"WHERE target IS NOT NULL GROUP BY component, target ORDER BY COUNT(*) DESC, MAX(stopped) DESC LIMIT ?",
+		source)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := []TargetFailures{}
+	for rows.Next() {
+		var f TargetFailures
+		if err = rows.Scan(&f.Component, &f.Target, &f.Failures, &f.LastFailure); err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+
+	return failures, rows.Err()
+}
+
+// source builds the filtered union of the component tables as a sub select along with the parameters for it
+func (s *sqlStore) source(q Query) (string, []interface{}, error) {
+	tables := Tables
+	if q.Component != nil {
+		if !hasTable(*q.Component) {
+			return "", nil, fmt.Errorf("component %s has no history", *q.Component)
+		}
+		tables = []string{*q.Component}
+	}
+
+	// the table names are from the known list of tables so they're safe to put in the sql
+	selects := make([]string, len(tables))
+	for i, table := range tables {
+		selects[i] = fmt.Sprintf(unionSelectRow, table, s.dialect.rowID, table)
+	}
+
+	clauses := []string{}
+	args := []interface{}{}
+	add := func(clause string, arg interface{}) {
+		clauses = append(clauses, clause)
+		args = append(args, arg)
+	}
+
+	if q.NotBefore != nil {
+		add("started >= ?", *q.NotBefore)
+	}
+	if q.NotAfter != nil {
+		add("started <= ?", *q.NotAfter)
+	}
+	if q.User != nil {
+		add(`"user" = ?`, *q.User)
+	}
+	if q.SubComponent != nil {
+		add("subcomponent = ?", *q.SubComponent)
+	}
+	if q.Target != nil {
+		add("target = ?", *q.Target)
+	}
+	if q.Success != nil {
+		success := 0
+		if *q.Success {
+			success = 1
+		}
+		add("success = ?", success)
+	}
+
+	where := ""
+	if len(clauses) > 0 {
+		where = " WHERE " + strings.Join(clauses, " AND ")
+	}
+
+	return fmt.Sprintf("(SELECT * FROM (%s) AS transactions%s) AS history",
+		strings.Join(selects, " UNION ALL "), where), args, nil
+}
+
+// sort returns the column and order to sort by, defaulting to the newest first
+func (q Query) sort() (string, string, error) {
+	sortBy := q.SortBy
+	if sortBy == "" {
+		sortBy = defaultSortBy
+	}
+	if !sortColumns[sortBy] {
+		return "", "", fmt.Errorf("cannot sort by %s", sortBy)
+	}
+
+	order := strings.ToLower(q.Order)
+	if order == "" {
+		order = descending
+	}
+	if order != ascending && order != descending {
+		return "", "", fmt.Errorf("unknown sort order %s", q.Order)
+	}
+
+	return sortBy, order, nil
+}
+
+// queryRecords runs the query and scans the rows into records
+func (s *sqlStore) queryRecords(query string, args ...interface{}) ([]Record, error) {
+	rows, err := s.db.Query(s.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []Record{}
+	for rows.Next() {
+		var r Record
+		var success sql.NullBool
+		err = rows.Scan(
+			&r.Component,
+			&r.ID,
+			&r.SubComponent,
+			&r.User,
+			&r.ActionType,
+			&r.Target,
+			&success,
+			&r.Started,
+			&r.Elapsed,
+			&r.Stopped,
+		)
+		if err != nil {
+			return nil, err
+		}
+		r.Success = success.Bool
+		records = append(records, r)
+	}
+
+	return records, rows.Err()
+}
+
+// sortValue returns the value of the column the records are sorted by
+func sortValue(r Record, sortBy string) int64 {
+	switch sortBy {
+	case "stopped":
+		return r.Stopped
+	case "elapsed":
+		return r.Elapsed
+	default:
+		return r.Started
+	}
+}
+
+// newElapsedPercentiles uses the nearest rank method on the sorted elapsed times
+func newElapsedPercentiles(component, subComponent string, elapsed []int64) ElapsedPercentiles {
+	rank := func(p int) int64 {
+		i := (p*len(elapsed)+99)/100 - 1
+		if i < 0 {
+			i = 0
+		}
+		return elapsed[i]
+	}
+
+	return ElapsedPercentiles{
+		Component:    component,
+		SubComponent: subComponent,
+		Count:        len(elapsed),
+		P50:          rank(50),
+		P90:          rank(90),
+		P95:          rank(95),
+		P99:          rank(99),
+		Max:          elapsed[len(elapsed)-1],
+	}
+}
+
+func encodeCursor(c cursor) (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(s string) (cursor, error) {
+	c := cursor{}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor %s", s)
+	}
+
+	if err = json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("invalid cursor %s", s)
+	}
+
+	return c, nil
+}
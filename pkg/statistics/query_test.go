@@ -0,0 +1,127 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package statistics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecords(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *sqlStore) {
+		records, err := s.Records(Query{})
+		require.NoError(t, err)
+		require.Len(t, records, 12)
+		// newest first by default
+		assert.Equal(t, int64(200), records[0].Started)
+		assert.Equal(t, "baremetal", records[0].Component)
+
+		// the range is on when the transactions started, the last one stopped well after it
+		notBefore, notAfter := int64(3), int64(5)
+		records, err = s.Records(Query{NotBefore: &notBefore, NotAfter: &notAfter, SortBy: "elapsed", Order: "asc"})
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		assert.Equal(t, int64(30), records[0].Elapsed)
+		assert.Equal(t, int64(50), records[2].Elapsed)
+		assert.Equal(t, int64(55), records[2].Stopped)
+
+		user, success := "b", false
+		records, err = s.Records(Query{User: &user, Success: &success})
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		assert.Equal(t, "node-1", *records[0].Target)
+
+		// the filters are parameters, not part of the sql
+		injection := "a' OR '1'='1"
+		records, err = s.Records(Query{User: &injection})
+		require.NoError(t, err)
+		assert.Empty(t, records)
+
+		component := "phase; DROP TABLE phase"
+		_, err = s.Records(Query{Component: &component})
+		assert.Error(t, err)
+
+		_, err = s.Records(Query{SortBy: "user"})
+		assert.Error(t, err)
+	})
+}
+
+func TestQueryPage(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *sqlStore) {
+		seen := map[int64]bool{}
+		query := Query{Limit: 5, SortBy: "started", Order: "asc"}
+		pages := 0
+		for {
+			page, err := s.QueryPage(query)
+			require.NoError(t, err)
+			pages++
+
+			for _, r := range page.Records {
+				assert.False(t, seen[r.Started])
+				seen[r.Started] = true
+			}
+
+			if page.Next == "" {
+				break
+			}
+			query.Cursor = page.Next
+		}
+
+		assert.Equal(t, 3, pages)
+		assert.Len(t, seen, 12)
+
+		_, err := s.QueryPage(Query{Cursor: "not a cursor"})
+		assert.Error(t, err)
+	})
+}
+
+func TestAggregates(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *sqlStore) {
+		rates, err := s.SuccessRates(Query{})
+		require.NoError(t, err)
+		require.Len(t, rates, 2)
+		assert.Equal(t, SuccessRate{Component: "baremetal", SubComponent: "reboot", Total: 2, Succeeded: 1, Rate: 0.5},
+			rates[0])
+		assert.Equal(t, int64(10), rates[1].Total)
+		assert.Equal(t, int64(7), rates[1].Succeeded)
+
+		component := "phase"
+		percentiles, err := s.Percentiles(Query{Component: &component})
+		require.NoError(t, err)
+		require.Len(t, percentiles, 1)
+		assert.Equal(t, ElapsedPercentiles{
+			Component:    "phase",
+			SubComponent: "run",
+			Count:        10,
+			P50:          50,
+			P90:          90,
+			P95:          100,
+			P99:          100,
+			Max:          100,
+		}, percentiles[0])
+
+		failures, err := s.TopFailures(Query{})
+		require.NoError(t, err)
+		require.Len(t, failures, 2)
+		assert.Equal(t, TargetFailures{Component: "phase", Target: "target-1", Failures: 3, LastFailure: 99}, failures[0])
+		assert.Equal(t, "node-1", failures[1].Target)
+
+		failures, err = s.TopFailures(Query{Limit: 1})
+		require.NoError(t, err)
+		assert.Len(t, failures, 1)
+	})
+}
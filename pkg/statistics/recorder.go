@@ -15,14 +15,12 @@
 package statistics
 
 import (
-	"database/sql"
+	"fmt"
 	"os"
 	"regexp"
-	"strings"
 	"sync"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3" // this is required for the sqlite driver
 	"opendev.org/airship/airshipui/pkg/configs"
 	"opendev.org/airship/airshipui/pkg/log"
 )
@@ -36,23 +34,31 @@ type Transaction struct {
 	Target       *string
 	Started      int64
 	Recordable   bool
+
+	// pending is only counted for the transactions that will be written
+	counted bool
 }
 
 var (
 	doNotRecordRegex = regexp.MustCompile(`(?i)^get|^init$`) // the default gets we don't care about
 
-	writeMutex sync.Mutex
-	// DB is public so other packages can do selects on it
-	DB *sql.DB
+	// pending keeps track of the transactions that have not been written yet so they can be flushed on shutdown
+	// once Close has started nothing new is added to it so the wait can't race with new transactions
+	pending      sync.WaitGroup
+	closed       bool
+	pendingMutex sync.Mutex
 	// Tables is public so other packages can range over it
 	Tables = []string{"baremetal", "cluster", "config", "document", "image", "phase", "secret"}
 )
 
 const (
+	// where the database lives if it's not in the config
+	defaultPath = "./sqlite/statistics.db"
+
 	// the table structure used for the records
 	tableCreate = `CREATE TABLE IF NOT EXISTS table (
 		subcomponent varchar(64) null,
-		user varchar(64),
+		"user" varchar(64),
 		type text check(type in ('direct', 'phase')) null,
 		target text null,
 		success tinyint(1) default 0,
@@ -62,7 +68,7 @@ const (
 	// the prepared statement used for inserts
 	// TODO (aschiefe): determine if we need to batch inserts
 	insert = `INSERT INTO table(subcomponent,
-								user,
+								"user",
 								type,
 								target,
 								success,
@@ -70,52 +76,76 @@ const (
 								elapsed,
 								stopped)
 								values(?,?,?,?,?,?,?,?)`
+	// the write used to check the database is writable, it is always rolled back
+	healthCheck = `CREATE TABLE healthcheck (id integer)`
 )
 
-// Init will create the database if it doesn't exist or open the existing database
+// Init will open the database chosen in the config, creating it if it doesn't exist, and bring its schema up to date
 func Init() {
-	intitTables := false
-	// TODO (aschiefe): pull the db location out to the confing
-	if _, err := os.Stat("./sqlite/statistics.db"); os.IsNotExist(err) {
-		intitTables = true
-	}
-	// need to define error so that the program will set the global db variable
-	var err error
-	// TODO (aschiefe): encrypt & password protect the database
-	// TODO (aschiefe): pull the db location out to the confing
-	DB, err = sql.Open("sqlite3", "./sqlite/statistics.db")
+	s, err := Open()
 	if err != nil {
 		log.Fatal(err)
 	}
-	if intitTables {
-		err = createTables()
-		if err != nil {
+	store = s
+
+	if conf := configs.UIConfig.Statistics; conf != nil && conf.Retention != nil {
+		if err := startRetention(conf.Retention); err != nil {
 			log.Fatal(err)
 		}
 	}
 }
 
-// createTables is only used when there is no database to write the correct structure for the records
-func createTables() error {
-	for _, table := range Tables {
-		stmt, err := DB.Prepare(strings.ReplaceAll(tableCreate, "table", table))
+// Open opens the database chosen in the config without recording to it or applying the retention policy,
+// its schema is brought up to date
+func Open() (Store, error) {
+	driver, source, key, err := storeConfig()
+	if err != nil {
+		return nil, err
+	}
+	return newSQLStore(driver, source, key)
+}
 
-		if err != nil {
-			return err
+// OpenReadOnly opens the database chosen in the config to read the history, e.g. while the UI isn't running.
+// Nothing in it is changed, it isn't migrated or encrypted, so it has to be at the version the UI would leave it
+func OpenReadOnly() (Store, error) {
+	driver, source, key, err := storeConfig()
+	if err != nil {
+		return nil, err
+	}
+	return newReadOnlyStore(driver, source, key)
+}
+
+// storeConfig is the driver, data source and key of the database chosen in the config
+func storeConfig() (string, string, string, error) {
+	driver := SQLite
+	source := defaultPath
+	key := os.Getenv(KeyEnv)
+	if conf := configs.UIConfig.Statistics; conf != nil {
+		if key == "" {
+			key = conf.Key
 		}
 
-		_, err = stmt.Exec()
-		if err != nil {
-			return err
+		if conf.Driver != "" {
+			driver = conf.Driver
+		}
+
+		switch {
+		case conf.DataSource != "":
+			source = conf.DataSource
+		case conf.Path != "":
+			source = conf.Path
+		case driver != SQLite:
+			return "", "", "", fmt.Errorf("no dataSource defined for the %s statistics database", driver)
 		}
-		log.Tracef("%s table created.", table)
 	}
-	return nil
+
+	return driver, source, key, nil
 }
 
 // NewTransaction establishes the transaction which will record
+// A transaction started after the statistics have been closed is not recorded
 func NewTransaction(user *string, request configs.WsMessage) *Transaction {
-	return &Transaction{
+	transaction := &Transaction{
 		Table:        request.Component,
 		SubComponent: request.SubComponent,
 		ActionType:   request.ActionType,
@@ -124,49 +154,95 @@ func NewTransaction(user *string, request configs.WsMessage) *Transaction {
 		User:         user,
 		Recordable:   isRecordable(request),
 	}
+
+	if transaction.User != nil && transaction.Recordable {
+		pendingMutex.Lock()
+		defer pendingMutex.Unlock()
+		if closed {
+			log.Debugf("Statistics are closed, not recording %s %s", transaction.Table, transaction.SubComponent)
+			transaction.Recordable = false
+		} else {
+			pending.Add(1)
+			transaction.counted = true
+		}
+	}
+
+	return transaction
 }
 
 // Complete will put an entry into the statistics database for the transaction
 func (transaction *Transaction) Complete(errorMessageNotPresent bool) {
+	if transaction.counted {
+		defer pending.Done()
+	}
+
 	if transaction.User != nil && transaction.Recordable {
-		stmt, err := DB.Prepare(strings.ReplaceAll(insert, "table", string(transaction.Table)))
+		s, err := Storage()
 		if err != nil {
 			log.Error(err)
 			return
 		}
 
-		started := transaction.Started
 		stopped := time.Now().UnixNano() / 1000000
-
-		success := 0
-		if errorMessageNotPresent {
-			success = 1
-		}
-
-		writeMutex.Lock()
-		defer writeMutex.Unlock()
-		result, err := stmt.Exec(transaction.SubComponent,
-			transaction.User,
-			transaction.ActionType,
-			transaction.Target,
-			success,
-			started,
-			(stopped - started),
-			stopped)
-
+		err = s.Insert(string(transaction.Table), Record{
+			SubComponent: transaction.SubComponent,
+			User:         transaction.User,
+			ActionType:   transaction.ActionType,
+			Target:       transaction.Target,
+			Success:      errorMessageNotPresent,
+			Started:      transaction.Started,
+			Elapsed:      stopped - transaction.Started,
+			Stopped:      stopped,
+		})
 		if err != nil {
 			log.Error(err)
 			return
 		}
 
-		rows, err := result.RowsAffected()
-		if err != nil {
-			log.Error(err)
-			return
-		}
+		log.Tracef("Transaction inserted into %s.", transaction.Table)
+	}
+}
 
-		log.Tracef("%d rows inserted into %s.", rows, transaction.Table)
+// Close waits for the outstanding transactions to be written and closes the database
+// Anything not written before the timeout is lost
+func Close(timeout time.Duration) error {
+	pendingMutex.Lock()
+	closed = true
+	pendingMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Debug("Statistics flushed")
+	case <-time.After(timeout):
+		log.Warnf("Timed out after %s waiting for statistics to be written", timeout)
+	}
+
+	if stopRetention != nil {
+		close(stopRetention)
+		stopRetention = nil
 	}
+
+	if store == nil {
+		return nil
+	}
+
+	return store.Close()
+}
+
+// Check makes sure the statistics database can be reached and written to
+func Check() error {
+	s, err := Storage()
+	if err != nil {
+		return err
+	}
+
+	return s.Check()
 }
 
 // isRecordable will shuffle through the transaction and determine if we should write it to the database
@@ -187,5 +263,20 @@ func isRecordable(request configs.WsMessage) bool {
 		recordable = false
 	}
 
+	// only components with a table can be recorded, e.g. streams are not transactions
+	if !hasTable(string(request.Component)) {
+		recordable = false
+	}
+
 	return recordable
 }
+
+// hasTable checks that there is a table in the database for the component
+func hasTable(component string) bool {
+	for _, table := range Tables {
+		if table == component {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package statistics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"opendev.org/airship/airshipui/pkg/configs"
+)
+
+func TestTransactionClose(t *testing.T) {
+	path, cleanup := tempPath(t)
+	defer cleanup()
+
+	s, err := newSQLStore(SQLite, path, "")
+	require.NoError(t, err)
+	store = s
+	defer func() {
+		pendingMutex.Lock()
+		closed = false
+		pendingMutex.Unlock()
+		store = nil
+	}()
+
+	user := "a"
+	reboot := configs.WsMessage{Type: configs.CTL, Component: "baremetal", SubComponent: "reboot"}
+
+	// only what's going to be written is waited on
+	assert.False(t, NewTransaction(&user, configs.WsMessage{Type: configs.UI, SubComponent: "getDefaults"}).counted)
+	assert.False(t, NewTransaction(nil, reboot).counted)
+	transaction := NewTransaction(&user, reboot)
+	assert.True(t, transaction.counted)
+	transaction.Complete(true)
+
+	require.NoError(t, Close(time.Second))
+
+	// once it's closed nothing else is recorded or waited on
+	transaction = NewTransaction(&user, reboot)
+	assert.False(t, transaction.counted)
+	assert.False(t, transaction.Recordable)
+	transaction.Complete(true)
+
+	s, err = newSQLStore(SQLite, path, "")
+	require.NoError(t, err)
+	defer s.Close()
+	records, err := s.Records(Query{})
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+}
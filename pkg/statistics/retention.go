@@ -0,0 +1,155 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package statistics
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/log"
+)
+
+const (
+	defaultRetentionInterval = time.Hour
+	day                      = int64(24 * time.Hour / time.Millisecond)
+
+	// sums up the records older than the cutoff by day and subcomponent, adding to the totals of earlier roll ups
+	rollupInsert = `INSERT INTO rollup(component, subcomponent, day, total, succeeded, elapsed)
+		SELECT CAST(? AS varchar(64)), subcomponent, (started / ?) * ?, COUNT(*), SUM(success), SUM(elapsed)
+		FROM table WHERE started < ? GROUP BY 2, 3
+		ON CONFLICT(component, subcomponent, day) DO UPDATE SET
+		total = rollup.total + excluded.total,
+		succeeded = rollup.succeeded + excluded.succeeded,
+		elapsed = rollup.elapsed + excluded.elapsed`
+	prune = `DELETE FROM table WHERE started < ?`
+)
+
+// stopRetention stops the retention schedule when the database is closed
+var stopRetention chan struct{}
+
+// startRetention prunes the database on the interval of the policy until the database is closed
+func startRetention(retention *configs.Retention) error {
+	if retention.MaxAge == "" {
+		return errors.New("statistics retention has no maxAge")
+	}
+
+	maxAge, err := time.ParseDuration(retention.MaxAge)
+	if err != nil {
+		return fmt.Errorf("statistics retention maxAge: %s", err)
+	}
+
+	interval := defaultRetentionInterval
+	if retention.Interval != "" {
+		interval, err = time.ParseDuration(retention.Interval)
+		if err != nil {
+			return fmt.Errorf("statistics retention interval: %s", err)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("statistics retention interval must be positive, got %s", interval)
+		}
+	}
+
+	stop := make(chan struct{})
+	stopRetention = stop
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			applyRetention(maxAge, retention.RollUp)
+
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return nil
+}
+
+// applyRetention runs a single pass of the retention policy and logs the outcome
+func applyRetention(maxAge time.Duration, rollUp bool) {
+	s, err := Storage()
+	if err != nil {
+		log.Errorf("Error applying statistics retention: %s", err)
+		return
+	}
+
+	cutoff := time.Now().Add(-maxAge).UnixNano() / 1000000
+	pruned, err := s.Prune(cutoff, rollUp)
+	if err != nil {
+		log.Errorf("Error applying statistics retention: %s", err)
+		return
+	}
+
+	log.Debugf("Statistics retention pruned %d records", pruned)
+}
+
+// Prune removes the records that started before the cutoff, rolling them up first if asked to
+func (s *sqlStore) Prune(cutoff int64, rollUp bool) (int64, error) {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	pruned, err := func(tx *sql.Tx) (int64, error) {
+		if s.dialect.pruneLock != "" {
+			if _, err := tx.Exec(s.dialect.pruneLock); err != nil {
+				return 0, err
+			}
+		}
+
+		var pruned int64
+		for _, table := range Tables {
+			if rollUp {
+				_, err := tx.Exec(s.rebind(strings.ReplaceAll(rollupInsert, "table", table)), table, day, day, cutoff)
+				if err != nil {
+					return 0, err
+				}
+			}
+
+			result, err := tx.Exec(s.rebind(strings.ReplaceAll(prune, "table", table)), cutoff)
+			if err != nil {
+				return 0, err
+			}
+
+			rows, err := result.RowsAffected()
+			if err != nil {
+				return 0, err
+			}
+			pruned += rows
+		}
+		return pruned, nil
+	}(tx)
+
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Error(rollbackErr)
+		}
+		return 0, err
+	}
+
+	return pruned, tx.Commit()
+}
@@ -0,0 +1,104 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package statistics
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"opendev.org/airship/airshipui/pkg/configs"
+)
+
+func TestMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "airshipui-statistics")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// a database created before there were migrations, with a record in it
+	path := filepath.Join(dir, "statistics.db")
+	db, err := sql.Open(SQLite, path)
+	require.NoError(t, err)
+	_, err = db.Exec(strings.ReplaceAll(tableCreate, "table", "phase"))
+	require.NoError(t, err)
+	_, err = db.Exec(strings.ReplaceAll(insert, "table", "phase"), "run", "a", nil, nil, 1, 1, 1, 2)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	s, err := newSQLStore(SQLite, path, "")
+	require.NoError(t, err)
+	defer s.Close()
+
+	var version int
+	require.NoError(t, s.db.QueryRow(schemaVersion).Scan(&version))
+	assert.Equal(t, len(sqliteMigrations), version)
+
+	var count int
+	require.NoError(t, s.db.QueryRow(
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name IN ('phase_started', 'phase_user')").
+		Scan(&count))
+	assert.Equal(t, 2, count)
+
+	// the existing record survives and running the migrations again does nothing
+	require.NoError(t, s.migrate())
+	records, err := s.Records(Query{})
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+}
+
+func TestPrune(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *sqlStore) {
+		// the phase records started at 1-10 and the baremetal records at 100 and 200
+		pruned, err := s.Prune(6, true)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), pruned)
+
+		records, err := s.Records(Query{})
+		require.NoError(t, err)
+		assert.Len(t, records, 7)
+
+		// the earlier roll up for the day is added to
+		pruned, err = s.Prune(150, true)
+		require.NoError(t, err)
+		assert.Equal(t, int64(6), pruned)
+
+		var total, succeeded, elapsed int64
+		require.NoError(t, s.db.QueryRow("SELECT total, succeeded, elapsed FROM rollup "+
+			"WHERE component = 'phase' AND subcomponent = 'run' AND day = 0").
+			Scan(&total, &succeeded, &elapsed))
+		assert.Equal(t, int64(10), total)
+		assert.Equal(t, int64(7), succeeded)
+		assert.Equal(t, int64(550), elapsed)
+
+		// without roll up the records are just dropped
+		pruned, err = s.Prune(300, false)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), pruned)
+
+		require.NoError(t, s.db.QueryRow("SELECT COUNT(*) FROM rollup WHERE component = 'baremetal'").Scan(&total))
+		assert.Equal(t, int64(1), total)
+	})
+}
+
+func TestStartRetention(t *testing.T) {
+	assert.Error(t, startRetention(&configs.Retention{}))
+	assert.Error(t, startRetention(&configs.Retention{MaxAge: "forever"}))
+	assert.Error(t, startRetention(&configs.Retention{MaxAge: "24h", Interval: "-1h"}))
+}
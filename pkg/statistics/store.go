@@ -0,0 +1,308 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package statistics
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	_ "github.com/lib/pq"                   // this is required for the postgres driver
+	_ "github.com/mutecomm/go-sqlcipher/v4" // this is required for the sqlite driver, it's sqlite with SQLCipher
+	"opendev.org/airship/airshipui/pkg/log"
+)
+
+// the supported drivers for the statistics database
+const (
+	SQLite   = "sqlite3"
+	Postgres = "postgres"
+)
+
+// Store is where the transactions are written to and the history is read back from
+type Store interface {
+	// Insert writes a transaction to the table of its component
+	Insert(table string, r Record) error
+	// Records returns every record that matches the filters of the query, the paging is ignored
+	Records(q Query) ([]Record, error)
+	// QueryPage returns a single page of the records that match the query
+	QueryPage(q Query) (Page, error)
+	// SuccessRates returns the success rate of every component and subcomponent that matches the query
+	SuccessRates(q Query) ([]SuccessRate, error)
+	// Percentiles returns the percentiles of the elapsed time of every component and subcomponent that matches
+	Percentiles(q Query) ([]ElapsedPercentiles, error)
+	// TopFailures returns the targets with the most failures that match the query
+	TopFailures(q Query) ([]TargetFailures, error)
+	// Prune removes the records that started before the cutoff, rolling them up first if asked to
+	Prune(cutoff int64, rollUp bool) (int64, error)
+	// Check makes sure the store can be reached and written to
+	Check() error
+	// Close releases the connections to the store
+	Close() error
+}
+
+// dialect holds what differs between the sql databases, everything else is written to work on all of them
+type dialect struct {
+	// numbered placeholders, $1 instead of ?
+	numbered bool
+	// the column that identifies a row in a component table
+	rowID      string
+	migrations []migration
+	// a session lock held while migrating so replicas sharing a database don't migrate at the same time
+	lock   string
+	unlock string
+	// a transaction lock so replicas sharing a database don't prune at the same time
+	pruneLock string
+}
+
+var dialects = map[string]dialect{
+	SQLite: {
+		rowID:      "rowid",
+		migrations: sqliteMigrations,
+	},
+	Postgres: {
+		numbered:   true,
+		rowID:      "id",
+		migrations: postgresMigrations,
+		lock:       "SELECT pg_advisory_lock(4713)",
+		unlock:     "SELECT pg_advisory_unlock(4713)",
+		pruneLock:  "SELECT pg_advisory_xact_lock(4714)",
+	},
+}
+
+// sqlStore is a Store backed by a database/sql database
+type sqlStore struct {
+	db      *sql.DB
+	dialect dialect
+	// sqlite can only take one writer at a time
+	writeMutex sync.Mutex
+}
+
+// store is the Store the statistics are kept in once Init has been run
+var store Store
+
+// Storage returns the store the statistics are kept in
+func Storage() (Store, error) {
+	if store == nil {
+		return nil, errors.New("statistics database has not been opened")
+	}
+	return store, nil
+}
+
+// newSQLStore opens the database for the driver and brings its schema up to date
+// If there is a key the sqlite database is encrypted with it
+func newSQLStore(driver, source, key string) (*sqlStore, error) {
+	d, ok := dialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("unknown statistics driver %s", driver)
+	}
+
+	if key != "" && driver != SQLite {
+		return nil, fmt.Errorf("statistics key only applies to %s, a %s database is encrypted by the server",
+			SQLite, driver)
+	}
+
+	if driver == SQLite {
+		if err := os.MkdirAll(filepath.Dir(source), 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &sqlStore{dialect: d}
+	var err error
+	switch {
+	case key != "":
+		s.db, err = openEncrypted(source, key)
+	case driver == SQLite:
+		var encrypted bool
+		if encrypted, err = isEncrypted(source); err == nil && encrypted {
+			err = errNoKey
+		}
+		if err == nil {
+			s.db, err = sql.Open(driver, source)
+		}
+	default:
+		s.db, err = sql.Open(driver, source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.migrate(); err != nil {
+		s.db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// newReadOnlyStore opens the database for the driver without changing it, a sqlite database has to be there
+// already and is opened read only.  A plaintext sqlite database is read as it is even if there's a key
+func newReadOnlyStore(driver, source, key string) (*sqlStore, error) {
+	d, ok := dialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("unknown statistics driver %s", driver)
+	}
+
+	s := &sqlStore{dialect: d}
+	var err error
+	if driver == SQLite {
+		s.db, err = openReadOnly(source, key)
+	} else {
+		s.db, err = sql.Open(driver, source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.checkVersion(); err != nil {
+		s.db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// openReadOnly opens the sqlite database at the path in read only mode, keyed if it's encrypted
+func openReadOnly(path, key string) (*sql.DB, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = os.Stat(abs); err != nil {
+		return nil, err
+	}
+
+	encrypted, err := isEncrypted(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	dsn := (&url.URL{Scheme: "file", Path: abs, RawQuery: "mode=ro"}).String()
+	switch {
+	case !encrypted:
+		return sql.Open(SQLite, dsn)
+	case key == "":
+		return nil, errNoKey
+	}
+
+	db := sql.OpenDB(newKeyedConnector(dsn, key))
+	if err = checkKey(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// checkVersion makes sure the schema is the one this version of airshipui reads, without migrating it
+func (s *sqlStore) checkVersion() error {
+	var version int
+	if err := s.db.QueryRow(schemaVersion).Scan(&version); err != nil {
+		return fmt.Errorf("statistics database has no schema version: %s", err)
+	}
+
+	latest := len(s.dialect.migrations)
+	switch {
+	case version > latest:
+		return fmt.Errorf("statistics database is at version %d which is newer than this version of airshipui (%d)",
+			version, latest)
+	case version < latest:
+		return fmt.Errorf("statistics database is at version %d and needs migrating to %d, start the UI to migrate it",
+			version, latest)
+	}
+	return nil
+}
+
+// Insert writes a transaction to the table of its component
+func (s *sqlStore) Insert(table string, r Record) error {
+	if !hasTable(table) {
+		return fmt.Errorf("component %s has no history", table)
+	}
+
+	success := 0
+	if r.Success {
+		success = 1
+	}
+
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	_, err := s.db.Exec(s.rebind(strings.ReplaceAll(insert, "table", table)),
+		r.SubComponent,
+		r.User,
+		r.ActionType,
+		r.Target,
+		success,
+		r.Started,
+		r.Elapsed,
+		r.Stopped)
+
+	return err
+}
+
+// Check makes sure the database can be reached and written to, the write is rolled back so nothing is left behind
+func (s *sqlStore) Check() error {
+	if err := s.db.Ping(); err != nil {
+		return err
+	}
+
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			log.Error(err)
+		}
+	}()
+
+	_, err = tx.Exec(healthCheck)
+	return err
+}
+
+// Close releases the connections to the database
+func (s *sqlStore) Close() error {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	return s.db.Close()
+}
+
+// rebind switches the ? placeholders to the ones the database uses
+func (s *sqlStore) rebind(query string) string {
+	if !s.dialect.numbered {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
@@ -35,6 +35,8 @@ var RunningTasks = map[string]Task{}
 type Task struct {
 	ID        string
 	SessionID string
+	RequestID string   // echoed on every task message so the client can tie it back to its request
+	Topics    []string // the task messages are published on these as well as sent to the session
 	Name      string
 	Progress  Progress
 	Running   bool // TODO(mfuller): this is probably only necessary on the frontend
@@ -84,11 +86,14 @@ func HandleTaskRequest(request configs.WsMessage) configs.WsMessage {
 }
 
 // NewTask returns a pointer to a new Task built with a session ID, name, and UUID
-func NewTask(sessionID, taskID, name string) *Task {
+// the request and any topics beyond the task's own are set before the task is cached in RunningTasks
+func NewTask(sessionID, taskID, requestID, name string, topics ...string) *Task {
 	task := Task{
 		ID:        taskID,
 		SessionID: sessionID,
+		RequestID: requestID,
 		Name:      name,
+		Topics:    append([]string{webservice.TaskTopic(taskID)}, topics...),
 		Progress: Progress{
 			StartTime:   time.Now().UnixNano() / 1000000,
 			TotalSteps:  0, // will steps be determinable at task start?
@@ -135,14 +140,16 @@ func UpdateTask(sessionID, id string, progress Progress) {
 	})
 
 	if err != nil {
-		log.Errorf("Error sending message for task %s", err)
+		log.WithFields(log.Fields{SessionID: sessionID, TaskID: id}).Errorf("Error sending message for task %s", err)
 	}
 }
 
-// SendTaskMessage allows a running Task to push progress updates to the frontend client
+// SendTaskMessage allows a running Task to push progress updates to the frontend client and anyone
+// subscribed to its topics
 func (t *Task) SendTaskMessage(subComponent configs.WsSubComponentType, progress Progress) {
-	err := webservice.WebSocketSend(configs.WsMessage{
+	err := webservice.Publish(configs.WsMessage{
 		SessionID:    t.SessionID,
+		RequestID:    t.RequestID,
 		ID:           t.ID,
 		Name:         t.Name,
 		Timestamp:    time.Now().UnixNano() / 1000000,
@@ -151,9 +158,13 @@ func (t *Task) SendTaskMessage(subComponent configs.WsSubComponentType, progress
 		SubComponent: subComponent,
 		Message:      &t.Name,
 		Data:         progress,
-	})
+	}, t.Topics...)
 
 	if err != nil {
-		log.Errorf("Error sending message for task %s", err)
+		log.WithFields(log.Fields{
+			SessionID: t.SessionID,
+			TaskID:    t.ID,
+			RequestID: t.RequestID,
+		}).Errorf("Error sending message for task %s", err)
 	}
 }
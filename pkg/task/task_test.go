@@ -0,0 +1,35 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package task
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"opendev.org/airship/airshipui/pkg/webservice"
+)
+
+func TestNewTask(t *testing.T) {
+	tsk := NewTask("session", "task", "request", "phase", webservice.PhaseTopic("phase"))
+	defer delete(RunningTasks, tsk.ID)
+
+	// the cached copy has everything the returned one does
+	cached, ok := RunningTasks[tsk.ID]
+	require.True(t, ok)
+	assert.Equal(t, "request", cached.RequestID)
+	assert.Equal(t, []string{webservice.TaskTopic("task"), webservice.PhaseTopic("phase")}, cached.Topics)
+	assert.Equal(t, tsk.Topics, cached.Topics)
+}
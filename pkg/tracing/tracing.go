@@ -0,0 +1,275 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/log"
+)
+
+// the exporters the spans can be sent to
+const (
+	OTLP = "otlp"
+	File = "file"
+)
+
+const (
+	serviceName = "airshipui"
+	tracerName  = "opendev.org/airship/airshipui"
+
+	// the path the otlp collectors take traces on over http
+	otlpTracesPath = "/v1/traces"
+)
+
+// the W3C trace context headers, carried in the websocket messages
+const (
+	traceparent = "traceparent"
+	tracestate  = "tracestate"
+)
+
+var (
+	provider *sdktrace.TracerProvider
+	// the file the file exporter writes to, the exporter doesn't close it
+	output        io.Closer
+	providerMutex sync.Mutex
+)
+
+func init() {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+}
+
+// Init starts the exporter chosen in the config, tracing stays off if there isn't one
+func Init() error {
+	conf := configs.UIConfig.Tracing
+	if conf == nil || conf.Exporter == "" {
+		return nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	var closer io.Closer
+	var err error
+	switch conf.Exporter {
+	case OTLP:
+		if conf.Endpoint == "" {
+			return errors.New("no endpoint defined for the otlp trace exporter")
+		}
+		exporter, err = newOTLPExporter(conf.Endpoint)
+	case File:
+		if conf.Path == "" {
+			return errors.New("no path defined for the file trace exporter")
+		}
+		exporter, closer, err = newFileExporter(conf.Path)
+	default:
+		return fmt.Errorf("unknown trace exporter %s, expected %s or %s", conf.Exporter, OTLP, File)
+	}
+	if err != nil {
+		return err
+	}
+
+	Start(exporter)
+	providerMutex.Lock()
+	output = closer
+	providerMutex.Unlock()
+
+	log.Infof("Tracing to the %s exporter", conf.Exporter)
+	return nil
+}
+
+// newOTLPExporter posts the spans to the collector at the endpoint, e.g. http://localhost:4318
+func newOTLPExporter(endpoint string) (sdktrace.SpanExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid otlp endpoint %s, expected e.g. http://localhost:4318", endpoint)
+	}
+
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(strings.TrimSuffix(u.Path, "/") + otlpTracesPath),
+	}
+	if u.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	return otlptracehttp.New(context.Background(), options...)
+}
+
+// newFileExporter appends the spans to the file at the path as json, one span per line
+func newFileExporter(path string) (sdktrace.SpanExporter, io.Closer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return exporter, file, nil
+}
+
+// Start records the spans and sends them to the exporter in batches until Shutdown is called
+func Start(exporter sdktrace.SpanExporter) {
+	p := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+	)
+
+	providerMutex.Lock()
+	defer providerMutex.Unlock()
+	provider = p
+	otel.SetTracerProvider(p)
+}
+
+// Shutdown sends the spans that haven't been exported yet and closes the exporter
+// Anything not exported before the timeout is lost
+func Shutdown(timeout time.Duration) {
+	providerMutex.Lock()
+	p, closer := provider, output
+	provider, output = nil, nil
+	providerMutex.Unlock()
+
+	if p == nil {
+		return
+	}
+
+	// spans started from here on aren't recorded
+	otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		log.Warnf("Error exporting the last traces: %s", err)
+	} else {
+		log.Debug("Traces flushed")
+	}
+
+	if closer != nil {
+		if err := closer.Close(); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// Flush waits for the spans that have ended to be exported
+func Flush() {
+	providerMutex.Lock()
+	p := provider
+	providerMutex.Unlock()
+
+	if p != nil {
+		if err := p.ForceFlush(context.Background()); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// Enabled tells if the spans are being recorded
+func Enabled() bool {
+	providerMutex.Lock()
+	defer providerMutex.Unlock()
+	return provider != nil
+}
+
+// StartSpan starts a span as a child of the one in the context, or the root of a new trace if there isn't one
+func StartSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// RecordError marks the span as failed, nil errors are ignored
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// TraceID is the id of the trace the span is part of, empty when there's no trace
+func TraceID(span trace.Span) string {
+	sc := span.SpanContext()
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// FromMessage is a context with the trace the websocket message carries in its traceparent
+func FromMessage(message configs.WsMessage) context.Context {
+	return otel.GetTextMapPropagator().Extract(context.Background(), messageCarrier{message: &message})
+}
+
+// Inject puts the span of the context in the message so whatever handles it can add to the trace
+func Inject(ctx context.Context, message *configs.WsMessage) {
+	otel.GetTextMapPropagator().Inject(ctx, messageCarrier{message: message})
+}
+
+// messageCarrier lets the propagator read and write the trace context headers of a websocket message
+type messageCarrier struct {
+	message *configs.WsMessage
+}
+
+// Get returns the value of the trace context header
+func (c messageCarrier) Get(key string) string {
+	switch strings.ToLower(key) {
+	case traceparent:
+		return c.message.Traceparent
+	case tracestate:
+		return c.message.Tracestate
+	}
+	return ""
+}
+
+// Set sets the value of the trace context header, anything else isn't carried
+func (c messageCarrier) Set(key, value string) {
+	switch strings.ToLower(key) {
+	case traceparent:
+		c.message.Traceparent = value
+	case tracestate:
+		c.message.Tracestate = value
+	}
+}
+
+// Keys are the trace context headers the message carries
+func (c messageCarrier) Keys() []string {
+	return []string{traceparent, tracestate}
+}
@@ -0,0 +1,186 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"opendev.org/airship/airshipui/pkg/configs"
+)
+
+func TestDisabled(t *testing.T) {
+	ctx, span := StartSpan(context.Background(), "off", attribute.String("key", "value"))
+	RecordError(span, errors.New("broken"))
+	span.End()
+
+	assert.False(t, Enabled())
+	assert.False(t, span.IsRecording())
+	assert.Empty(t, TraceID(span))
+
+	message := configs.WsMessage{}
+	Inject(ctx, &message)
+	assert.Empty(t, message.Traceparent)
+}
+
+func TestSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	Start(exporter)
+
+	ctx, root := StartSpan(context.Background(), "request")
+	message := configs.WsMessage{}
+	Inject(ctx, &message)
+	assert.Regexp(t, "^00-"+TraceID(root)+"-[0-9a-f]{16}-01$", message.Traceparent)
+
+	_, child := StartSpan(FromMessage(message), "phase run", attribute.String("phase", "initinfra"))
+	RecordError(child, errors.New("broken"))
+	child.End()
+	root.End()
+
+	// a trace the UI started is continued, a bad one is replaced
+	continued := configs.WsMessage{Traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+	_, span := StartSpan(FromMessage(continued), "continued")
+	span.End()
+	invalid := configs.WsMessage{Traceparent: "00-nope-00f067aa0ba902b7-01"}
+	_, span = StartSpan(FromMessage(invalid), "invalid")
+	span.End()
+
+	Flush()
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 4)
+
+	assert.Equal(t, "phase run", spans[0].Name)
+	assert.Equal(t, TraceID(root), spans[0].SpanContext.TraceID().String())
+	assert.Equal(t, root.SpanContext().SpanID(), spans[0].Parent.SpanID())
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, "broken", spans[0].Status.Description)
+	assert.Contains(t, spans[0].Attributes, attribute.String("phase", "initinfra"))
+
+	assert.False(t, spans[1].Parent.IsValid())
+	assert.Contains(t, spans[1].Resource.Attributes(), attribute.String("service.name", "airshipui"))
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[2].SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[2].Parent.SpanID().String())
+	assert.True(t, spans[2].Parent.IsRemote())
+	assert.False(t, spans[3].Parent.IsValid())
+
+	// spans started after the shutdown aren't recorded
+	Shutdown(time.Second)
+	_, late := StartSpan(context.Background(), "late")
+	late.End()
+	assert.False(t, late.IsRecording())
+	assert.False(t, Enabled())
+}
+
+func TestFileExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "airshipui-tracing")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	defer func() {
+		configs.UIConfig.Tracing = nil
+	}()
+	path := filepath.Join(dir, "traces", "airshipui.jsonl")
+	configs.UIConfig.Tracing = &configs.Tracing{Exporter: File, Path: path}
+	require.NoError(t, Init())
+
+	_, span := StartSpan(context.Background(), "request", attribute.String("user", "a"), attribute.Int("count", 2))
+	span.End()
+	Shutdown(time.Second)
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	require.True(t, scanner.Scan())
+	exported := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &exported))
+	assert.Equal(t, "request", exported["Name"])
+	assert.Equal(t, TraceID(span), exported["SpanContext"].(map[string]interface{})["TraceID"])
+	assert.False(t, scanner.Scan())
+}
+
+func TestOTLPExporter(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+	}))
+	defer server.Close()
+
+	exporter, err := newOTLPExporter(server.URL + "/")
+	require.NoError(t, err)
+	Start(exporter)
+
+	_, span := StartSpan(context.Background(), "request")
+	span.End()
+	Shutdown(time.Second)
+
+	request := <-received
+	assert.Equal(t, otlpTracesPath, request.URL.Path)
+	assert.Equal(t, "application/x-protobuf", request.Header.Get("Content-Type"))
+
+	_, err = newOTLPExporter("localhost")
+	assert.Error(t, err)
+}
+
+func TestInit(t *testing.T) {
+	defer func() {
+		configs.UIConfig.Tracing = nil
+	}()
+
+	configs.UIConfig.Tracing = nil
+	require.NoError(t, Init())
+	assert.False(t, Enabled())
+
+	for _, conf := range []configs.Tracing{
+		{Exporter: "zipkin"},
+		{Exporter: OTLP},
+		{Exporter: OTLP, Endpoint: "localhost"},
+		{Exporter: File},
+	} {
+		c := conf
+		configs.UIConfig.Tracing = &c
+		assert.Error(t, Init())
+		assert.False(t, Enabled())
+	}
+}
+
+func TestMessageCarrier(t *testing.T) {
+	message := configs.WsMessage{}
+	carrier := messageCarrier{message: &message}
+	carrier.Set("Traceparent", "parent")
+	carrier.Set("tracestate", "state")
+	carrier.Set("baggage", "ignored")
+
+	assert.Equal(t, "parent", message.Traceparent)
+	assert.Equal(t, "state", carrier.Get("tracestate"))
+	assert.Empty(t, carrier.Get("baggage"))
+	assert.Equal(t, []string{traceparent, tracestate}, carrier.Keys())
+}
@@ -19,6 +19,9 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -32,8 +35,12 @@ var jwtKey = []byte("airshipUI_JWT_key")
 
 const (
 	username   = "username"
-	password   = "password"
 	expiration = "exp"
+
+	// used to find the token on plain http requests
+	authorization = "Authorization"
+	bearer        = "Bearer "
+	tokenCookie   = "airshipUI-token"
 )
 
 // The UI will either request authentication or validation, handle those situations here
@@ -51,7 +58,9 @@ func handleAuth(_ *string, request configs.WsMessage) configs.WsMessage {
 			authRequest := request.Authentication
 			token, err = createToken(authRequest.ID, authRequest.Password)
 			if token != nil {
-				sessions[request.SessionID].jwt = *token
+				if session, ok := getSession(request.SessionID); ok {
+					session.jwt = *token
+				}
 				response.SubComponent = configs.Approved
 				response.Token = token
 			}
@@ -81,6 +90,12 @@ func handleAuth(_ *string, request configs.WsMessage) configs.WsMessage {
 
 // validate JWT (JSON Web Token)
 func validateToken(request configs.WsMessage) (*string, error) {
+	user, _, err := validateTokenExpiry(request)
+	return user, err
+}
+
+// validateTokenExpiry validates the JWT and also returns when it runs out
+func validateTokenExpiry(request configs.WsMessage) (*string, time.Time, error) {
 	// update the token string to be the refresh token if it's present
 	// otherwise just use the default token string
 	// TODO(aschiefe): determine if we need to compare the original token claims to the refresh
@@ -98,7 +113,7 @@ func validateToken(request configs.WsMessage) (*string, error) {
 
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, time.Time{}, err
 	}
 
 	// extract the claim from the token
@@ -107,16 +122,65 @@ func validateToken(request configs.WsMessage) (*string, error) {
 		if user, ok := claim[username].(string); ok {
 			// test to see if we need to sent a refresh token
 			go testForRefresh(claim, request)
-			return &user, nil
+			exp, _ := claim[expiration].(float64)
+			return &user, time.Unix(int64(exp), 0), nil
 		}
 		err = errors.New("Invalid JWT User")
 		log.Error(err)
-		return nil, err
+		return nil, time.Time{}, err
 	}
 
 	err = errors.New("Invalid JWT Token")
 	log.Error(err)
-	return nil, err
+	return nil, time.Time{}, err
+}
+
+// validateHTTPRequest will validate the JWT sent with a plain http request.  The token is taken from the
+// Authorization header, or from the cookie the UI sets since a browser download can't set headers.
+// It's never taken from the url, where it would end up in the browser history and the proxy logs
+func validateHTTPRequest(request *http.Request) (*string, error) {
+	token := strings.TrimPrefix(request.Header.Get(authorization), bearer)
+	if token == "" {
+		if cookie, err := request.Cookie(tokenCookie); err == nil {
+			token = cookie.Value
+		}
+	}
+
+	if token == "" {
+		return nil, errors.New("No authentication token found")
+	}
+
+	return validateToken(configs.WsMessage{Token: &token})
+}
+
+// requireAuth wraps a handler so it can only be reached with a valid token
+func requireAuth(handler http.HandlerFunc) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		user, err := validateHTTPRequest(request)
+		if err != nil {
+			http.Error(response, "Invalid token, authentication denied", http.StatusUnauthorized)
+			return
+		}
+
+		log.WithFields(log.Fields{User: *user}).Debugf("Requested %s", request.URL.Path)
+		handler(response, request)
+	}
+}
+
+// requireLocal wraps a handler so it can only be reached from the machine the UI runs on, for the admin routes
+// that any user with a token shouldn't be able to use
+func requireLocal(handler http.HandlerFunc) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		host, _, err := net.SplitHostPort(request.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			log.Warnf("Refusing %s from %s, it's only allowed from the local machine", request.URL.Path,
+				request.RemoteAddr)
+			http.Error(response, "Only allowed from the local machine", http.StatusForbidden)
+			return
+		}
+
+		handler(response, request)
+	}
 }
 
 // create a JWT (JSON Web Token)
@@ -136,10 +200,9 @@ func createToken(id string, passwd string) (*string, error) {
 		return nil, errors.New("Not authenticated")
 	}
 
-	// set some claims
+	// set some claims, the token is readable by anyone holding it so nothing secret goes in here
 	claims := make(jwt.MapClaims)
 	claims[username] = id
-	claims[password] = passwd
 	claims[expiration] = time.Now().Add(time.Hour * 1).Unix()
 
 	// create the token
@@ -179,7 +242,7 @@ func createRefreshToken(claim jwt.MapClaims, request configs.WsMessage) {
 	}
 
 	// test to see if the session is still in existence before firing off a message
-	if session, ok := sessions[request.SessionID]; ok {
+	if session, ok := getSession(request.SessionID); ok {
 		if err = session.webSocketSend(configs.WsMessage{
 			Type:         configs.UI,
 			Component:    configs.Auth,
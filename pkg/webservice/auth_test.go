@@ -0,0 +1,62 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateHTTPRequest(t *testing.T) {
+	token, cleanup := testToken(t)
+	defer cleanup()
+
+	request := httptest.NewRequest(http.MethodGet, "/image/artifacts/test.iso", nil)
+	request.Header.Set(authorization, bearer+*token)
+	user, err := validateHTTPRequest(request)
+	require.NoError(t, err)
+	assert.Equal(t, "operator", *user)
+
+	request = httptest.NewRequest(http.MethodGet, "/image/artifacts/test.iso", nil)
+	request.AddCookie(&http.Cookie{Name: tokenCookie, Value: *token})
+	user, err = validateHTTPRequest(request)
+	require.NoError(t, err)
+	assert.Equal(t, "operator", *user)
+
+	// a token in the url ends up in logs and the browser history so it isn't accepted
+	request = httptest.NewRequest(http.MethodGet, "/image/artifacts/test.iso?token="+*token, nil)
+	_, err = validateHTTPRequest(request)
+	assert.Error(t, err)
+}
+
+func TestCreateToken(t *testing.T) {
+	token, cleanup := testToken(t)
+	defer cleanup()
+
+	claims := jwt.MapClaims{}
+	_, _, err := new(jwt.Parser).ParseUnverified(*token, claims)
+	require.NoError(t, err)
+	assert.Equal(t, "operator", claims[username])
+	for key, value := range claims {
+		assert.NotContains(t, strings.ToLower(key), "password")
+		assert.NotEqual(t, "password", value)
+	}
+}
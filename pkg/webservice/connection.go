@@ -0,0 +1,254 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/log"
+)
+
+// the websocket settings used for anything the config doesn't set
+const (
+	defaultMaxMessageSize = 10 << 20
+	defaultMessageRate    = 20
+	defaultMessageBurst   = 50
+	defaultPingInterval   = 30 * time.Second
+	defaultResumeGrace    = 2 * time.Minute
+	defaultReplayBuffer   = 256
+	defaultReplayBytes    = 16 << 20
+	defaultCompression    = 1
+	defaultChunkSize      = 256 << 10
+
+	// how long a write to the websocket, pings included, gets before the connection is given up on
+	writeWait = 10 * time.Second
+)
+
+var errRateLimited = errors.New("Too many requests, slow down")
+
+// connectionOptions are the websocket settings from the config with the defaults filled in
+type connectionOptions struct {
+	allowAll       bool
+	allowedOrigins map[string]bool
+	maxMessageSize int64
+	messageRate    float64
+	messageBurst   int
+	pingInterval   time.Duration
+	resumeGrace    time.Duration
+	replayBuffer   int
+
+	// the outbox is bounded by both the number of messages and their encoded size
+	replayBufferBytes int
+
+	compression      bool
+	compressionLevel int
+	chunkSize        int
+}
+
+// wsOptions is replaced with the options from the config when the webservice starts
+var wsOptions, _ = newConnectionOptions(nil)
+
+// newConnectionOptions fills in the defaults for the settings the config doesn't have
+func newConnectionOptions(ws *configs.WebSocket) (*connectionOptions, error) {
+	c := configs.WebSocket{}
+	if ws != nil {
+		c = *ws
+	}
+
+	options := &connectionOptions{
+		allowedOrigins: map[string]bool{},
+		maxMessageSize: c.MaxMessageSize,
+		messageRate:    c.MessageRate,
+		messageBurst:   c.MessageBurst,
+		pingInterval:   defaultPingInterval,
+		resumeGrace:    defaultResumeGrace,
+		replayBuffer:   c.ReplayBuffer,
+
+		replayBufferBytes: c.ReplayBufferBytes,
+
+		compression:      !c.DisableCompression,
+		compressionLevel: c.CompressionLevel,
+		chunkSize:        c.ChunkSize,
+	}
+
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			options.allowAll = true
+		}
+		options.allowedOrigins[normalizeOrigin(origin)] = true
+	}
+
+	if options.maxMessageSize <= 0 {
+		options.maxMessageSize = defaultMaxMessageSize
+	}
+	if options.messageRate <= 0 {
+		options.messageRate = defaultMessageRate
+	}
+	if options.messageBurst <= 0 {
+		options.messageBurst = defaultMessageBurst
+	}
+	if options.replayBuffer <= 0 {
+		options.replayBuffer = defaultReplayBuffer
+	}
+	if options.replayBufferBytes <= 0 {
+		options.replayBufferBytes = defaultReplayBytes
+	}
+	if options.chunkSize <= 0 {
+		options.chunkSize = defaultChunkSize
+	}
+
+	switch {
+	case options.compressionLevel == 0:
+		options.compressionLevel = defaultCompression
+	case options.compressionLevel < 1 || options.compressionLevel > 9:
+		return nil, fmt.Errorf("invalid websocket compression level %d: must be 1 to 9", options.compressionLevel)
+	}
+
+	if c.PingInterval != "" {
+		interval, err := time.ParseDuration(c.PingInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid websocket ping interval %q: %s", c.PingInterval, err)
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("invalid websocket ping interval %q: must be more than 0", c.PingInterval)
+		}
+		options.pingInterval = interval
+	}
+
+	// a grace period of 0 closes sessions with their connection
+	if c.ResumeGracePeriod != "" {
+		grace, err := time.ParseDuration(c.ResumeGracePeriod)
+		if err != nil {
+			return nil, fmt.Errorf("invalid websocket resume grace period %q: %s", c.ResumeGracePeriod, err)
+		}
+		if grace < 0 {
+			return nil, fmt.Errorf("invalid websocket resume grace period %q: can't be negative", c.ResumeGracePeriod)
+		}
+		options.resumeGrace = grace
+	}
+
+	return options, nil
+}
+
+// readTimeout is how long a connection can go without a message or a pong before it's considered dead
+func (o *connectionOptions) readTimeout() time.Duration {
+	return 2 * o.pingInterval
+}
+
+// checkOrigin allows connections from the UI's own origin and the allowed origins.  Requests without an
+// origin don't come from a browser so there's no cross site request to protect against
+func checkOrigin(request *http.Request) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Host, request.Host) {
+		return true
+	}
+
+	if wsOptions.allowAll || wsOptions.allowedOrigins[normalizeOrigin(origin)] {
+		return true
+	}
+
+	log.Warnf("Refusing websocket connection from origin %s", origin)
+	return false
+}
+
+// normalizeOrigin makes origins comparable, e.g. https://Example.com/ is the same as https://example.com
+func normalizeOrigin(origin string) string {
+	return strings.ToLower(strings.TrimSuffix(origin, "/"))
+}
+
+// rateLimiter is a token bucket, every message takes a token and the tokens come back at rate a second
+// up to burst.  It's shared by the connections of a session so a resume doesn't get a full bucket, the
+// reader of the old connection can still be going when the new one starts
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mutex  sync.Mutex
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// allow takes a token if there's one left
+func (l *rateLimiter) allow(now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// prepareConnection bounds the size of the messages and sets up the read deadline that's pushed out every time
+// the client is heard from, a connection that goes quiet fails its next read and the session is closed
+func prepareConnection(ws *websocket.Conn, options *connectionOptions) error {
+	ws.SetReadLimit(options.maxMessageSize)
+	if err := ws.SetCompressionLevel(options.compressionLevel); err != nil {
+		return err
+	}
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(options.readTimeout()))
+	})
+	return ws.SetReadDeadline(time.Now().Add(options.readTimeout()))
+}
+
+// keepAlive pings the client until the connection is done with, if a ping can't be written the connection
+// is dead and closing it ends the read loop
+func (session *session) keepAlive(ws *websocket.Conn, stop chan struct{}) {
+	ticker := time.NewTicker(session.options.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+			if err != nil {
+				session.onError(err)
+				ws.Close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,234 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+)
+
+// useConnectionOptions swaps in the options for the test, the returned function puts the old ones back
+func useConnectionOptions(t *testing.T, ws *configs.WebSocket) func() {
+	options, err := newConnectionOptions(ws)
+	require.NoError(t, err)
+	old := wsOptions
+	wsOptions = options
+	return func() {
+		wsOptions = old
+	}
+}
+
+func dial(t *testing.T, server *httptest.Server, origin string) (*websocket.Conn, *http.Response, error) {
+	header := http.Header{}
+	if origin != "" {
+		header.Set("Origin", origin)
+	}
+	return websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+}
+
+func TestNewConnectionOptions(t *testing.T) {
+	options, err := newConnectionOptions(nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(defaultMaxMessageSize), options.maxMessageSize)
+	assert.Equal(t, float64(defaultMessageRate), options.messageRate)
+	assert.Equal(t, defaultMessageBurst, options.messageBurst)
+	assert.Equal(t, defaultPingInterval, options.pingInterval)
+	assert.Equal(t, 2*defaultPingInterval, options.readTimeout())
+
+	options, err = newConnectionOptions(&configs.WebSocket{
+		AllowedOrigins: []string{"https://Dashboard.example.com/"},
+		MaxMessageSize: 1024,
+		PingInterval:   "5s",
+	})
+	require.NoError(t, err)
+	assert.True(t, options.allowedOrigins["https://dashboard.example.com"])
+	assert.False(t, options.allowAll)
+	assert.Equal(t, int64(1024), options.maxMessageSize)
+	assert.Equal(t, 5*time.Second, options.pingInterval)
+	assert.Equal(t, defaultResumeGrace, options.resumeGrace)
+	assert.Equal(t, defaultReplayBuffer, options.replayBuffer)
+
+	_, err = newConnectionOptions(&configs.WebSocket{PingInterval: "often"})
+	assert.Error(t, err)
+	_, err = newConnectionOptions(&configs.WebSocket{PingInterval: "-1s"})
+	assert.Error(t, err)
+	_, err = newConnectionOptions(&configs.WebSocket{ResumeGracePeriod: "-1s"})
+	assert.Error(t, err)
+
+	options, err = newConnectionOptions(&configs.WebSocket{ResumeGracePeriod: "0s", ReplayBuffer: 10})
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), options.resumeGrace)
+	assert.Equal(t, 10, options.replayBuffer)
+	assert.True(t, options.compression)
+	assert.Equal(t, defaultCompression, options.compressionLevel)
+	assert.Equal(t, defaultChunkSize, options.chunkSize)
+
+	options, err = newConnectionOptions(&configs.WebSocket{DisableCompression: true, CompressionLevel: 9, ChunkSize: 64})
+	require.NoError(t, err)
+	assert.False(t, options.compression)
+	assert.Equal(t, 9, options.compressionLevel)
+	assert.Equal(t, 64, options.chunkSize)
+
+	_, err = newConnectionOptions(&configs.WebSocket{CompressionLevel: 10})
+	assert.Error(t, err)
+}
+
+func TestCheckOrigin(t *testing.T) {
+	defer useConnectionOptions(t, &configs.WebSocket{AllowedOrigins: []string{"https://allowed.example.com"}})()
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"", true},
+		{"https://localhost:10443", true},
+		{"https://allowed.example.com", true},
+		{"https://ALLOWED.example.com/", true},
+		{"https://evil.example.com", false},
+	}
+	for _, tt := range tests {
+		request := httptest.NewRequest(http.MethodGet, "https://localhost:10443/ws", nil)
+		if tt.origin != "" {
+			request.Header.Set("Origin", tt.origin)
+		}
+		assert.Equal(t, tt.allowed, checkOrigin(request), tt.origin)
+	}
+
+	defer useConnectionOptions(t, &configs.WebSocket{AllowedOrigins: []string{"*"}})()
+	request := httptest.NewRequest(http.MethodGet, "https://localhost:10443/ws", nil)
+	request.Header.Set("Origin", "https://evil.example.com")
+	assert.True(t, checkOrigin(request))
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(10, 2)
+	now := limiter.last
+
+	assert.True(t, limiter.allow(now))
+	assert.True(t, limiter.allow(now))
+	assert.False(t, limiter.allow(now))
+
+	// a token comes back every 100ms
+	assert.True(t, limiter.allow(now.Add(100*time.Millisecond)))
+	assert.False(t, limiter.allow(now.Add(100*time.Millisecond)))
+
+	// the bucket never holds more than the burst
+	later := now.Add(time.Minute)
+	assert.True(t, limiter.allow(later))
+	assert.True(t, limiter.allow(later))
+	assert.False(t, limiter.allow(later))
+}
+
+func TestRateLimiterShared(t *testing.T) {
+	limiter := newRateLimiter(0, 100)
+	now := limiter.last
+
+	// the old and the new connection of a resumed session read at the same time
+	allowed := make(chan bool, 200)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				allowed <- limiter.allow(now)
+			}
+		}()
+	}
+	wg.Wait()
+	close(allowed)
+
+	count := 0
+	for ok := range allowed {
+		if ok {
+			count++
+		}
+	}
+	assert.Equal(t, 100, count)
+}
+
+func TestConnectionOrigin(t *testing.T) {
+	defer useConnectionOptions(t, nil)()
+	server := httptest.NewServer(http.HandlerFunc(onOpen))
+	defer server.Close()
+
+	_, response, err := dial(t, server, "https://evil.example.com")
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+
+	conn, _, err := dial(t, server, server.URL)
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestConnectionLimits(t *testing.T) {
+	defer useConnectionOptions(t, &configs.WebSocket{MaxMessageSize: 512, MessageRate: 1, MessageBurst: 1})()
+	server := httptest.NewServer(http.HandlerFunc(onOpen))
+	defer server.Close()
+
+	conn, _, err := dial(t, server, "")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var message configs.WsMessage
+	require.NoError(t, conn.ReadJSON(&message))
+	assert.Equal(t, configs.Initialize, message.Component)
+
+	// the first message uses up the burst and the second one is turned away
+	keepalive := configs.WsMessage{Type: configs.UI, Component: configs.Keepalive}
+	require.NoError(t, conn.WriteJSON(keepalive))
+	require.NoError(t, conn.ReadJSON(&message))
+	assert.Nil(t, message.Error)
+
+	keepalive.RequestID = "r-2"
+	require.NoError(t, conn.WriteJSON(keepalive))
+	message = configs.WsMessage{}
+	require.NoError(t, conn.ReadJSON(&message))
+	require.NotNil(t, message.Error)
+	assert.Equal(t, errRateLimited.Error(), *message.Error)
+	assert.Equal(t, "r-2", message.RequestID)
+
+	// a message over the size limit closes the connection
+	yaml := strings.Repeat("a", 1024)
+	require.NoError(t, conn.WriteJSON(configs.WsMessage{Type: configs.UI, YAML: yaml}))
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseMessageTooBig), err)
+}
+
+func TestConnectionReaped(t *testing.T) {
+	defer useConnectionOptions(t, &configs.WebSocket{PingInterval: "50ms", ResumeGracePeriod: "100ms"})()
+	server := httptest.NewServer(http.HandlerFunc(onOpen))
+	defer server.Close()
+
+	before := len(allSessions())
+
+	// the client never reads so it never answers the pings, the session goes once the grace period is up
+	conn, _, err := dial(t, server, "")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	assert.Eventually(t, func() bool { return len(allSessions()) == before+1 }, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool { return len(allSessions()) == before }, 2*time.Second, 10*time.Millisecond)
+}
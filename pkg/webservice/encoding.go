@@ -0,0 +1,196 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"opendev.org/airship/airshipui/pkg/cbor"
+	"opendev.org/airship/airshipui/pkg/configs"
+)
+
+// the encodings a client can ask for with ?encoding=, JSON is the default
+const (
+	jsonEncoding = "json"
+	cborEncoding = "cbor"
+
+	// messages smaller than this aren't worth compressing
+	compressionThreshold = 1024
+)
+
+// codec turns messages into websocket frames and back
+type codec interface {
+	name() string
+	frameType() int
+	marshal(configs.WsMessage) ([]byte, error)
+	unmarshal([]byte, *configs.WsMessage) error
+	// decode is the frame as plain JSON values, the way it's checked against the schema of its message
+	decode([]byte) (interface{}, error)
+}
+
+var codecs = map[string]codec{
+	jsonEncoding: jsonCodec{},
+	cborEncoding: cborCodec{},
+}
+
+// negotiateEncoding picks the codec for the encoding the client asked for
+func negotiateEncoding(requested string) (codec, error) {
+	if requested == "" {
+		return codecs[jsonEncoding], nil
+	}
+	c, ok := codecs[requested]
+	if !ok {
+		return nil, fmt.Errorf("Encoding %q is not supported, use %s or %s", requested, jsonEncoding, cborEncoding)
+	}
+	return c, nil
+}
+
+// codecFor is the codec for frames of the type, clients can send either whatever they get back
+func codecFor(frameType int) codec {
+	if frameType == websocket.BinaryMessage {
+		return codecs[cborEncoding]
+	}
+	return codecs[jsonEncoding]
+}
+
+// jsonCodec sends messages as JSON text frames, the way it's always been done
+type jsonCodec struct{}
+
+func (jsonCodec) name() string {
+	return jsonEncoding
+}
+
+func (jsonCodec) frameType() int {
+	return websocket.TextMessage
+}
+
+func (jsonCodec) marshal(message configs.WsMessage) ([]byte, error) {
+	return json.Marshal(message)
+}
+
+func (jsonCodec) unmarshal(b []byte, message *configs.WsMessage) error {
+	return json.Unmarshal(b, message)
+}
+
+func (jsonCodec) decode(b []byte) (interface{}, error) {
+	var value interface{}
+	err := json.Unmarshal(b, &value)
+	return value, err
+}
+
+// cborCodec sends messages as CBOR binary frames.  The message goes through JSON first so every type encodes
+// the way it always has, the base64 YAML is sent as the bytes it stands for which is where most of the savings are
+type cborCodec struct{}
+
+func (cborCodec) name() string {
+	return cborEncoding
+}
+
+func (cborCodec) frameType() int {
+	return websocket.BinaryMessage
+}
+
+func (cborCodec) marshal(message configs.WsMessage) ([]byte, error) {
+	b, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	var value map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err = d.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	// YAML that isn't base64 is left as it is
+	if message.YAML != "" {
+		if yaml, err := base64.StdEncoding.DecodeString(message.YAML); err == nil {
+			value["yaml"] = cbor.Base64(yaml)
+		}
+	}
+
+	return cbor.Marshal(value)
+}
+
+func (cborCodec) unmarshal(b []byte, message *configs.WsMessage) error {
+	value, err := cbor.Unmarshal(b)
+	if err != nil {
+		return err
+	}
+
+	if b, err = json.Marshal(value); err != nil {
+		return err
+	}
+	return json.Unmarshal(b, message)
+}
+
+func (cborCodec) decode(b []byte) (interface{}, error) {
+	value, err := cbor.Unmarshal(b)
+	if err != nil {
+		return nil, err
+	}
+
+	// the schema only knows about JSON, e.g. byte strings are base64 and every number is a float64
+	if b, err = json.Marshal(value); err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	err = json.Unmarshal(b, &decoded)
+	return decoded, err
+}
+
+// chunk splits a message with YAML longer than the size into messages that carry a piece of it each, the last
+// one has the rest of the message.  The pieces are cut on base64 boundaries so each one decodes by itself
+func chunk(message configs.WsMessage, size int) []configs.WsMessage {
+	size -= size % 4
+	if size <= 0 || len(message.YAML) <= size {
+		return []configs.WsMessage{message}
+	}
+
+	yaml := message.YAML
+	count := (len(yaml) + size - 1) / size
+	id := uuid.New().String()
+
+	chunks := make([]configs.WsMessage, 0, count)
+	for i := 0; i < count; i++ {
+		piece := configs.WsMessage{
+			Type:         message.Type,
+			Component:    message.Component,
+			SubComponent: message.SubComponent,
+			RequestID:    message.RequestID,
+			Topic:        message.Topic,
+			TraceID:      message.TraceID,
+		}
+		if i == count-1 {
+			piece = message
+		}
+
+		end := (i + 1) * size
+		if end > len(yaml) {
+			end = len(yaml)
+		}
+		piece.YAML = yaml[i*size : end]
+		piece.Chunk = &configs.Chunk{ID: id, Index: i, Count: count, Size: len(yaml)}
+		chunks = append(chunks, piece)
+	}
+
+	return chunks
+}
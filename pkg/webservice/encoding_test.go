@@ -0,0 +1,225 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	c, err := negotiateEncoding("")
+	require.NoError(t, err)
+	assert.Equal(t, jsonEncoding, c.name())
+	assert.Equal(t, websocket.TextMessage, c.frameType())
+
+	c, err = negotiateEncoding(cborEncoding)
+	require.NoError(t, err)
+	assert.Equal(t, cborEncoding, c.name())
+	assert.Equal(t, websocket.BinaryMessage, c.frameType())
+
+	_, err = negotiateEncoding("msgpack")
+	assert.Error(t, err)
+
+	assert.Equal(t, jsonEncoding, codecFor(websocket.TextMessage).name())
+	assert.Equal(t, cborEncoding, codecFor(websocket.BinaryMessage).name())
+}
+
+func TestCBORCodec(t *testing.T) {
+	yaml := strings.Repeat("apiVersion: v1\nkind: ConfigMap\n", 100)
+	e := "nope"
+	message := configs.WsMessage{
+		Type:         configs.CTL,
+		Component:    configs.Phase,
+		SubComponent: configs.GetYaml,
+		Sequence:     12,
+		Error:        &e,
+		Data:         map[string]interface{}{"count": 3, "ratio": 0.5, "names": []string{"a", "b"}},
+		YAML:         base64.StdEncoding.EncodeToString([]byte(yaml)),
+	}
+
+	c := codecs[cborEncoding]
+	b, err := c.marshal(message)
+	require.NoError(t, err)
+
+	j, err := codecs[jsonEncoding].marshal(message)
+	require.NoError(t, err)
+	// the YAML is sent as bytes instead of base64
+	assert.Less(t, len(b), len(j)*4/5)
+
+	var decoded configs.WsMessage
+	require.NoError(t, c.unmarshal(b, &decoded))
+	assert.Equal(t, message.YAML, decoded.YAML)
+	assert.Equal(t, message.Sequence, decoded.Sequence)
+	assert.Equal(t, e, *decoded.Error)
+
+	// the data comes back the way JSON would have it
+	expected, err := json.Marshal(message.Data)
+	require.NoError(t, err)
+	actual, err := json.Marshal(decoded.Data)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(expected), string(actual))
+
+	// what the schema checks is the same as if the message had come as JSON
+	value, err := c.decode(b)
+	require.NoError(t, err)
+	var fromJSON interface{}
+	require.NoError(t, json.Unmarshal(j, &fromJSON))
+	assert.Equal(t, fromJSON, value)
+
+	// YAML that isn't base64 goes as a string
+	message.YAML = "not base64!"
+	b, err = c.marshal(message)
+	require.NoError(t, err)
+	require.NoError(t, c.unmarshal(b, &decoded))
+	assert.Equal(t, "not base64!", decoded.YAML)
+
+	assert.Error(t, c.unmarshal([]byte{0xff}, &decoded))
+	_, err = c.decode([]byte{0xff})
+	assert.Error(t, err)
+}
+
+func TestChunk(t *testing.T) {
+	message := configs.WsMessage{
+		Type:         configs.CTL,
+		Component:    configs.Phase,
+		SubComponent: configs.GetYaml,
+		RequestID:    "r-1",
+		Name:         "bundle",
+		YAML:         base64.StdEncoding.EncodeToString([]byte(strings.Repeat("kind: Secret\n", 10))),
+	}
+
+	// small enough to go in one
+	assert.Equal(t, []configs.WsMessage{message}, chunk(message, len(message.YAML)))
+
+	// the size is rounded down to a base64 boundary
+	chunks := chunk(message, 50)
+	require.Len(t, chunks, (len(message.YAML)+47)/48)
+
+	yaml := ""
+	for i, c := range chunks {
+		require.NotNil(t, c.Chunk)
+		assert.Equal(t, chunks[0].Chunk.ID, c.Chunk.ID)
+		assert.Equal(t, i, c.Chunk.Index)
+		assert.Equal(t, len(chunks), c.Chunk.Count)
+		assert.Equal(t, len(message.YAML), c.Chunk.Size)
+		assert.Equal(t, "r-1", c.RequestID)
+		assert.Equal(t, configs.GetYaml, c.SubComponent)
+
+		// every piece decodes by itself
+		_, err := base64.StdEncoding.DecodeString(c.YAML)
+		assert.NoError(t, err)
+		yaml += c.YAML
+	}
+	assert.Equal(t, message.YAML, yaml)
+
+	// only the last one has the rest of the message
+	assert.Empty(t, chunks[0].Name)
+	assert.Equal(t, "bundle", chunks[len(chunks)-1].Name)
+}
+
+func TestEncodingNegotiated(t *testing.T) {
+	defer useConnectionOptions(t, &configs.WebSocket{ChunkSize: 8})()
+	server := httptest.NewServer(http.HandlerFunc(onOpen))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	dialer := websocket.Dialer{EnableCompression: true}
+	conn, response, err := dialer.Dial(url+"?encoding=cbor&protocol=2", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Contains(t, response.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate")
+
+	read := func() configs.WsMessage {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		frameType, b, err := conn.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, websocket.BinaryMessage, frameType)
+
+		var message configs.WsMessage
+		require.NoError(t, codecs[cborEncoding].unmarshal(b, &message))
+		return message
+	}
+
+	init := read()
+	assert.Equal(t, configs.Initialize, init.Component)
+	assert.Equal(t, cborEncoding, init.Encoding)
+	assert.Equal(t, 2, init.ProtocolVersion)
+
+	// requests can be sent either way, this one's CBOR
+	b, err := codecs[cborEncoding].marshal(configs.WsMessage{Type: configs.UI, Component: configs.Keepalive})
+	require.NoError(t, err)
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, b))
+	assert.Equal(t, configs.Keepalive, read().Component)
+
+	// a client that takes chunks gets the YAML in pieces
+	s, ok := getSession(init.SessionID)
+	require.True(t, ok)
+	yaml := base64.StdEncoding.EncodeToString([]byte("kind: ConfigMap\n"))
+	require.NoError(t, s.webSocketSend(configs.WsMessage{Type: configs.CTL, Component: configs.Phase, YAML: yaml}))
+
+	received := ""
+	for i := 0; i < 3; i++ {
+		message := read()
+		require.NotNil(t, message.Chunk)
+		assert.Equal(t, i, message.Chunk.Index)
+		assert.Equal(t, 3, message.Chunk.Count)
+		received += message.YAML
+	}
+	assert.Equal(t, yaml, received)
+
+	// an encoding the backend doesn't speak is refused in JSON
+	refused, _, err := websocket.DefaultDialer.Dial(url+"?encoding=xml", nil)
+	require.NoError(t, err)
+	defer refused.Close()
+	message := readMessage(t, refused)
+	require.NotNil(t, message.Error)
+	assert.Contains(t, *message.Error, "not supported")
+}
+
+func TestChunksNeedProtocol(t *testing.T) {
+	defer useConnectionOptions(t, &configs.WebSocket{ChunkSize: 8})()
+	server := httptest.NewServer(http.HandlerFunc(onOpen))
+	defer server.Close()
+
+	// clients that don't say which protocol they speak get the YAML in one piece
+	conn, _, err := dial(t, server, "")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	init := readMessage(t, conn)
+	assert.Equal(t, configs.MinProtocolVersion, init.ProtocolVersion)
+	assert.Equal(t, jsonEncoding, init.Encoding)
+
+	s, ok := getSession(init.SessionID)
+	require.True(t, ok)
+	yaml := base64.StdEncoding.EncodeToString([]byte("kind: ConfigMap\n"))
+	require.NoError(t, s.webSocketSend(configs.WsMessage{Type: configs.CTL, Component: configs.Phase, YAML: yaml}))
+
+	message := readMessage(t, conn)
+	assert.Nil(t, message.Chunk)
+	assert.Equal(t, yaml, message.YAML)
+}
@@ -0,0 +1,217 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/cryptography"
+	"opendev.org/airship/airshipui/pkg/log"
+	"opendev.org/airship/airshipui/pkg/statistics"
+)
+
+const (
+	healthy   = "ok"
+	unhealthy = "failed"
+
+	// warn before the certs expire so there is time to rotate them
+	certExpiryWarning = 14 * 24 * time.Hour
+	dialTimeout       = 3 * time.Second
+
+	// the ready checks start plugin processes and dial the dashboards, so a report is reused for this long
+	// rather than running them again for every probe
+	readyReportTTL = 5 * time.Second
+)
+
+// /healthz is a bare liveness ping, it answers as long as the process can serve http.  Phase runs take a long
+// time so a check of the workers would get a busy instance restarted in the middle of one
+// readyChecks are everything the instance needs to serve the UI, e.g. config, certs and databases, for /readyz
+// The shutdown check isn't cached, traffic has to move elsewhere as soon as a shutdown starts
+var (
+	readyChecks = map[string]func() error{
+		"statistics":   statistics.Check,
+		"certificates": checkCertificates,
+	}
+
+	readyReport  healthReport
+	readyChecked time.Time
+	readyMutex   sync.Mutex
+)
+
+// healthReport is the json returned by the health endpoints
+type healthReport struct {
+	Status    string                 `json:"status"`
+	Timestamp int64                  `json:"timestamp"`
+	Checks    map[string]checkResult `json:"checks"`
+}
+
+// checkResult is the outcome of a single check of the report
+type checkResult struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Elapsed int64  `json:"elapsed"`
+}
+
+// AppendToReadyChecks allows other packages to add a check of something the UI depends on to /readyz
+func AppendToReadyChecks(name string, check func() error) {
+	readyMutex.Lock()
+	defer readyMutex.Unlock()
+	readyChecks[name] = check
+	readyChecked = time.Time{}
+}
+
+// handleHealth answers as long as the process is up, it has no checks
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, runChecks(map[string]func() error{}))
+}
+
+// handleReady reports if this instance can serve the UI, a failing check means traffic should go elsewhere
+func handleReady(w http.ResponseWriter, r *http.Request) {
+	report := cachedReadyReport()
+
+	shutdown := runChecks(map[string]func() error{"shutdown": checkShutdown})
+	report.Checks["shutdown"] = shutdown.Checks["shutdown"]
+	if shutdown.Status != healthy {
+		report.Status = unhealthy
+	}
+
+	writeReport(w, report)
+}
+
+// cachedReadyReport runs the ready checks unless they were run within the ttl, a copy of the report is returned
+// Probes that come in while the checks are running wait for the same report
+func cachedReadyReport() healthReport {
+	readyMutex.Lock()
+	defer readyMutex.Unlock()
+
+	if time.Since(readyChecked) >= readyReportTTL {
+		readyReport = runChecks(readyChecks)
+		readyChecked = time.Now()
+	}
+
+	report := readyReport
+	report.Checks = make(map[string]checkResult, len(readyReport.Checks)+1)
+	for name, result := range readyReport.Checks {
+		report.Checks[name] = result
+	}
+	return report
+}
+
+// runChecks runs all the checks at the same time and collects them into a report
+func runChecks(checks map[string]func() error) healthReport {
+	report := healthReport{
+		Status:    healthy,
+		Timestamp: time.Now().UnixNano() / 1000000,
+		Checks:    map[string]checkResult{},
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func() error) {
+			defer wg.Done()
+
+			started := time.Now()
+			err := check()
+			result := checkResult{
+				Status:  healthy,
+				Elapsed: time.Since(started).Milliseconds(),
+			}
+			if err != nil {
+				result.Status = unhealthy
+				result.Error = err.Error()
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			report.Checks[name] = result
+			if err != nil {
+				report.Status = unhealthy
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// writeReport sends the report with a 503 if any of the checks failed
+func writeReport(w http.ResponseWriter, report healthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Errorf("Error writing health report: %s", err)
+	}
+}
+
+// checkCertificates makes sure the webservice certs are not expired or about to expire
+func checkCertificates() error {
+	if configs.UIConfig.WebService == nil {
+		return fmt.Errorf("no webservice defined in %s", configs.UIConfigFile)
+	}
+
+	notAfter, err := cryptography.CertExpiry(configs.UIConfig.WebService.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	if time.Until(notAfter) < certExpiryWarning {
+		return fmt.Errorf("certificate %s expires on %s", configs.UIConfig.WebService.PublicKey,
+			notAfter.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// addDashboardCheck adds a readiness check that the dashboard behind a proxy can be reached
+func addDashboardCheck(name string, target *url.URL) {
+	AppendToReadyChecks("dashboard "+name, func() error {
+		return checkReachable(target)
+	})
+}
+
+// checkReachable makes sure a tcp connection can be made to the host of the url
+func checkReachable(target *url.URL) error {
+	if target == nil {
+		return fmt.Errorf("no target url")
+	}
+
+	address := target.Host
+	if target.Port() == "" {
+		port := "80"
+		if target.Scheme == "https" {
+			port = "443"
+		}
+		address = net.JoinHostPort(target.Hostname(), port)
+	}
+
+	conn, err := net.DialTimeout(tcp, address, dialTimeout)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
@@ -0,0 +1,110 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunChecks(t *testing.T) {
+	report := runChecks(map[string]func() error{
+		"good": func() error { return nil },
+		"bad":  func() error { return errors.New("broken") },
+	})
+
+	assert.Equal(t, unhealthy, report.Status)
+	assert.Equal(t, healthy, report.Checks["good"].Status)
+	assert.Equal(t, unhealthy, report.Checks["bad"].Status)
+	assert.Equal(t, "broken", report.Checks["bad"].Error)
+
+	report = runChecks(map[string]func() error{
+		"good": func() error { return nil },
+	})
+	assert.Equal(t, healthy, report.Status)
+}
+
+func TestWriteReport(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writeReport(recorder, runChecks(map[string]func() error{
+		"bad": func() error { return errors.New("broken") },
+	}))
+
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	report := healthReport{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.Equal(t, unhealthy, report.Status)
+	assert.Contains(t, report.Checks, "bad")
+}
+
+func TestHealthAndReady(t *testing.T) {
+	_, ok := readyChecks["certificates"]
+	assert.True(t, ok)
+
+	calls := 0
+	name := "test ready"
+	AppendToReadyChecks(name, func() error {
+		calls++
+		return errors.New("broken")
+	})
+	defer func() {
+		readyMutex.Lock()
+		delete(readyChecks, name)
+		readyChecked = time.Time{}
+		readyMutex.Unlock()
+	}()
+
+	// liveness doesn't depend on anything the instance needs to serve the UI
+	recorder := httptest.NewRecorder()
+	handleHealth(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	for i := 0; i < 3; i++ {
+		recorder = httptest.NewRecorder()
+		handleReady(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		report := healthReport{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+		assert.Equal(t, unhealthy, report.Checks[name].Status)
+		assert.Equal(t, healthy, report.Checks["shutdown"].Status)
+	}
+
+	// the probes within the ttl get the same report
+	assert.Equal(t, 1, calls)
+}
+
+func TestCheckReachable(t *testing.T) {
+	listener, err := net.Listen(tcp, localhost0)
+	require.NoError(t, err)
+
+	target, err := url.Parse("http://" + listener.Addr().String())
+	require.NoError(t, err)
+	assert.NoError(t, checkReachable(target))
+
+	// once the listener is gone the dashboard can't be reached
+	require.NoError(t, listener.Close())
+	assert.Error(t, checkReachable(target))
+}
@@ -0,0 +1,86 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"opendev.org/airship/airshipui/pkg/log"
+)
+
+// loggingRoute lets the log format and levels be read and changed without a restart
+const loggingRoute = "/admin/logging"
+
+// loggingSettings is the json read and written by the logging route
+// A level of 0 leaves the default level alone, a subsystem set to 0 goes back to the default level
+type loggingSettings struct {
+	Format string         `json:"format,omitempty"`
+	Level  int            `json:"level,omitempty"`
+	Levels map[string]int `json:"levels,omitempty"`
+}
+
+// handleLogging returns the current logging settings on a GET and changes them on a PUT
+func handleLogging(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		settings := loggingSettings{}
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := applyLoggingSettings(settings); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	level, levels := log.Levels()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(loggingSettings{Format: log.Format(), Level: level, Levels: levels}); err != nil {
+		log.Errorf("Error writing logging settings: %s", err)
+	}
+}
+
+// applyLoggingSettings checks and applies the settings, nothing changes if any of them are invalid
+func applyLoggingSettings(settings loggingSettings) error {
+	if settings.Format != "" && settings.Format != log.TextFormat && settings.Format != log.JSONFormat {
+		return fmt.Errorf("unknown log format %s, expected %s or %s", settings.Format, log.TextFormat, log.JSONFormat)
+	}
+
+	level, _ := log.Levels()
+	if settings.Level != 0 {
+		level = settings.Level
+	}
+
+	if err := log.SetLevels(level, settings.Levels); err != nil {
+		return err
+	}
+
+	if settings.Format != "" {
+		if err := log.SetFormat(settings.Format); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Logging changed to format %s, level %d, subsystem levels %v", log.Format(), level, settings.Levels)
+	return nil
+}
@@ -0,0 +1,91 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"opendev.org/airship/airshipui/pkg/log"
+)
+
+func TestRequireLocal(t *testing.T) {
+	handler := requireLocal(func(w http.ResponseWriter, r *http.Request) {})
+
+	for addr, code := range map[string]int{
+		"127.0.0.1:5000":   http.StatusOK,
+		"[::1]:5000":       http.StatusOK,
+		"192.0.2.1:5000":   http.StatusForbidden,
+		"[2001:db8::1]:80": http.StatusForbidden,
+		"localhost":        http.StatusForbidden,
+	} {
+		request := httptest.NewRequest(http.MethodGet, loggingRoute, nil)
+		request.RemoteAddr = addr
+		recorder := httptest.NewRecorder()
+		handler(recorder, request)
+		assert.Equal(t, code, recorder.Code, addr)
+	}
+}
+
+func TestHandleLogging(t *testing.T) {
+	output := new(bytes.Buffer)
+	log.Init(4, output)
+	defer func() {
+		log.Init(4, os.Stderr)
+		require.NoError(t, log.SetFormat(log.TextFormat))
+		require.NoError(t, log.SetLevels(4, map[string]int{"webservice": 0}))
+	}()
+
+	// the webservice is quieted down while everything else stays at info
+	recorder := httptest.NewRecorder()
+	handleLogging(recorder, httptest.NewRequest(http.MethodPut, loggingRoute,
+		strings.NewReader(`{"format": "json", "levels": {"webservice": 2}}`)))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	settings := loggingSettings{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &settings))
+	assert.Equal(t, loggingSettings{Format: log.JSONFormat, Level: 4, Levels: map[string]int{"webservice": 2}}, settings)
+
+	output.Reset()
+	log.Info("not written, this file is part of the webservice")
+	log.Error("written")
+	assert.NotContains(t, output.String(), "not written")
+	assert.Contains(t, output.String(), `"subsystem":"webservice"`)
+
+	recorder = httptest.NewRecorder()
+	handleLogging(recorder, httptest.NewRequest(http.MethodGet, loggingRoute, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &settings))
+	assert.Equal(t, 2, settings.Levels["webservice"])
+
+	// bad settings change nothing
+	for _, body := range []string{`{"format": "xml"}`, `{"level": 9}`, `{"levels": {"nope": 5}}`, `{`} {
+		recorder = httptest.NewRecorder()
+		handleLogging(recorder, httptest.NewRequest(http.MethodPut, loggingRoute, strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, body)
+	}
+	assert.Equal(t, log.JSONFormat, log.Format())
+
+	recorder = httptest.NewRecorder()
+	handleLogging(recorder, httptest.NewRequest(http.MethodDelete, loggingRoute, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
@@ -0,0 +1,156 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/log"
+	"opendev.org/airship/airshipui/pkg/schema"
+)
+
+// schemaRoute serves the schemas of the messages, the index of them all or a single one, e.g. /schema/ctl/phase/run
+const schemaRoute = "/schema"
+
+// subprotocolPrefix names the protocol versions as websocket subprotocols, e.g. airshipui.v2
+const subprotocolPrefix = "airshipui.v"
+
+// schemaIndex is everything a client needs to check it's talking the same protocol as the backend
+type schemaIndex struct {
+	ProtocolVersion    int                       `json:"protocolVersion"`
+	MinProtocolVersion int                       `json:"minProtocolVersion"`
+	Messages           map[string]*schema.Schema `json:"messages"`
+}
+
+// negotiateProtocol picks the protocol version for a client that speaks up to the requested one, clients that
+// don't say are from before there were versions and speak the first.  Clients that are too old get an error
+func negotiateProtocol(requested string) (int, error) {
+	if requested == "" {
+		return configs.MinProtocolVersion, nil
+	}
+
+	version, err := strconv.Atoi(requested)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid protocol version %q", requested)
+	}
+	if version < configs.MinProtocolVersion {
+		return 0, fmt.Errorf("Protocol version %d is no longer supported, the UI needs to speak %d to %d",
+			version, configs.MinProtocolVersion, configs.ProtocolVersion)
+	}
+	if version > configs.ProtocolVersion {
+		version = configs.ProtocolVersion
+	}
+
+	return version, nil
+}
+
+// negotiateSubprotocol picks the newest protocol version of the subprotocols the client offered, it's false when
+// the client didn't offer any and the version has to come from the query.  None of them being one the backend
+// speaks is an error, so the client can be turned away before the websocket is opened
+func negotiateSubprotocol(offered []string) (int, bool, error) {
+	version := 0
+	found := false
+	for _, protocol := range offered {
+		if !strings.HasPrefix(protocol, subprotocolPrefix) {
+			continue
+		}
+		found = true
+
+		v, err := strconv.Atoi(strings.TrimPrefix(protocol, subprotocolPrefix))
+		if err == nil && v >= configs.MinProtocolVersion && v <= configs.ProtocolVersion && v > version {
+			version = v
+		}
+	}
+
+	switch {
+	case !found:
+		return 0, false, nil
+	case version == 0:
+		return 0, true, fmt.Errorf("None of the protocol versions %s are supported, the UI needs to speak %d to %d",
+			strings.Join(offered, ", "), configs.MinProtocolVersion, configs.ProtocolVersion)
+	}
+	return version, true, nil
+}
+
+// subprotocol is the subprotocol of the protocol version
+func subprotocol(version int) string {
+	return subprotocolPrefix + strconv.Itoa(version)
+}
+
+// refuseProtocol lets the client know why it can't be served and closes the connection
+func refuseProtocol(ws *websocket.Conn, c codec, err error) {
+	defer ws.Close()
+
+	e := err.Error()
+	if err := write(ws, c, configs.WsMessage{
+		Type:            configs.UI,
+		Component:       configs.Initialize,
+		ProtocolVersion: configs.ProtocolVersion,
+		Timestamp:       time.Now().UnixNano() / 1000000,
+		Error:           &e,
+	}); err != nil {
+		log.Errorf("Error sending protocol error: %s", err)
+		return
+	}
+
+	message := websocket.FormatCloseMessage(websocket.CloseProtocolError, e)
+	if err := ws.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeWait)); err != nil {
+		log.Errorf("Error closing websocket: %s", err)
+	}
+}
+
+// validateRequest checks the request against the schema of its message before it's handled
+func validateRequest(value interface{}) error {
+	if err := schema.Validate(value); err != nil {
+		return fmt.Errorf("Invalid %s message: %s", schema.KeyOf(value), err)
+	}
+	return nil
+}
+
+// handleSchema serves the schema index or the schema of the message in the path
+func handleSchema(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		response.Header().Set("Allow", http.MethodGet)
+		http.Error(response, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body interface{} = schemaIndex{
+		ProtocolVersion:    configs.ProtocolVersion,
+		MinProtocolVersion: configs.MinProtocolVersion,
+		Messages:           schema.Documents(),
+	}
+
+	if key := strings.Trim(strings.TrimPrefix(request.URL.Path, schemaRoute), "/"); key != "" {
+		document, ok := schema.Documents()[key]
+		if !ok {
+			http.Error(response, fmt.Sprintf("No schema for %s", key), http.StatusNotFound)
+			return
+		}
+		body = document
+	}
+
+	response.Header().Set("Content-Type", "application/schema+json")
+	if err := json.NewEncoder(response).Encode(body); err != nil {
+		log.Errorf("Error writing schema: %s", err)
+	}
+}
@@ -0,0 +1,178 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+)
+
+func TestNegotiateProtocol(t *testing.T) {
+	version, err := negotiateProtocol("")
+	require.NoError(t, err)
+	assert.Equal(t, configs.MinProtocolVersion, version)
+
+	version, err = negotiateProtocol(strconv.Itoa(configs.ProtocolVersion + 5))
+	require.NoError(t, err)
+	assert.Equal(t, configs.ProtocolVersion, version)
+
+	_, err = negotiateProtocol(strconv.Itoa(configs.MinProtocolVersion - 1))
+	assert.Error(t, err)
+	_, err = negotiateProtocol("latest")
+	assert.Error(t, err)
+}
+
+func TestProtocolHandshake(t *testing.T) {
+	defer useConnectionOptions(t, nil)()
+	server := httptest.NewServer(http.HandlerFunc(onOpen))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?protocol="+strconv.Itoa(configs.ProtocolVersion), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	init := readMessage(t, conn)
+	assert.Equal(t, configs.Initialize, init.Component)
+	assert.Equal(t, configs.ProtocolVersion, init.ProtocolVersion)
+	assert.Nil(t, init.Error)
+
+	// requests that don't fit their schema are turned away before they're handled
+	require.NoError(t, conn.WriteJSON(configs.WsMessage{
+		Type:         configs.UI,
+		Component:    configs.Task,
+		SubComponent: configs.TaskRemove,
+		RequestID:    "r-1",
+	}))
+	response := readMessage(t, conn)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "Invalid ui/task/taskRemove message: id is required", *response.Error)
+	assert.Equal(t, "r-1", response.RequestID)
+
+	// frames that aren't a message are answered too, the connection stays open
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage,
+		[]byte(`{"type": "ui", "component": "task", "subComponent": "taskRemove", "requestID": "r-2", "id": 5}`)))
+	response = readMessage(t, conn)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "Invalid ui/task/taskRemove message: id must be string, not integer", *response.Error)
+	assert.Equal(t, "r-2", response.RequestID)
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "ui",`)))
+	response = readMessage(t, conn)
+	require.NotNil(t, response.Error)
+	assert.Contains(t, *response.Error, "Invalid message")
+
+	require.NoError(t, conn.WriteJSON(configs.WsMessage{
+		Type:         configs.UI,
+		Component:    configs.Task,
+		SubComponent: configs.TaskRemove,
+		RequestID:    "r-3",
+	}))
+	response = readMessage(t, conn)
+	assert.Equal(t, "r-3", response.RequestID)
+
+	// a client that's too old is told why and let go
+	old, _, err := websocket.DefaultDialer.Dial(url+"?protocol="+strconv.Itoa(configs.MinProtocolVersion-1), nil)
+	require.NoError(t, err)
+	defer old.Close()
+
+	refused := readMessage(t, old)
+	require.NotNil(t, refused.Error)
+	assert.Contains(t, *refused.Error, "no longer supported")
+	_, _, err = old.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseProtocolError), err)
+}
+
+func TestNegotiateSubprotocol(t *testing.T) {
+	_, offered, err := negotiateSubprotocol(nil)
+	assert.NoError(t, err)
+	assert.False(t, offered)
+
+	// the newest version both sides speak is picked
+	version, offered, err := negotiateSubprotocol([]string{subprotocol(configs.MinProtocolVersion),
+		subprotocol(configs.ProtocolVersion), subprotocol(configs.ProtocolVersion + 1), "chat"})
+	require.NoError(t, err)
+	assert.True(t, offered)
+	assert.Equal(t, configs.ProtocolVersion, version)
+
+	_, offered, err = negotiateSubprotocol([]string{subprotocol(configs.MinProtocolVersion - 1), "airshipui.vlatest"})
+	assert.Error(t, err)
+	assert.True(t, offered)
+}
+
+func TestSubprotocolHandshake(t *testing.T) {
+	defer useConnectionOptions(t, nil)()
+	server := httptest.NewServer(http.HandlerFunc(onOpen))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	// the version in the subprotocol wins over the query
+	dialer := websocket.Dialer{Subprotocols: []string{subprotocol(configs.MinProtocolVersion)}}
+	conn, _, err := dialer.Dial(url+"?protocol="+strconv.Itoa(configs.ProtocolVersion), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, subprotocol(configs.MinProtocolVersion), conn.Subprotocol())
+
+	init := readMessage(t, conn)
+	assert.Equal(t, configs.MinProtocolVersion, init.ProtocolVersion)
+	assert.Nil(t, init.Error)
+
+	// a client the backend can't speak to never gets a websocket
+	dialer = websocket.Dialer{Subprotocols: []string{subprotocol(configs.MinProtocolVersion - 1)}}
+	_, resp, err := dialer.Dial(url, nil)
+	assert.Equal(t, websocket.ErrBadHandshake, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestHandleSchema(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	handleSchema(recorder, httptest.NewRequest(http.MethodGet, schemaRoute, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/schema+json", recorder.Header().Get("Content-Type"))
+
+	index := struct {
+		ProtocolVersion int                               `json:"protocolVersion"`
+		Messages        map[string]map[string]interface{} `json:"messages"`
+	}{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &index))
+	assert.Equal(t, configs.ProtocolVersion, index.ProtocolVersion)
+	assert.Contains(t, index.Messages, "ui/topic/subscribe")
+
+	recorder = httptest.NewRecorder()
+	handleSchema(recorder, httptest.NewRequest(http.MethodGet, schemaRoute+"/ui/topic/subscribe", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	document := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &document))
+	assert.Equal(t, "ui/topic/subscribe", document["title"])
+
+	recorder = httptest.NewRecorder()
+	handleSchema(recorder, httptest.NewRequest(http.MethodGet, schemaRoute+"/ui/nope", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handleSchema(recorder, httptest.NewRequest(http.MethodPost, schemaRoute, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
@@ -22,6 +22,7 @@ import (
 
 	"opendev.org/airship/airshipui/pkg/configs"
 	"opendev.org/airship/airshipui/pkg/log"
+	"opendev.org/airship/airshipui/pkg/metrics"
 )
 
 // map of proxy targets which will be used based on the request
@@ -104,13 +105,20 @@ func getRandomPort() (*string, error) {
 }
 
 // proxyServer will proxy dashboard connections allowing us to inject headers
-func proxyServer(port string) {
+func proxyServer(dashboard, port string) {
 	proxyServerMux := http.NewServeMux()
 
 	// some things may need a helping hand with the headers so we'll proxy it for them
-	proxyServerMux.HandleFunc("/", handleProxy)
+	proxyServerMux.Handle("/", metrics.InstrumentProxy(dashboard, http.HandlerFunc(handleProxy)))
 
-	if err := http.ListenAndServe(port, proxyServerMux); err != nil {
+	proxy := &http.Server{
+		Addr:     port,
+		Handler:  proxyServerMux,
+		ErrorLog: log.Logger(),
+	}
+	addServer(proxy, true)
+
+	if err := proxy.ListenAndServe(); err != http.ErrServerClosed {
 		log.Fatal("Error starting proxy: ", err)
 	}
 }
@@ -134,6 +142,7 @@ func startProxies() {
 
 		// set the target for the proxied request to the original url
 		proxyMap[*port] = target
+		addDashboardCheck(dashboard.Name, target)
 
 		// set the target for the link in the ui to the proxy address
 		dashboard.BaseURL = "http://" + *port
@@ -145,6 +154,6 @@ func startProxies() {
 		configs.UIConfig.Dashboards[index] = dashboard
 
 		// and away we go.........
-		go proxyServer(*port)
+		go proxyServer(dashboard.Name, *port)
 	}
 }
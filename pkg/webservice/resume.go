@@ -0,0 +1,218 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/log"
+)
+
+var (
+	errSessionClosed = errors.New("session is closed")
+	// the messages kept for the session were sent for the version it was speaking, e.g. YAML split into chunks,
+	// a client that has gone back to an older one can't take them
+	errProtocolLowered = errors.New("session was started with a newer protocol version")
+)
+
+// outbox is a ring buffer of the last messages sent to a session, oldest first.  It holds at most maxBytes of
+// encoded messages, a message bigger than that isn't kept at all
+type outbox struct {
+	messages []configs.WsMessage
+	sizes    []int
+	start    int
+	count    int
+	bytes    int
+	maxBytes int
+
+	// last is the sequence of the last message added, whether it was kept or not
+	last uint64
+}
+
+func newOutbox(size, maxBytes int) *outbox {
+	return &outbox{
+		messages: make([]configs.WsMessage, size),
+		sizes:    make([]int, size),
+		maxBytes: maxBytes,
+	}
+}
+
+// add keeps the message, pushing out the oldest ones until there's room for it
+func (o *outbox) add(message configs.WsMessage, size int) {
+	o.last = message.Sequence
+	if size > o.maxBytes {
+		return
+	}
+
+	for o.count == len(o.messages) || o.bytes+size > o.maxBytes {
+		o.messages[o.start] = configs.WsMessage{}
+		o.bytes -= o.sizes[o.start]
+		o.start = (o.start + 1) % len(o.messages)
+		o.count--
+	}
+
+	i := (o.start + o.count) % len(o.messages)
+	o.messages[i] = message
+	o.sizes[i] = size
+	o.bytes += size
+	o.count++
+}
+
+// since returns the messages sent after the sequence in the order they were sent, missed is the number of
+// them that have already been pushed out of the buffer or were too big to keep
+func (o *outbox) since(sequence uint64) (messages []configs.WsMessage, missed uint64) {
+	next := sequence + 1
+	for i := 0; i < o.count; i++ {
+		message := o.messages[(o.start+i)%len(o.messages)]
+		if message.Sequence < next {
+			continue
+		}
+		missed += message.Sequence - next
+		next = message.Sequence + 1
+		messages = append(messages, message)
+	}
+	if o.last >= next {
+		missed += o.last - next + 1
+	}
+	return messages, missed
+}
+
+// newResumeToken makes the secret a client has to present to pick up its session on a new connection
+func newResumeToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		// without a token the session can't be resumed, which is no worse than before
+		log.Errorf("Error generating resume token: %s", err)
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// resumeSession finds the session the resume token belongs to, the sequence is the last message the client saw
+// Nothing is returned if the token is unknown, e.g. the session has already been closed
+func resumeSession(token, sequence string) (*session, uint64) {
+	if token == "" {
+		return nil, 0
+	}
+
+	seq, err := strconv.ParseUint(sequence, 10, 64)
+	if err != nil && sequence != "" {
+		log.Warnf("Invalid sequence %q to resume from, replaying everything kept", sequence)
+	}
+
+	for _, session := range allSessions() {
+		if session.resumeToken != "" && subtle.ConstantTimeCompare([]byte(session.resumeToken), []byte(token)) == 1 {
+			return session, seq
+		}
+	}
+
+	log.Debug("Unknown resume token, starting a new session")
+	return nil, 0
+}
+
+// attach hands the session a connection that speaks the protocol version in the encoding of the codec.  The
+// client is sent the init message and then everything it missed after the sequence, in order, before anything
+// else can be sent.  A connection can't lower the version the session speaks
+func (session *session) attach(ws *websocket.Conn, c codec, sequence uint64, version int) error {
+	session.writeMutex.Lock()
+	defer session.writeMutex.Unlock()
+
+	select {
+	case <-session.done:
+		return errSessionClosed
+	default:
+	}
+
+	if version < session.protocolVersion {
+		return errProtocolLowered
+	}
+
+	if session.detachTimer != nil {
+		session.detachTimer.Stop()
+		session.detachTimer = nil
+	}
+
+	// the client gave up on the old connection before the server noticed it was gone
+	if session.ws != nil {
+		session.ws.Close()
+	}
+	session.ws = ws
+	session.codec = c
+	session.protocolVersion = version
+
+	messages, missed := session.outbox.since(sequence)
+
+	init := configs.WsMessage{
+		Type:            configs.UI,
+		Component:       configs.Initialize,
+		SessionID:       session.sessionID,
+		Timestamp:       time.Now().UnixNano() / 1000000,
+		Dashboards:      configs.UIConfig.Dashboards,
+		AuthMethod:      configs.UIConfig.AuthMethod,
+		ResumeToken:     session.resumeToken,
+		ProtocolVersion: version,
+		Encoding:        c.name(),
+	}
+	if missed > 0 {
+		m := fmt.Sprintf("%d messages sent while disconnected could not be replayed", missed)
+		init.Message = &m
+		log.WithFields(log.Fields{SessionID: session.sessionID}).Warn(m)
+	}
+
+	if err := write(ws, c, init); err != nil {
+		return err
+	}
+	for _, message := range messages {
+		if err := write(ws, c, message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// detach is called when a connection goes away.  The session keeps the messages sent to it for the grace
+// period for the client to come back, after that it's closed
+func (session *session) detach(ws *websocket.Conn) {
+	ws.Close()
+
+	session.writeMutex.Lock()
+	// the session has moved on to a newer connection
+	if session.ws != ws {
+		session.writeMutex.Unlock()
+		return
+	}
+	session.ws = nil
+
+	grace := session.options.resumeGrace
+	if grace > 0 {
+		log.WithFields(log.Fields{SessionID: session.sessionID}).Debugf("Websocket gone, keeping the session for %s",
+			grace)
+		session.detachTimer = time.AfterFunc(grace, session.onClose)
+	}
+	session.writeMutex.Unlock()
+
+	if grace <= 0 {
+		session.onClose()
+	}
+}
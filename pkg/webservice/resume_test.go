@@ -0,0 +1,209 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+)
+
+func TestOutbox(t *testing.T) {
+	o := newOutbox(3, 1<<20)
+	messages, missed := o.since(0)
+	assert.Empty(t, messages)
+	assert.Equal(t, uint64(0), missed)
+
+	for i := uint64(1); i <= 5; i++ {
+		o.add(configs.WsMessage{Sequence: i}, 10)
+	}
+
+	// only the last 3 are kept
+	messages, missed = o.since(0)
+	require.Len(t, messages, 3)
+	assert.Equal(t, uint64(3), messages[0].Sequence)
+	assert.Equal(t, uint64(5), messages[2].Sequence)
+	assert.Equal(t, uint64(2), missed)
+
+	messages, missed = o.since(3)
+	require.Len(t, messages, 2)
+	assert.Equal(t, uint64(4), messages[0].Sequence)
+	assert.Equal(t, uint64(0), missed)
+
+	messages, missed = o.since(5)
+	assert.Empty(t, messages)
+	assert.Equal(t, uint64(0), missed)
+}
+
+func TestOutboxBytes(t *testing.T) {
+	o := newOutbox(10, 100)
+	for i := uint64(1); i <= 4; i++ {
+		o.add(configs.WsMessage{Sequence: i}, 40)
+	}
+
+	// only what fits in the bytes is kept
+	messages, missed := o.since(0)
+	require.Len(t, messages, 2)
+	assert.Equal(t, uint64(3), messages[0].Sequence)
+	assert.Equal(t, uint64(2), missed)
+	assert.Equal(t, 80, o.bytes)
+
+	// a message too big to keep is counted as missed, wherever it falls
+	o.add(configs.WsMessage{Sequence: 5}, 101)
+	messages, missed = o.since(3)
+	require.Len(t, messages, 1)
+	assert.Equal(t, uint64(1), missed)
+
+	o.add(configs.WsMessage{Sequence: 6}, 20)
+	messages, missed = o.since(3)
+	require.Len(t, messages, 2)
+	assert.Equal(t, uint64(4), messages[0].Sequence)
+	assert.Equal(t, uint64(6), messages[1].Sequence)
+	assert.Equal(t, uint64(1), missed)
+}
+
+func dialResume(t *testing.T, server *httptest.Server, token string, sequence uint64) *websocket.Conn {
+	url := fmt.Sprintf("ws%s?resume=%s&sequence=%d", strings.TrimPrefix(server.URL, "http"), token, sequence)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	return conn
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) configs.WsMessage {
+	var message configs.WsMessage
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	require.NoError(t, conn.ReadJSON(&message))
+	return message
+}
+
+func TestResumeSession(t *testing.T) {
+	defer useConnectionOptions(t, &configs.WebSocket{ReplayBuffer: 3})()
+	server := httptest.NewServer(http.HandlerFunc(onOpen))
+	defer server.Close()
+
+	conn, _, err := dial(t, server, "")
+	require.NoError(t, err)
+
+	init := readMessage(t, conn)
+	assert.Equal(t, configs.Initialize, init.Component)
+	require.NotEmpty(t, init.ResumeToken)
+	sessionID := init.SessionID
+
+	require.NoError(t, WebSocketSend(configs.WsMessage{SessionID: sessionID, Type: configs.UI, Name: "1"}))
+	first := readMessage(t, conn)
+	assert.Equal(t, uint64(1), first.Sequence)
+
+	// the connection goes away and the messages sent meanwhile wait for the client
+	conn.Close()
+	assert.Eventually(t, func() bool {
+		session, ok := getSession(sessionID)
+		if !ok {
+			return false
+		}
+		session.writeMutex.Lock()
+		defer session.writeMutex.Unlock()
+		return session.ws == nil
+	}, time.Second, 10*time.Millisecond)
+
+	for _, name := range []string{"2", "3"} {
+		require.NoError(t, WebSocketSend(configs.WsMessage{SessionID: sessionID, Type: configs.UI, Name: name}))
+	}
+
+	conn = dialResume(t, server, init.ResumeToken, first.Sequence)
+	resumed := readMessage(t, conn)
+	assert.Equal(t, configs.Initialize, resumed.Component)
+	assert.Equal(t, sessionID, resumed.SessionID)
+	assert.Nil(t, resumed.Message)
+
+	for i, name := range []string{"2", "3"} {
+		message := readMessage(t, conn)
+		assert.Equal(t, name, message.Name)
+		assert.Equal(t, uint64(i+2), message.Sequence)
+	}
+
+	// messages go straight out again once the client is back
+	require.NoError(t, WebSocketSend(configs.WsMessage{SessionID: sessionID, Type: configs.UI, Name: "4"}))
+	assert.Equal(t, "4", readMessage(t, conn).Name)
+	conn.Close()
+
+	// a client too far behind gets what's left and is told how much it missed
+	conn = dialResume(t, server, init.ResumeToken, 0)
+	resumed = readMessage(t, conn)
+	assert.Equal(t, sessionID, resumed.SessionID)
+	require.NotNil(t, resumed.Message)
+	assert.Contains(t, *resumed.Message, "1 messages")
+	assert.Equal(t, "2", readMessage(t, conn).Name)
+	conn.Close()
+
+	// an unknown token gets a new session
+	conn = dialResume(t, server, "nope", 0)
+	defer conn.Close()
+	fresh := readMessage(t, conn)
+	assert.NotEqual(t, sessionID, fresh.SessionID)
+	assert.NotEqual(t, init.ResumeToken, fresh.ResumeToken)
+}
+
+func TestResumeLowerProtocol(t *testing.T) {
+	defer useConnectionOptions(t, nil)()
+	server := httptest.NewServer(http.HandlerFunc(onOpen))
+	defer server.Close()
+
+	url := fmt.Sprintf("ws%s?protocol=%d", strings.TrimPrefix(server.URL, "http"), configs.ChunkedProtocolVersion)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	init := readMessage(t, conn)
+	require.Equal(t, configs.ChunkedProtocolVersion, init.ProtocolVersion)
+	conn.Close()
+
+	// what was kept for the session may be in chunks the older client can't put back together
+	conn = dialResume(t, server, init.ResumeToken, 0)
+	defer conn.Close()
+	fresh := readMessage(t, conn)
+	assert.Equal(t, configs.MinProtocolVersion, fresh.ProtocolVersion)
+	assert.NotEqual(t, init.SessionID, fresh.SessionID)
+	assert.NotEqual(t, init.ResumeToken, fresh.ResumeToken)
+
+	// the session is still there for a client that speaks what it did
+	conn, _, err = websocket.DefaultDialer.Dial(fmt.Sprintf("%s&resume=%s", url, init.ResumeToken), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, init.SessionID, readMessage(t, conn).SessionID)
+}
+
+func TestDetachWithoutGrace(t *testing.T) {
+	defer useConnectionOptions(t, &configs.WebSocket{ResumeGracePeriod: "0s"})()
+	server := httptest.NewServer(http.HandlerFunc(onOpen))
+	defer server.Close()
+
+	conn, _, err := dial(t, server, "")
+	require.NoError(t, err)
+	init := readMessage(t, conn)
+	conn.Close()
+
+	assert.Eventually(t, func() bool {
+		_, ok := getSession(init.SessionID)
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+	assert.Error(t, WebSocketSend(configs.WsMessage{SessionID: init.SessionID}))
+}
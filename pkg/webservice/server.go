@@ -22,6 +22,7 @@ import (
 	"github.com/pkg/errors"
 	"opendev.org/airship/airshipui/pkg/configs"
 	"opendev.org/airship/airshipui/pkg/log"
+	"opendev.org/airship/airshipui/pkg/metrics"
 	"opendev.org/airship/airshipui/util/utilfile"
 	"opendev.org/airship/airshipui/util/utilhttp"
 )
@@ -70,9 +71,37 @@ func getCertificates() []tls.Certificate {
 func WebServer() {
 	webServerMux := http.NewServeMux()
 
+	// the websocket requests are handled within the limits from the config
+	pool = newWorkerPool(configs.UIConfig.WebService.Limits)
+
+	options, err := newConnectionOptions(configs.UIConfig.WebService.WebSocket)
+	if err != nil {
+		log.Fatal(err)
+	}
+	wsOptions = options
+
 	// hand off the websocket upgrade over http
 	webServerMux.HandleFunc("/ws", onOpen)
 
+	// metrics are left open for the monitoring stack to scrape
+	webServerMux.Handle("/metrics", metrics.Handler())
+
+	// health reports are left open for orchestrators and load balancers
+	webServerMux.HandleFunc("/healthz", handleHealth)
+	webServerMux.HandleFunc("/readyz", handleReady)
+
+	// the log levels can be changed while the UI is running by an authenticated user on the same machine
+	webServerMux.HandleFunc(loggingRoute, requireLocal(requireAuth(handleLogging)))
+
+	// the message schemas are left open so clients can be generated and checked against them
+	webServerMux.HandleFunc(schemaRoute, handleSchema)
+	webServerMux.HandleFunc(schemaRoute+"/", handleSchema)
+
+	// routes added by other packages, these all require authentication
+	for pattern, handler := range handlerMap {
+		webServerMux.HandleFunc(pattern, requireAuth(handler))
+	}
+
 	// establish routing to static angular client
 	log.Debug("Attempting to serve static content from ", staticContent)
 	webServerMux.HandleFunc("/", serveFile)
@@ -98,6 +127,10 @@ func WebServer() {
 		ErrorLog: log.Logger(),
 	}
 
+	addServer(server, false)
+
 	// kick off the server, and good luck
-	log.Fatal(server.ListenAndServeTLS("", ""))
+	if err := server.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
 }
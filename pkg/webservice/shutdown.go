@@ -0,0 +1,161 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/log"
+	"opendev.org/airship/airshipui/pkg/statistics"
+	"opendev.org/airship/airshipui/pkg/tracing"
+)
+
+const (
+	// how long the statistics, traces and the http servers get to finish up after the grace period
+	flushTimeout    = 5 * time.Second
+	shutdownTimeout = 5 * time.Second
+)
+
+// the state used to drain the webservice on the way down
+var (
+	shuttingDown bool
+	workMutex    sync.Mutex
+	inFlight     sync.WaitGroup
+
+	httpServer   *http.Server
+	proxyServers []*http.Server
+	serverMutex  sync.Mutex
+)
+
+// TrackWork lets other packages hold up the shutdown for work that outlives the request that started it,
+// e.g. a go routine kicked off by a request.  It has to be called while the request is still being handled
+// and the returned function called when the work is done
+func TrackWork() func() {
+	inFlight.Add(1)
+	return inFlight.Done
+}
+
+// beginRequest counts a request as in flight, it returns false if the webservice is going down and the
+// request should be turned away
+func beginRequest() bool {
+	workMutex.Lock()
+	defer workMutex.Unlock()
+
+	if shuttingDown {
+		return false
+	}
+
+	inFlight.Add(1)
+	return true
+}
+
+// isShuttingDown reports if the shutdown sequence has started
+func isShuttingDown() bool {
+	workMutex.Lock()
+	defer workMutex.Unlock()
+	return shuttingDown
+}
+
+// checkShutdown fails the readiness check once the shutdown sequence starts so traffic is routed elsewhere
+func checkShutdown() error {
+	if isShuttingDown() {
+		return errors.New("webservice is shutting down")
+	}
+	return nil
+}
+
+// addServer keeps track of the servers that need to be shut down
+func addServer(s *http.Server, proxy bool) {
+	serverMutex.Lock()
+	defer serverMutex.Unlock()
+
+	if proxy {
+		proxyServers = append(proxyServers, s)
+	} else {
+		httpServer = s
+	}
+}
+
+// Shutdown takes the webservice down cleanly:
+// 1. new sessions and requests are turned away
+// 2. the sessions are told the server is going down
+// 3. running requests and tasks get the grace period to finish
+// 4. the statistics are flushed
+// 5. the sessions are closed and the http servers and proxies are shut down
+func Shutdown(gracePeriod time.Duration) {
+	workMutex.Lock()
+	shuttingDown = true
+	workMutex.Unlock()
+
+	notifySessions(gracePeriod)
+
+	done := make(chan struct{})
+	go func() {
+		inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Info("All running requests have finished")
+	case <-time.After(gracePeriod):
+		log.Warnf("Grace period of %s expired, shutting down with requests still running", gracePeriod)
+	}
+
+	if err := statistics.Close(flushTimeout); err != nil {
+		log.Errorf("Error closing the statistics database: %s", err)
+	}
+
+	tracing.Shutdown(flushTimeout)
+
+	CloseAllSessions()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	serverMutex.Lock()
+	defer serverMutex.Unlock()
+	for _, proxy := range proxyServers {
+		if err := proxy.Shutdown(ctx); err != nil {
+			log.Errorf("Error shutting down proxy %s: %s", proxy.Addr, err)
+		}
+	}
+
+	if httpServer != nil {
+		if err := httpServer.Shutdown(ctx); err != nil {
+			log.Errorf("Error shutting down webservice: %s", err)
+		}
+	}
+}
+
+// notifySessions lets every session know the server is going away
+func notifySessions(gracePeriod time.Duration) {
+	m := fmt.Sprintf("The server is shutting down in %s", gracePeriod)
+	for _, session := range allSessions() {
+		if err := session.webSocketSend(configs.WsMessage{
+			Type:      configs.UI,
+			Component: configs.Shutdown,
+			Message:   &m,
+		}); err != nil {
+			log.Errorf("Error sending shutdown to session %s: %s", session.sessionID, err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdown(t *testing.T) {
+	defer func() {
+		shuttingDown = false
+	}()
+
+	assert.NoError(t, checkShutdown())
+	assert.True(t, beginRequest())
+
+	// the running request holds up the shutdown until it's done
+	finished := make(chan struct{})
+	go func() {
+		Shutdown(5 * time.Second)
+		close(finished)
+	}()
+
+	assert.Eventually(t, isShuttingDown, time.Second, 10*time.Millisecond)
+	assert.False(t, beginRequest())
+	assert.Error(t, checkShutdown())
+
+	select {
+	case <-finished:
+		t.Fatal("shutdown did not wait for the running request")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	inFlight.Done()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not finish after the running request")
+	}
+}
@@ -0,0 +1,203 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/log"
+)
+
+// the kinds of topics that can be subscribed to, e.g. task/<id>
+const (
+	taskTopic  = "task/"
+	nodeTopic  = "node/"
+	phaseTopic = "phase/"
+)
+
+// subscribers are the sessions subscribed to each topic along with when the token they subscribed with runs out,
+// nothing is published to a session once that's passed unless it has sent a request with a newer token since
+var (
+	subscribers = map[string]map[string]time.Time{}
+	topicMutex  sync.RWMutex
+)
+
+// TaskTopic is the topic the updates of a task are published on
+func TaskTopic(id string) string {
+	return taskTopic + id
+}
+
+// NodeTopic is the topic the results of the baremetal actions on a node are published on
+func NodeTopic(name string) string {
+	return nodeTopic + name
+}
+
+// PhaseTopic is the topic the runs of a phase are published on
+func PhaseTopic(name string) string {
+	return phaseTopic + name
+}
+
+// checkTopic makes sure the topic is one that's published on
+func checkTopic(topic string) error {
+	for _, prefix := range []string{taskTopic, nodeTopic, phaseTopic} {
+		if strings.HasPrefix(topic, prefix) && len(topic) > len(prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid topic %q, expected task/<id>, node/<name> or phase/<name>", topic)
+}
+
+// handleTopic subscribes the session to or unsubscribes it from a topic.  What's published on the topics
+// comes from the deployments so unlike the other UI requests it needs a valid token.  The session is always
+// the one the request came in on, handleRequest sees to that
+func handleTopic(_ *string, request configs.WsMessage) configs.WsMessage {
+	response := configs.WsMessage{
+		Type:         configs.UI,
+		Component:    configs.Topic,
+		SubComponent: request.SubComponent,
+		Topic:        request.Topic,
+	}
+
+	var err error
+	var expires time.Time
+	if request.Token != nil {
+		_, expires, err = validateTokenExpiry(request)
+	} else {
+		err = errors.New("No authentication token found")
+	}
+
+	var message string
+	if err == nil {
+		switch request.SubComponent {
+		case configs.Subscribe:
+			err = Subscribe(request.SessionID, request.Topic, expires)
+			message = fmt.Sprintf("Subscribed to %s", request.Topic)
+		case configs.Unsubscribe:
+			unsubscribe(request.SessionID, request.Topic)
+			message = fmt.Sprintf("Unsubscribed from %s", request.Topic)
+		default:
+			err = fmt.Errorf("Subcomponent %s not found", request.SubComponent)
+		}
+	}
+
+	if err != nil {
+		e := err.Error()
+		response.Error = &e
+	} else {
+		response.Message = &message
+	}
+
+	return response
+}
+
+// Subscribe adds the session to the subscribers of the topic until the token it subscribed with expires
+func Subscribe(sessionID, topic string, expires time.Time) error {
+	if err := checkTopic(topic); err != nil {
+		return err
+	}
+	if _, ok := getSession(sessionID); !ok {
+		return errors.New("session id " + sessionID + " not found")
+	}
+
+	topicMutex.Lock()
+	defer topicMutex.Unlock()
+	if _, ok := subscribers[topic]; !ok {
+		subscribers[topic] = map[string]time.Time{}
+	}
+	subscribers[topic][sessionID] = expires
+	return nil
+}
+
+// renewSubscriptions keeps the topics of the session coming for as long as its newest valid token lasts
+func renewSubscriptions(sessionID string, expires time.Time) {
+	topicMutex.Lock()
+	defer topicMutex.Unlock()
+	for _, sessionIDs := range subscribers {
+		if current, ok := sessionIDs[sessionID]; ok && expires.After(current) {
+			sessionIDs[sessionID] = expires
+		}
+	}
+}
+
+// unsubscribe takes the session off the subscribers of the topic
+func unsubscribe(sessionID, topic string) {
+	topicMutex.Lock()
+	defer topicMutex.Unlock()
+	delete(subscribers[topic], sessionID)
+	if len(subscribers[topic]) == 0 {
+		delete(subscribers, topic)
+	}
+}
+
+// unsubscribeAll takes the session off every topic, e.g. when it closes or its token is no longer valid
+func unsubscribeAll(sessionID string) {
+	topicMutex.Lock()
+	defer topicMutex.Unlock()
+	for topic, sessionIDs := range subscribers {
+		delete(sessionIDs, sessionID)
+		if len(sessionIDs) == 0 {
+			delete(subscribers, topic)
+		}
+	}
+}
+
+// Publish sends the message to every session subscribed to any of the topics, a session subscribed to more than
+// one of them gets it once.  The session the message is addressed to gets it whether it's subscribed or not,
+// and like WebSocketSend an error is only returned if that session can't be sent to
+func Publish(message configs.WsMessage, topics ...string) error {
+	if len(topics) > 0 {
+		message.Topic = topics[0]
+	}
+
+	var err error
+	if message.SessionID != "" {
+		err = WebSocketSend(message)
+	}
+
+	for _, sessionID := range subscribedSessions(message.SessionID, topics) {
+		if session, ok := getSession(sessionID); ok {
+			if e := session.webSocketSend(message); e != nil {
+				log.WithFields(log.Fields{SessionID: sessionID}).Errorf("Error publishing to %s: %s", message.Topic, e)
+			}
+		}
+	}
+
+	return err
+}
+
+// subscribedSessions lists the sessions subscribed to the topics other than the one the message is addressed to,
+// leaving out those whose token has run out
+func subscribedSessions(sessionID string, topics []string) []string {
+	topicMutex.RLock()
+	defer topicMutex.RUnlock()
+
+	now := time.Now()
+	seen := map[string]bool{sessionID: true}
+	var sessionIDs []string
+	for _, topic := range topics {
+		for id, expires := range subscribers[topic] {
+			if !seen[id] && now.Before(expires) {
+				seen[id] = true
+				sessionIDs = append(sessionIDs, id)
+			}
+		}
+	}
+	return sessionIDs
+}
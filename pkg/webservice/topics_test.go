@@ -0,0 +1,188 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+)
+
+// published is what's waiting in the outbox of a session without a connection
+func published(s *session) []configs.WsMessage {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	messages, _ := s.outbox.since(0)
+	return messages
+}
+
+// testToken creates a token for a test user, the returned function puts the users back
+func testToken(t *testing.T) (*string, func()) {
+	users := configs.UIConfig.Users
+	hash := sha512.Sum512([]byte("password"))
+	configs.UIConfig.Users = map[string]string{"operator": hex.EncodeToString(hash[:])}
+
+	token, err := createToken("operator", "password")
+	require.NoError(t, err)
+	return token, func() {
+		configs.UIConfig.Users = users
+	}
+}
+
+func TestCheckTopic(t *testing.T) {
+	for _, topic := range []string{TaskTopic("t-1"), NodeTopic("node01"), PhaseTopic("initinfra")} {
+		assert.NoError(t, checkTopic(topic), topic)
+	}
+	for _, topic := range []string{"", "task/", "cluster/c-1", "tasks"} {
+		assert.Error(t, checkTopic(topic), topic)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	owner, watcher, other := newSession(wsOptions), newSession(wsOptions), newSession(wsOptions)
+	defer owner.onClose()
+	defer watcher.onClose()
+	defer other.onClose()
+
+	expires := time.Now().Add(time.Hour)
+	require.NoError(t, Subscribe(watcher.sessionID, TaskTopic("t-1"), expires))
+	require.NoError(t, Subscribe(watcher.sessionID, PhaseTopic("initinfra"), expires))
+	require.NoError(t, Subscribe(owner.sessionID, TaskTopic("t-1"), expires))
+	require.NoError(t, Subscribe(other.sessionID, NodeTopic("node01"), expires))
+	assert.Error(t, Subscribe(watcher.sessionID, "bogus", expires))
+	assert.Error(t, Subscribe("nope", TaskTopic("t-1"), expires))
+
+	require.NoError(t, Publish(configs.WsMessage{SessionID: owner.sessionID, Name: "update"},
+		TaskTopic("t-1"), PhaseTopic("initinfra")))
+
+	// the owner and the watcher get it once each, the other session isn't watching
+	for _, s := range []*session{owner, watcher} {
+		messages := published(s)
+		require.Len(t, messages, 1)
+		assert.Equal(t, "update", messages[0].Name)
+		assert.Equal(t, TaskTopic("t-1"), messages[0].Topic)
+		assert.Equal(t, s.sessionID, messages[0].SessionID)
+	}
+	assert.Empty(t, published(other))
+
+	// without a session to address it to it only goes to the subscribers
+	require.NoError(t, Publish(configs.WsMessage{Name: "node"}, NodeTopic("node01")))
+	assert.Len(t, published(other), 1)
+
+	// a session that's gone doesn't hold up the others
+	assert.Error(t, Publish(configs.WsMessage{SessionID: "gone"}, NodeTopic("node01")))
+	assert.Len(t, published(other), 2)
+
+	unsubscribe(watcher.sessionID, TaskTopic("t-1"))
+	require.NoError(t, Publish(configs.WsMessage{Name: "again"}, TaskTopic("t-1")))
+	assert.Len(t, published(watcher), 1)
+	assert.Len(t, published(owner), 2)
+
+	// closing takes the session off every topic
+	other.onClose()
+	topicMutex.RLock()
+	assert.NotContains(t, subscribers, NodeTopic("node01"))
+	topicMutex.RUnlock()
+}
+
+func TestHandleTopic(t *testing.T) {
+	s := newSession(wsOptions)
+	defer s.onClose()
+
+	request := configs.WsMessage{
+		Type:         configs.UI,
+		Component:    configs.Topic,
+		SubComponent: configs.Subscribe,
+		SessionID:    s.sessionID,
+		Topic:        NodeTopic("node01"),
+	}
+
+	// subscribing needs a token
+	response := handleTopic(nil, request)
+	require.NotNil(t, response.Error)
+
+	token, restore := testToken(t)
+	defer restore()
+	request.Token = token
+	response = handleTopic(nil, request)
+	require.Nil(t, response.Error)
+	assert.Equal(t, NodeTopic("node01"), response.Topic)
+	assert.Equal(t, []string{s.sessionID}, subscribedSessions("", []string{NodeTopic("node01")}))
+
+	request.SubComponent = configs.Unsubscribe
+	response = handleTopic(nil, request)
+	require.Nil(t, response.Error)
+	assert.Empty(t, subscribedSessions("", []string{NodeTopic("node01")}))
+
+	request.SubComponent = "nope"
+	response = handleTopic(nil, request)
+	assert.NotNil(t, response.Error)
+}
+
+func TestSubscriptionExpiry(t *testing.T) {
+	s := newSession(wsOptions)
+	defer s.onClose()
+
+	// nothing is published once the token the session subscribed with has run out
+	require.NoError(t, Subscribe(s.sessionID, NodeTopic("node01"), time.Now().Add(-time.Second)))
+	require.NoError(t, Publish(configs.WsMessage{Name: "node"}, NodeTopic("node01")))
+	assert.Empty(t, published(s))
+
+	// until the session sends a request with a newer token
+	renewSubscriptions(s.sessionID, time.Now().Add(time.Hour))
+	require.NoError(t, Publish(configs.WsMessage{Name: "node"}, NodeTopic("node01")))
+	assert.Len(t, published(s), 1)
+
+	// an older token doesn't cut it short
+	renewSubscriptions(s.sessionID, time.Now().Add(-time.Second))
+	assert.Equal(t, []string{s.sessionID}, subscribedSessions("", []string{NodeTopic("node01")}))
+}
+
+func TestHandleTopicSession(t *testing.T) {
+	victim, attacker := newSession(wsOptions), newSession(wsOptions)
+	defer victim.onClose()
+	defer attacker.onClose()
+	require.NoError(t, Subscribe(victim.sessionID, NodeTopic("node01"), time.Now().Add(time.Hour)))
+
+	token, restore := testToken(t)
+	defer restore()
+
+	// a request always acts on the session it came in on, not the one it names
+	attacker.handleRequest(configs.WsMessage{
+		Type:         configs.UI,
+		Component:    configs.Topic,
+		SubComponent: configs.Unsubscribe,
+		SessionID:    victim.sessionID,
+		Token:        token,
+		Topic:        NodeTopic("node01"),
+	})
+	assert.Equal(t, []string{victim.sessionID}, subscribedSessions("", []string{NodeTopic("node01")}))
+
+	attacker.handleRequest(configs.WsMessage{
+		Type:         configs.UI,
+		Component:    configs.Topic,
+		SubComponent: configs.Subscribe,
+		SessionID:    victim.sessionID,
+		Token:        token,
+		Topic:        TaskTopic("t-1"),
+	})
+	assert.Equal(t, []string{attacker.sessionID}, subscribedSessions("", []string{TaskTopic("t-1")}))
+}
@@ -15,6 +15,7 @@
 package webservice
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -23,144 +24,429 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"opendev.org/airship/airshipui/pkg/configs"
 	"opendev.org/airship/airshipui/pkg/log"
+	"opendev.org/airship/airshipui/pkg/metrics"
+	"opendev.org/airship/airshipui/pkg/schema"
 	"opendev.org/airship/airshipui/pkg/statistics"
+	"opendev.org/airship/airshipui/pkg/tracing"
 )
 
 // Session is a struct to hold information about a given session
 type session struct {
-	sessionID  string
-	jwt        string
-	writeMutex sync.Mutex
-	ws         *websocket.Conn
+	sessionID   string
+	resumeToken string
+	jwt         string
+
+	// the writeMutex guards the connection, which is nil while the client is away, what it speaks and the
+	// messages kept for the client to pick up when it comes back
+	writeMutex      sync.Mutex
+	ws              *websocket.Conn
+	codec           codec
+	protocolVersion int
+	sequence        uint64
+	outbox          *outbox
+	detachTimer     *time.Timer
+
+	// options are the websocket settings when the session opened, the limiter is shared by the connections
+	// the session is resumed on
+	options *connectionOptions
+	limiter *rateLimiter
+
+	// requests are waiting for the worker pool, done is closed with the session
+	requests  *requestQueue
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 // sessions keeps track of open websocket sessions
-var sessions = map[string]*session{}
+var (
+	sessions     = map[string]*session{}
+	sessionMutex sync.RWMutex
+)
 
 // gorilla ws specific HTTP upgrade to WebSockets
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	CheckOrigin:     checkOrigin,
 }
 
 // this is a way to allow for arbitrary messages to be processed by the backend
 // the message of a specifc component is shunted to that subsystem for further processing
-var funcMap = map[configs.WsRequestType]map[configs.WsComponentType]func(*string, configs.WsMessage) configs.WsMessage{
-	configs.UI: {
-		configs.Keepalive: keepaliveReply,
-		configs.Auth:      handleAuth,
-	},
-}
+// The maps of the request types are never changed once they're in, adding components swaps in a new map,
+// so a map looked up under the funcMapMutex can be used without it
+var (
+	funcMap = map[configs.WsRequestType]map[configs.WsComponentType]func(*string, configs.WsMessage) configs.WsMessage{
+		configs.UI: {
+			configs.Keepalive: keepaliveReply,
+			configs.Auth:      handleAuth,
+			configs.Topic:     handleTopic,
+		},
+	}
+	funcMapMutex sync.RWMutex
+)
 
 // AppendToFunctionMap allows us to break up the circular reference from the other packages
-// It does however require them to implement an init function to append them
-// TODO: maybe some form of an interface to enforce this may be necessary?
+// It does however require them to implement an init function to append them, components that aren't compiled
+// in use AppendComponentHandler
 func AppendToFunctionMap(requestType configs.WsRequestType,
 	functions map[configs.WsComponentType]func(*string, configs.WsMessage) configs.WsMessage) {
+	funcMapMutex.Lock()
+	defer funcMapMutex.Unlock()
+	funcMap[requestType] = functions
+}
+
+// functionsFor returns the functions of the request type
+func functionsFor(requestType configs.WsRequestType) (
+	map[configs.WsComponentType]func(*string, configs.WsMessage) configs.WsMessage, bool) {
+	funcMapMutex.RLock()
+	defer funcMapMutex.RUnlock()
+	functions, ok := funcMap[requestType]
+	return functions, ok
+}
+
+// ComponentHandler handles the messages of the components of the request type it serves, e.g. a plugin
+type ComponentHandler interface {
+	Components() (configs.WsRequestType, []configs.WsComponentType)
+	Handle(user *string, request configs.WsMessage) configs.WsMessage
+}
+
+// AppendComponentHandler adds the components of the handler to the function map.  The UI messages are
+// answered without a token so they can't be handled elsewhere, and components that are already there
+// aren't replaced.  The map the request type had is copied rather than changed, it may belong to another
+// package and requests are being handled from it
+func AppendComponentHandler(handler ComponentHandler) error {
+	requestType, components := handler.Components()
+	if requestType == "" || requestType == configs.UI {
+		return fmt.Errorf("Components can't be added to request type %q", requestType)
+	}
+
+	funcMapMutex.Lock()
+	defer funcMapMutex.Unlock()
+
+	for _, component := range components {
+		if _, ok := funcMap[requestType][component]; ok {
+			return fmt.Errorf("Component %s/%s is already handled", requestType, component)
+		}
+	}
+
+	functions := map[configs.WsComponentType]func(*string, configs.WsMessage) configs.WsMessage{}
+	for component, function := range funcMap[requestType] {
+		functions[component] = function
+	}
+	for _, component := range components {
+		functions[component] = handler.Handle
+	}
 	funcMap[requestType] = functions
+
+	return nil
+}
+
+// handlerMap holds the additional http routes other packages need on the webservice mux, for things that
+// don't fit in a websocket message like file downloads
+var handlerMap = map[string]http.HandlerFunc{}
+
+// AppendToHandlerMap allows other packages to register an http route without a circular reference
+// Every route registered this way requires a valid token to be reached
+func AppendToHandlerMap(pattern string, handler http.HandlerFunc) {
+	handlerMap[pattern] = handler
 }
 
 // handle the origin request & upgrade to websocket
 func onOpen(response http.ResponseWriter, request *http.Request) {
-	// gorilla ws will give a 403 on a cross origin request, so to silence its complaints
-	// upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+	if isShuttingDown() {
+		http.Error(response, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	options := wsOptions
+
+	// the client offers the protocol versions it speaks as subprotocols, a client the backend can't speak to is
+	// turned away before the upgrade.  Clients from before that ask for a version in the query instead
+	version, offered, err := negotiateSubprotocol(websocket.Subprotocols(request))
+	if err != nil {
+		log.Warnf("Refusing websocket connection from: %s: %s\n", request.Host, err)
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var header http.Header
+	if offered {
+		header = http.Header{}
+		header.Set("Sec-WebSocket-Protocol", subprotocol(version))
+	}
+
+	// upgrade to websocket protocol over http, gorilla ws gives a 403 for origins checkOrigin doesn't allow
+	// Compression is only used when the client asks for it too
+	u := upgrader
+	u.EnableCompression = options.compression
+	wsConn, err := u.Upgrade(response, request, header)
+	if err != nil {
+		// the upgrader has already sent the error back
+		log.Errorf("Could not open websocket connection from: %s: %s\n", request.Host, err)
+		return
+	}
+
+	if err = prepareConnection(wsConn, options); err != nil {
+		log.Errorf("Could not prepare websocket connection from: %s: %s\n", request.Host, err)
+		wsConn.Close()
+		return
+	}
 
-	// upgrade to websocket protocol over http
-	wsConn, err := upgrader.Upgrade(response, request, nil)
+	// the client says which encoding and protocol version it speaks, one the backend doesn't can't be served
+	query := request.URL.Query()
+	c, err := negotiateEncoding(query.Get("encoding"))
 	if err != nil {
-		log.Errorf("Could not open websocket connection from: %s\n", request.Host)
-		http.Error(response, "Could not open websocket connection", http.StatusBadRequest)
+		log.Warnf("Refusing websocket connection from: %s: %s\n", request.Host, err)
+		refuseProtocol(wsConn, codecs[jsonEncoding], err)
+		return
 	}
 
-	session := newSession(wsConn)
-	log.Debugf("WebSocket session %s established with %s\n", session.sessionID, session.ws.RemoteAddr().String())
+	if !offered {
+		if version, err = negotiateProtocol(query.Get("protocol")); err != nil {
+			log.Warnf("Refusing websocket connection from: %s: %s\n", request.Host, err)
+			refuseProtocol(wsConn, c, err)
+			return
+		}
+	}
 
-	go session.onMessage()
+	// a client that comes back with the resume token of a session that's still around picks up where it
+	// left off, otherwise it gets a brand new session
+	session, sequence := resumeSession(query.Get("resume"), query.Get("sequence"))
+	if session == nil {
+		session, sequence = newSession(options), 0
+	}
+
+	err = session.attach(wsConn, c, sequence, version)
+	if err == errProtocolLowered {
+		log.Warnf("Not resuming session %s for %s, %s, starting a new session", session.sessionID, request.Host, err)
+		session = newSession(options)
+		err = session.attach(wsConn, c, 0, version)
+	}
+	if err != nil {
+		log.Errorf("Could not attach websocket connection from: %s to session %s: %s\n", request.Host,
+			session.sessionID, err)
+		session.detach(wsConn)
+		return
+	}
+	log.Debugf("WebSocket session %s established with %s\n", session.sessionID, wsConn.RemoteAddr().String())
+
+	go session.onMessage(wsConn)
 }
 
 // handle messaging to the client
-func (session *session) onMessage() {
-	// just in case clean up the websocket
-	defer session.onClose()
+func (session *session) onMessage(ws *websocket.Conn) {
+	// the server pings the client so dead connections are found without waiting on a keepalive
+	stop := make(chan struct{})
+	go session.keepAlive(ws, stop)
+
+	// the session stays around for a while after the connection goes in case the client comes back
+	defer func() {
+		close(stop)
+		session.detach(ws)
+	}()
 
 	for {
-		var request configs.WsMessage
-		err := session.ws.ReadJSON(&request)
-		if err != nil {
+		// a message that isn't valid is answered with what's wrong with it, the connection is still good
+		request, err := read(ws)
+		invalid, isInvalid := err.(invalidMessage)
+		if err != nil && !isInvalid {
 			session.onError(err)
 			break
 		}
 
-		// this has to be a go routine otherwise it will block any incoming messages waiting for a command return
-		go func() {
-			// test the auth token for request validity on non auth requests
-			var user *string
-			if request.Type != configs.UI && request.Component != configs.Auth && request.SubComponent != configs.Authenticate {
-				if request.Token != nil {
-					user, err = validateToken(request)
-				} else {
-					err = errors.New("No authentication token found")
-				}
+		// the client is alive, give it until the next ping to be heard from again
+		if err = ws.SetReadDeadline(time.Now().Add(session.options.readTimeout())); err != nil {
+			session.onError(err)
+			break
+		}
+
+		if !session.limiter.allow(time.Now()) {
+			if err = session.webSocketSend(requestErrorHelper(errRateLimited.Error(), request)); err != nil {
+				session.onError(err)
+			}
+			continue
+		}
+
+		if isInvalid {
+			request.SessionID = session.sessionID
+			log.WithFields(requestFields(nil, request)).Error(invalid)
+			if err = session.webSocketSend(requestErrorHelper(invalid.Error(), request)); err != nil {
+				session.onError(err)
+			}
+			continue
+		}
+
+		// the request is handed to the worker pool so a slow command doesn't block any incoming messages,
+		// the pool turns it away if too many requests are already waiting
+		err = pool.submit(session, func() {
+			session.handleRequest(request)
+		})
+		if err != nil {
+			if err = session.webSocketSend(requestErrorHelper(err.Error(), request)); err != nil {
+				session.onError(err)
 			}
+		}
+	}
+}
+
+// handleRequest authenticates the request and hands it to the function for its type and component
+func (session *session) handleRequest(request configs.WsMessage) {
+	var err error
+
+	// the request acts on the session the connection belongs to, whatever session the client says it's from
+	request.SessionID = session.sessionID
+
+	// test the auth token for request validity on non auth requests
+	var user *string
+	if request.Type != configs.UI && request.Component != configs.Auth && request.SubComponent != configs.Authenticate {
+		if request.Token != nil {
+			var expires time.Time
+			if user, expires, err = validateTokenExpiry(request); err == nil {
+				renewSubscriptions(session.sessionID, expires)
+			}
+		} else {
+			err = errors.New("No authentication token found")
+		}
+	}
+	if err == nil && request.Type != configs.UI {
+		// turn away new work once the server is going down, the UI messages are still answered
+		if !beginRequest() {
+			err = session.webSocketSend(requestErrorHelper("Server is shutting down", request))
 			if err != nil {
-				// deny the request if we get a bad token, this will force the UI to a login screen
-				e := "Invalid token, authentication denied"
-				response := configs.WsMessage{
-					Type:         configs.UI,
-					Component:    configs.Auth,
-					SubComponent: configs.Denied,
-					Error:        &e,
+				session.onError(err)
+			}
+			return
+		}
+		defer inFlight.Done()
+	}
+
+	if err != nil {
+		// deny the request if we get a bad token, this will force the UI to a login screen
+		e := "Invalid token, authentication denied"
+		response := configs.WsMessage{
+			Type:         configs.UI,
+			Component:    configs.Auth,
+			SubComponent: configs.Denied,
+			RequestID:    request.RequestID,
+			Error:        &e,
+		}
+		if err = session.webSocketSend(response); err != nil {
+			session.onError(err)
+		}
+
+		// nothing more is published to the session until it subscribes again with a good token
+		unsubscribeAll(session.sessionID)
+	} else {
+		// every request is the root of a trace, unless the UI sent the trace it belongs to
+		ctx, span := startRequestSpan(user, request)
+		tracing.Inject(ctx, &request)
+		defer span.End()
+
+		// This is the middleware to be able to record when a transaction starts and ends for the statistics recorder
+		// It is possible for the backend to send messages without a valid user
+		transaction := statistics.NewTransaction(user, request)
+
+		// look through the function map to find the type to handle the request
+		if reqType, ok := functionsFor(request.Type); ok {
+			// the function map may have a component (function) to process the request
+			if component, ok := reqType[request.Component]; ok {
+				started := time.Now()
+				response := component(user, request)
+				metrics.ObserveRequest(request, started, response.Error == nil)
+				response.TraceID = tracing.TraceID(span)
+				response.RequestID = request.RequestID
+				if response.Error != nil {
+					tracing.RecordError(span, errors.New(*response.Error))
 				}
 				if err = session.webSocketSend(response); err != nil {
 					session.onError(err)
 				}
+				go transaction.Complete(response.Error == nil)
 			} else {
-				// This is the middleware to be able to record when a transaction starts and ends for the statistics recorder
-				// It is possible for the backend to send messages without a valid user
-				transaction := statistics.NewTransaction(user, request)
-
-				// look through the function map to find the type to handle the request
-				if reqType, ok := funcMap[request.Type]; ok {
-					// the function map may have a component (function) to process the request
-					if component, ok := reqType[request.Component]; ok {
-						response := component(user, request)
-						if err = session.webSocketSend(response); err != nil {
-							session.onError(err)
-						}
-						go transaction.Complete(response.Error == nil)
-					} else {
-						if err = session.webSocketSend(requestErrorHelper(fmt.Sprintf("Requested component: %s, not found",
-							request.Component), request)); err != nil {
-							session.onError(err)
-						}
-						log.Errorf("Requested component: %s, not found\n", request.Component)
-						go transaction.Complete(false)
-					}
-				} else {
-					if err = session.webSocketSend(requestErrorHelper(fmt.Sprintf("Requested type: %s, not found",
-						request.Type), request)); err != nil {
-						session.onError(err)
-					}
-					log.Errorf("Requested type: %s, not found\n", request.Type)
-					go transaction.Complete(false)
+				if err = session.webSocketSend(requestErrorHelper(fmt.Sprintf("Requested component: %s, not found",
+					request.Component), request)); err != nil {
+					session.onError(err)
 				}
+				log.WithFields(requestFields(user, request)).Errorf("Requested component: %s, not found\n",
+					request.Component)
+				go transaction.Complete(false)
 			}
-		}()
+		} else {
+			if err = session.webSocketSend(requestErrorHelper(fmt.Sprintf("Requested type: %s, not found",
+				request.Type), request)); err != nil {
+				session.onError(err)
+			}
+			log.WithFields(requestFields(user, request)).Errorf("Requested type: %s, not found\n", request.Type)
+			go transaction.Complete(false)
+		}
 	}
 }
 
-// common websocket close with logging
+// common websocket close with logging, the session is gone for good after this
 func (session *session) onClose() {
-	log.Debugf("Closing websocket for session %s", session.sessionID)
-	session.ws.Close()
-	delete(sessions, session.sessionID)
+	session.closeOnce.Do(func() {
+		log.WithFields(log.Fields{SessionID: session.sessionID}).Debug("Closing websocket")
+
+		session.writeMutex.Lock()
+		if session.ws != nil {
+			session.ws.Close()
+			session.ws = nil
+		}
+		if session.detachTimer != nil {
+			session.detachTimer.Stop()
+		}
+		close(session.done)
+		session.writeMutex.Unlock()
+
+		pool.drop(session.requests)
+
+		unsubscribeAll(session.sessionID)
+
+		sessionMutex.Lock()
+		defer sessionMutex.Unlock()
+		if _, ok := sessions[session.sessionID]; ok {
+			delete(sessions, session.sessionID)
+			metrics.SessionClosed()
+		}
+	})
 }
 
 // common websocket error handling with logging
 func (session *session) onError(err error) {
-	log.Errorf("Error receiving / sending message: %s\n", err)
+	log.WithFields(log.Fields{SessionID: session.sessionID}).Errorf("Error receiving / sending message: %s\n", err)
+}
+
+// startRequestSpan starts the span that covers the handling of a request
+func startRequestSpan(user *string, request configs.WsMessage) (context.Context, trace.Span) {
+	attributes := []attribute.KeyValue{
+		attribute.String("session.id", request.SessionID),
+		attribute.String("component", string(request.Component)),
+		attribute.String("subcomponent", string(request.SubComponent)),
+	}
+	if user != nil {
+		attributes = append(attributes, attribute.String("user", *user))
+	}
+	if request.Target != nil {
+		attributes = append(attributes, attribute.String("target", *request.Target))
+	}
+	return tracing.StartSpan(tracing.FromMessage(request),
+		fmt.Sprintf("%s %s %s", request.Type, request.Component, request.SubComponent), attributes...)
+}
+
+// requestFields are the log fields that tie a log entry to the request
+func requestFields(user *string, request configs.WsMessage) log.Fields {
+	fields := log.Fields{
+		SessionID: request.SessionID,
+		Component: string(request.Component),
+		RequestID: request.RequestID,
+	}
+	if user != nil {
+		fields.User = *user
+	}
+	return fields
 }
 
 // The UI will occasionally ping the server due to the websocket default timeout
@@ -176,62 +462,162 @@ func requestErrorHelper(err string, request configs.WsMessage) configs.WsMessage
 	return configs.WsMessage{
 		Type:      request.Type,
 		Component: request.Component,
+		RequestID: request.RequestID,
 		Error:     &err,
 	}
 }
 
-// newSession generates a new session
-func newSession(ws *websocket.Conn) *session {
+// newSession generates a new session, it has no connection until one is attached
+func newSession(options *connectionOptions) *session {
 	id := uuid.New().String()
 
 	session := &session{
-		sessionID: id,
-		ws:        ws,
+		sessionID:   id,
+		resumeToken: newResumeToken(),
+		outbox:      newOutbox(options.replayBuffer, options.replayBufferBytes),
+		options:     options,
+		limiter:     newRateLimiter(options.messageRate, options.messageBurst),
+		requests:    &requestQueue{},
+		done:        make(chan struct{}),
 	}
 
 	// keep track of the session
+	sessionMutex.Lock()
 	sessions[id] = session
-
-	// send the init message to the client
-	go session.sendInit()
+	sessionMutex.Unlock()
+	metrics.SessionOpened()
 
 	return session
 }
 
 // webSocketSend allows for the sender to be thread safe, we cannot write to the websocket at the same time
+// Every message is numbered and kept so it can be replayed, while the client is away it's only kept.
+// Clients that take chunks get large YAML in pieces, one message each
 func (session *session) webSocketSend(response configs.WsMessage) error {
 	session.writeMutex.Lock()
 	defer session.writeMutex.Unlock()
-	response.Timestamp = time.Now().UnixNano() / 1000000
-	response.SessionID = session.sessionID
 
-	return session.ws.WriteJSON(response)
+	messages := []configs.WsMessage{response}
+	if session.protocolVersion >= configs.ChunkedProtocolVersion {
+		messages = chunk(response, session.options.chunkSize)
+	}
+
+	// the session speaks JSON until a connection says otherwise
+	c := session.codec
+	if c == nil {
+		c = codecs[jsonEncoding]
+	}
+
+	for _, message := range messages {
+		session.sequence++
+		message.Sequence = session.sequence
+		message.Timestamp = time.Now().UnixNano() / 1000000
+		message.SessionID = session.sessionID
+
+		b, err := c.marshal(message)
+		if err != nil {
+			return err
+		}
+		session.outbox.add(message, len(b))
+
+		if session.ws == nil {
+			continue
+		}
+		if err = writeFrame(session.ws, c, b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// write sends the message on the connection in the encoding of the codec, the writeMutex has to be held
+func write(ws *websocket.Conn, c codec, message configs.WsMessage) error {
+	b, err := c.marshal(message)
+	if err != nil {
+		return err
+	}
+	return writeFrame(ws, c, b)
+}
+
+// writeFrame sends the encoded message on the connection, the writeMutex has to be held
+func writeFrame(ws *websocket.Conn, c codec, b []byte) error {
+	if err := ws.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+		return err
+	}
+	// this does nothing if compression wasn't negotiated
+	ws.EnableWriteCompression(len(b) >= compressionThreshold)
+	return ws.WriteMessage(c.frameType(), b)
+}
+
+// invalidMessage is a frame that was read but isn't a message that can be handled, unlike the other read errors
+// there's nothing wrong with the connection
+type invalidMessage struct {
+	err error
+}
+
+func (e invalidMessage) Error() string {
+	return e.err.Error()
+}
+
+// read waits for the next message, it's decoded by the type of frame it came in.  A request that doesn't fit
+// the schema of its message never reaches the function that handles it, so the frame is checked as it was sent
+// before it's decoded into a message, what's left of the message is returned with the error to answer it with
+func read(ws *websocket.Conn) (configs.WsMessage, error) {
+	var message configs.WsMessage
+	frameType, b, err := ws.ReadMessage()
+	if err != nil {
+		return message, err
+	}
+
+	c := codecFor(frameType)
+	value, err := c.decode(b)
+	if err != nil {
+		return message, invalidMessage{fmt.Errorf("Invalid message: %s", err)}
+	}
+
+	validationErr := validateRequest(value)
+	if err = c.unmarshal(b, &message); err != nil && validationErr == nil {
+		validationErr = fmt.Errorf("Invalid %s message: %s", schema.KeyOf(value), err)
+	}
+	if validationErr != nil {
+		return message, invalidMessage{validationErr}
+	}
+
+	return message, nil
 }
 
 // WebSocketSend allows of other packages to send a request for the websocket
 func WebSocketSend(response configs.WsMessage) error {
-	if session, ok := sessions[response.SessionID]; ok {
+	if session, ok := getSession(response.SessionID); ok {
 		return session.webSocketSend(response)
 	}
 
 	return errors.New("session id " + response.SessionID + "not found")
 }
 
-// sendInit is generated on the onOpen event and sends the information the UI needs to startup
-func (session *session) sendInit() {
-	if err := session.webSocketSend(configs.WsMessage{
-		Type:       configs.UI,
-		Component:  configs.Initialize,
-		Dashboards: configs.UIConfig.Dashboards,
-		AuthMethod: configs.UIConfig.AuthMethod,
-	}); err != nil {
-		log.Errorf("Error receiving / sending init to session %s: %s\n", session.sessionID, err)
+// CloseAllSessions is called when the system is exiting to cleanly close all the current connections
+func CloseAllSessions() {
+	for _, session := range allSessions() {
+		session.onClose()
 	}
 }
 
-// CloseAllSessions is called when the system is exiting to cleanly close all the current connections
-func CloseAllSessions() {
+// getSession looks up an open session
+func getSession(id string) (*session, bool) {
+	sessionMutex.RLock()
+	defer sessionMutex.RUnlock()
+	session, ok := sessions[id]
+	return session, ok
+}
+
+// allSessions is a copy of the open sessions, so they can be closed while going through them
+func allSessions() []*session {
+	sessionMutex.RLock()
+	defer sessionMutex.RUnlock()
+	all := make([]*session, 0, len(sessions))
 	for _, session := range sessions {
-		session.onClose()
+		all = append(all, session)
 	}
+	return all
 }
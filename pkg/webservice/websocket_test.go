@@ -0,0 +1,96 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+)
+
+func TestRequestErrorHelper(t *testing.T) {
+	response := requestErrorHelper("Requested component: nope, not found", configs.WsMessage{
+		Type:      configs.CTL,
+		Component: "nope",
+		RequestID: "r-1",
+	})
+
+	assert.Equal(t, configs.CTL, response.Type)
+	assert.Equal(t, configs.WsComponentType("nope"), response.Component)
+	assert.Equal(t, "r-1", response.RequestID)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "Requested component: nope, not found", *response.Error)
+}
+
+func TestRequestFields(t *testing.T) {
+	user := "a"
+	fields := requestFields(&user, configs.WsMessage{
+		SessionID: "s-1",
+		Component: configs.Phase,
+		RequestID: "r-1",
+	})
+
+	assert.Equal(t, "s-1", fields.SessionID)
+	assert.Equal(t, "a", fields.User)
+	assert.Equal(t, "r-1", fields.RequestID)
+}
+
+type testHandler struct {
+	requestType configs.WsRequestType
+	components  []configs.WsComponentType
+}
+
+func (h testHandler) Components() (configs.WsRequestType, []configs.WsComponentType) {
+	return h.requestType, h.components
+}
+
+func (h testHandler) Handle(_ *string, request configs.WsMessage) configs.WsMessage {
+	return configs.WsMessage{Type: request.Type, Component: request.Component, Name: "handled"}
+}
+
+func TestAppendComponentHandler(t *testing.T) {
+	defer delete(funcMap, "inventory")
+
+	require.NoError(t, AppendComponentHandler(testHandler{"inventory", []configs.WsComponentType{"host", "rack"}}))
+	require.Contains(t, funcMap["inventory"], configs.WsComponentType("rack"))
+	response := funcMap["inventory"]["host"](nil, configs.WsMessage{Type: "inventory", Component: "host"})
+	assert.Equal(t, "handled", response.Name)
+
+	// nothing is replaced, and the UI messages that go without a token can't be taken over
+	assert.Error(t, AppendComponentHandler(testHandler{"inventory", []configs.WsComponentType{"site", "host"}}))
+	assert.NotContains(t, funcMap["inventory"], configs.WsComponentType("site"))
+	assert.Error(t, AppendComponentHandler(testHandler{configs.UI, []configs.WsComponentType{"lookup"}}))
+	assert.Error(t, AppendComponentHandler(testHandler{"", []configs.WsComponentType{"lookup"}}))
+}
+
+func TestAppendComponentHandlerCopies(t *testing.T) {
+	defer delete(funcMap, "inventory")
+
+	// the map another package added is left alone, it could be handling requests
+	functions := map[configs.WsComponentType]func(*string, configs.WsMessage) configs.WsMessage{
+		"site": testHandler{}.Handle,
+	}
+	AppendToFunctionMap("inventory", functions)
+	require.NoError(t, AppendComponentHandler(testHandler{"inventory", []configs.WsComponentType{"host"}}))
+	assert.Len(t, functions, 1)
+
+	inventory, ok := functionsFor("inventory")
+	require.True(t, ok)
+	assert.Contains(t, inventory, configs.WsComponentType("site"))
+	assert.Contains(t, inventory, configs.WsComponentType("host"))
+}
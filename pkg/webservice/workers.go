@@ -0,0 +1,197 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"errors"
+	"sync"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+	"opendev.org/airship/airshipui/pkg/metrics"
+)
+
+// the limits used for anything the config doesn't set
+const (
+	defaultConcurrent        = 64
+	defaultSessionConcurrent = 8
+	defaultQueueDepth        = 256
+	defaultSessionQueueDepth = 32
+)
+
+var errServerBusy = errors.New("Server busy, try again later")
+
+// workerPool handles the websocket requests with a fixed number of workers.  Each session queues its requests
+// on its own and the workers take them from the sessions in turn, so a busy session can't hold up the others.
+// A session gets at most sessionConcurrent of the workers and sessionQueueDepth of the queue
+type workerPool struct {
+	concurrent        int
+	sessionConcurrent int
+	queueDepth        int
+	sessionQueueDepth int
+
+	// the mutex guards the queues and the counts, cond wakes up the workers waiting for a request
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	ready   []*requestQueue
+	queued  int
+	running int
+	start   sync.Once
+}
+
+// requestQueue holds the requests of a session waiting for a worker
+type requestQueue struct {
+	pending []func()
+	running int
+	closed  bool
+}
+
+// pool is replaced with one built from the config when the webservice starts
+var pool = newWorkerPool(nil)
+
+// newWorkerPool builds a pool with the limits, falling back to the defaults for those that aren't set.
+// The workers are started with the first request
+func newWorkerPool(limits *configs.Limits) *workerPool {
+	l := configs.Limits{}
+	if limits != nil {
+		l = *limits
+	}
+	if l.Concurrent <= 0 {
+		l.Concurrent = defaultConcurrent
+	}
+	if l.SessionConcurrent <= 0 {
+		l.SessionConcurrent = defaultSessionConcurrent
+	}
+	if l.QueueDepth <= 0 {
+		l.QueueDepth = defaultQueueDepth
+	}
+	if l.SessionQueueDepth <= 0 {
+		l.SessionQueueDepth = defaultSessionQueueDepth
+	}
+
+	p := &workerPool{
+		concurrent:        l.Concurrent,
+		sessionConcurrent: l.SessionConcurrent,
+		queueDepth:        l.QueueDepth,
+		sessionQueueDepth: l.SessionQueueDepth,
+	}
+	p.cond = sync.NewCond(&p.mutex)
+	return p
+}
+
+// submit queues the work for the session, it returns errServerBusy without running it if the queue or the queue
+// of the session is full.  Work of a closed session is dropped
+func (p *workerPool) submit(session *session, work func()) error {
+	p.start.Do(func() {
+		for i := 0; i < p.concurrent; i++ {
+			go p.worker()
+		}
+	})
+
+	p.mutex.Lock()
+	q := session.requests
+	if q.closed {
+		p.mutex.Unlock()
+		return nil
+	}
+	if p.queued >= p.queueDepth || len(q.pending) >= p.sessionQueueDepth {
+		p.mutex.Unlock()
+		metrics.RequestRejected()
+		return errServerBusy
+	}
+	if len(q.pending) == 0 {
+		p.ready = append(p.ready, q)
+	}
+	q.pending = append(q.pending, work)
+	p.queued++
+	p.mutex.Unlock()
+
+	metrics.RequestQueued()
+	p.cond.Signal()
+	return nil
+}
+
+// worker handles requests for as long as the process runs
+func (p *workerPool) worker() {
+	for {
+		q, work := p.next()
+		metrics.RequestDequeued()
+		metrics.RequestStarted()
+
+		work()
+
+		metrics.RequestFinished()
+		p.mutex.Lock()
+		q.running--
+		p.running--
+		p.mutex.Unlock()
+	}
+}
+
+// next waits for a request of a session that isn't already using all of its workers.  The session goes to the
+// back of the line so the other sessions get their turn first
+func (p *workerPool) next() (*requestQueue, func()) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for {
+		for i, q := range p.ready {
+			if q.running >= p.sessionConcurrent {
+				continue
+			}
+
+			work := q.pending[0]
+			q.pending[0] = nil
+			q.pending = q.pending[1:]
+			q.running++
+			p.queued--
+			p.running++
+
+			p.ready = append(p.ready[:i], p.ready[i+1:]...)
+			if len(q.pending) > 0 {
+				p.ready = append(p.ready, q)
+			}
+			return q, work
+		}
+
+		p.cond.Wait()
+	}
+}
+
+// drop closes the queue of a session that's gone, the requests still waiting in it are never run
+func (p *workerPool) drop(q *requestQueue) {
+	p.mutex.Lock()
+	dropped := len(q.pending)
+	q.closed = true
+	q.pending = nil
+	p.queued -= dropped
+	for i, ready := range p.ready {
+		if ready == q {
+			p.ready = append(p.ready[:i], p.ready[i+1:]...)
+			break
+		}
+	}
+	p.mutex.Unlock()
+
+	for i := 0; i < dropped; i++ {
+		metrics.RequestDequeued()
+	}
+}
+
+// queueLength is the number of requests waiting for a worker
+func (p *workerPool) queueLength() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.queued
+}
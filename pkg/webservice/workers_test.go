@@ -0,0 +1,149 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webservice
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"opendev.org/airship/airshipui/pkg/configs"
+)
+
+func newTestSession() *session {
+	return &session{
+		requests: &requestQueue{},
+		done:     make(chan struct{}),
+	}
+}
+
+// runningLength is the number of requests the workers are handling
+func (p *workerPool) runningLength() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.running
+}
+
+func TestWorkerPoolDefaults(t *testing.T) {
+	p := newWorkerPool(&configs.Limits{Concurrent: 2})
+	assert.Equal(t, 2, p.concurrent)
+	assert.Equal(t, defaultSessionConcurrent, p.sessionConcurrent)
+	assert.Equal(t, defaultQueueDepth, p.queueDepth)
+	assert.Equal(t, defaultSessionQueueDepth, p.sessionQueueDepth)
+}
+
+func TestWorkerPoolLimits(t *testing.T) {
+	p := newWorkerPool(&configs.Limits{Concurrent: 2, SessionConcurrent: 1, QueueDepth: 3})
+	first, second := newTestSession(), newTestSession()
+
+	release := make(chan struct{})
+	var mutex sync.Mutex
+	running := map[*session]int{}
+	var wg sync.WaitGroup
+	work := func(s *session) func() {
+		wg.Add(1)
+		return func() {
+			defer wg.Done()
+			mutex.Lock()
+			running[s]++
+			mutex.Unlock()
+			<-release
+		}
+	}
+
+	// each session only gets one worker so the second request of the first session waits in the queue
+	require.NoError(t, p.submit(first, work(first)))
+	require.NoError(t, p.submit(first, work(first)))
+	require.NoError(t, p.submit(second, work(second)))
+
+	assert.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return running[first] == 1 && running[second] == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, p.queueLength())
+
+	// the queue fills up and the next request is turned away
+	require.NoError(t, p.submit(second, work(second)))
+	require.NoError(t, p.submit(second, work(second)))
+	assert.Equal(t, errServerBusy, p.submit(second, func() {}))
+	assert.Equal(t, 3, p.queueLength())
+
+	close(release)
+	wg.Wait()
+	assert.Eventually(t, func() bool { return p.runningLength() == 0 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, p.queueLength())
+}
+
+func TestWorkerPoolSessionQueue(t *testing.T) {
+	p := newWorkerPool(&configs.Limits{Concurrent: 1, SessionQueueDepth: 2})
+	busy, quiet := newTestSession(), newTestSession()
+
+	release := make(chan struct{})
+	require.NoError(t, p.submit(busy, func() { <-release }))
+	assert.Eventually(t, func() bool { return p.runningLength() == 1 }, time.Second, 10*time.Millisecond)
+
+	// a session can't take more than its part of the queue
+	var mutex sync.Mutex
+	order := []*session{}
+	var wg sync.WaitGroup
+	work := func(s *session) func() {
+		wg.Add(1)
+		return func() {
+			defer wg.Done()
+			mutex.Lock()
+			order = append(order, s)
+			mutex.Unlock()
+		}
+	}
+	require.NoError(t, p.submit(busy, work(busy)))
+	require.NoError(t, p.submit(busy, work(busy)))
+	assert.Equal(t, errServerBusy, p.submit(busy, func() {}))
+	require.NoError(t, p.submit(quiet, work(quiet)))
+
+	// the sessions take turns, the quiet one doesn't wait for everything the busy one queued
+	close(release)
+	wg.Wait()
+	assert.Equal(t, []*session{busy, quiet, busy}, order)
+}
+
+func TestWorkerPoolSessionClosed(t *testing.T) {
+	p := newWorkerPool(&configs.Limits{Concurrent: 1, SessionConcurrent: 1, QueueDepth: 1})
+	s := newTestSession()
+
+	release := make(chan struct{})
+	require.NoError(t, p.submit(s, func() { <-release }))
+	assert.Eventually(t, func() bool { return p.runningLength() == 1 }, time.Second, 10*time.Millisecond)
+
+	// the queued request is dropped once the session goes away
+	ran := make(chan struct{})
+	require.NoError(t, p.submit(s, func() { close(ran) }))
+	p.drop(s.requests)
+	assert.Equal(t, 0, p.queueLength())
+
+	// and anything the session sends after that
+	require.NoError(t, p.submit(s, func() { close(ran) }))
+	assert.Equal(t, 0, p.queueLength())
+
+	close(release)
+	select {
+	case <-ran:
+		t.Fatal("request of a closed session was run")
+	case <-time.After(100 * time.Millisecond):
+	}
+}